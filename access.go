@@ -0,0 +1,358 @@
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// accessLogName имя журнала обращений внутри rootDir
+const accessLogName = "~access.log"
+
+// AccessTracker учитывает время последнего обращения к файлам хранилища.
+// По этим сведениям Clean и EvictLRU определяют, какие файлы удалять.
+type AccessTracker interface {
+	// Touch отмечает обращение к файлу name в момент t.
+	Touch(name string, t time.Time)
+
+	// LastAccess возвращает время последнего обращения к файлу name, если оно известно.
+	LastAccess(name string) (time.Time, bool)
+
+	// Forget удаляет сведения об удалённом файле.
+	Forget(name string)
+
+	// Close сохраняет накопленные сведения и освобождает ресурсы.
+	Close() error
+}
+
+// WithAccessTracker задаёт способ учёта обращений к файлам. По умолчанию используется
+// LogTracker с журналом в rootDir. Трекер закрывается методом LocalStorage.Close.
+func WithAccessTracker(t AccessTracker) LocalStorageOption {
+	return func(s *LocalStorage) {
+		s.access = t
+	}
+}
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс AccessTracker.
+var _ AccessTracker = (*LogTracker)(nil)
+
+// LogTracker хранит время обращений в памяти и периодически дописывает изменения
+// в журнал. При открытии журнал читается целиком, а при разрастании перезаписывается.
+type LogTracker struct {
+	path          string
+	granularity   time.Duration
+	flushInterval time.Duration
+
+	mu      sync.Mutex
+	last    map[string]time.Time
+	pending map[string]time.Time
+	lines   int // количество записей в журнале
+	timer   *time.Timer
+	closed  bool
+}
+
+type LogTrackerOption func(*LogTracker)
+
+// WithGranularity задаёт точность учёта: повторные обращения к файлу в пределах d
+// не записываются. Например, при d = time.Hour для каждого файла делается не более
+// одной записи в час.
+func WithGranularity(d time.Duration) LogTrackerOption {
+	return func(t *LogTracker) {
+		t.granularity = d
+	}
+}
+
+// WithFlushInterval задаёт, как долго изменения накапливаются в памяти перед записью в журнал.
+// По умолчанию — одна минута.
+func WithFlushInterval(d time.Duration) LogTrackerOption {
+	return func(t *LogTracker) {
+		t.flushInterval = d
+	}
+}
+
+// NewLogTracker открывает журнал обращений path, создавая его при необходимости.
+func NewLogTracker(path string, opts ...LogTrackerOption) (*LogTracker, error) {
+	t := &LogTracker{
+		path:          path,
+		flushInterval: time.Minute,
+		last:          make(map[string]time.Time),
+		pending:       make(map[string]time.Time),
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Touch реализует метод AccessTracker.
+func (t *LogTracker) Touch(name string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if prev, ok := t.last[name]; ok && at.Sub(prev) < t.granularity {
+		return
+	}
+	t.last[name] = at
+	t.pending[name] = at
+
+	// Запись выполняется отложенно, накопленными изменениями
+	if t.timer == nil && !t.closed {
+		t.timer = time.AfterFunc(t.flushInterval, func() {
+			t.Flush()
+		})
+	}
+}
+
+// LastAccess реализует метод AccessTracker.
+func (t *LogTracker) LastAccess(name string) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	at, ok := t.last[name]
+	return at, ok
+}
+
+// Forget реализует метод AccessTracker.
+func (t *LogTracker) Forget(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.last, name)
+	delete(t.pending, name)
+}
+
+// Flush дописывает накопленные изменения в журнал.
+func (t *LogTracker) Flush() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.flush()
+}
+
+// Close реализует метод AccessTracker.
+func (t *LogTracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	return t.flush()
+}
+
+// flush записывает изменения. Вызывающий должен удерживать мьютекс.
+func (t *LogTracker) flush() error {
+	if t.timer != nil {
+		t.timer.Stop()
+		t.timer = nil
+	}
+	if len(t.pending) == 0 {
+		return nil
+	}
+
+	// Журнал, в котором устаревших записей больше, чем актуальных, переписываем целиком
+	if t.lines+len(t.pending) > 2*len(t.last)+1024 {
+		if err := t.compact(); err != nil {
+			return err
+		}
+		clear(t.pending)
+		return nil
+	}
+
+	f, err := os.OpenFile(t.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	for name, at := range t.pending {
+		fmt.Fprintf(&buf, "%s %d\n", name, at.UnixNano())
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	t.lines += len(t.pending)
+	clear(t.pending)
+	return nil
+}
+
+// compact атомарно перезаписывает журнал текущим состоянием.
+func (t *LogTracker) compact() error {
+	var buf bytes.Buffer
+	for name, at := range t.last {
+		fmt.Fprintf(&buf, "%s %d\n", name, at.UnixNano())
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(t.path), "~tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), t.path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	t.lines = len(t.last)
+	return nil
+}
+
+// load читает журнал. Повреждённые строки (например, недописанные при сбое) пропускаются.
+func (t *LogTracker) load() error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, ts, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			continue
+		}
+		if at := time.Unix(0, n); at.After(t.last[name]) {
+			t.last[name] = at
+		}
+		t.lines++
+	}
+	return scanner.Err()
+}
+
+// touch отмечает обращение к файлу.
+func (s *LocalStorage) touch(name string) {
+	if s.access != nil {
+		s.access.Touch(name, time.Now())
+	}
+}
+
+// lastAccess возвращает время последнего обращения к файлу. Для файлов, обращений
+// к которым ещё не было, используется время изменения файла.
+func (s *LocalStorage) lastAccess(name string, info fs.FileInfo) time.Time {
+	if s.access != nil {
+		if at, ok := s.access.LastAccess(name); ok && at.After(info.ModTime()) {
+			return at
+		}
+	}
+	return info.ModTime()
+}
+
+// forget удаляет сведения об обращениях к удалённому файлу.
+func (s *LocalStorage) forget(name string) {
+	if s.access != nil {
+		s.access.Forget(name)
+	}
+}
+
+// Close сохраняет сведения об обращениях к файлам. После Close хранилище
+// продолжает работать, но обращения больше не сохраняются.
+func (s *LocalStorage) Close() error {
+	if s.access != nil {
+		return s.access.Close()
+	}
+	return nil
+}
+
+// EvictLRU удаляет файлы, к которым дольше всего не обращались, пока суммарный размер
+// файлов хранилища превышает maxBytes. Фрагменты, на которые ссылаются манифесты,
+// удаляются только вместе с последним ссылающимся на них файлом. Возвращает имена удалённых файлов.
+func (s *LocalStorage) EvictLRU(ctx context.Context, maxBytes int64) ([]string, error) {
+	type blob struct {
+		name, path string
+		size       int64
+		access     time.Time
+	}
+
+	var blobs []blob
+	sizes := make(map[string]int64)
+	var total int64
+	err := s.walkBlobs(ctx, func(name, path string, info fs.FileInfo) error {
+		// Защищённые файлы учитываются в общем размере, но не удаляются
+		if !s.isProtected(name) {
+			blobs = append(blobs, blob{name, path, info.Size(), s.lastAccess(name, info)})
+		}
+		sizes[name] = info.Size()
+		total += info.Size()
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if total <= maxBytes {
+		return nil, nil
+	}
+
+	sort.Slice(blobs, func(i, j int) bool { return blobs[i].access.Before(blobs[j].access) })
+
+	var removed []string
+	for _, b := range blobs {
+		if total <= maxBytes {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return removed, err
+		}
+
+		// Фрагменты, освобождённые при удалении манифеста, также учитываем
+		chunks, _ := s.manifestChunks(b.name, b.path)
+		if s.evict(b.name, b.path) != nil {
+			continue
+		}
+		removed = append(removed, b.name)
+		total -= b.size
+		for _, c := range chunks {
+			if !s.hasChunk(c.name) {
+				total -= sizes[c.name]
+				delete(sizes, c.name)
+			}
+		}
+	}
+	return removed, nil
+}
+
+// evict удаляет файл под блокировкой его имени.
+func (s *LocalStorage) evict(name, path string) error {
+	mu := s.getMutex(name)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		s.releaseMutex(name)
+	}()
+
+	// Файл мог быть удалён вместе с манифестом
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	return s.removeBlob(name, path)
+}
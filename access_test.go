@@ -0,0 +1,166 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogTracker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), accessLogName)
+	tr, err := NewLogTracker(path, WithGranularity(time.Hour), WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t0 := time.Now().Truncate(time.Second)
+	tr.Touch("a", t0)
+	tr.Touch("a", t0.Add(time.Minute)) // в пределах точности учёта
+	tr.Touch("b", t0)
+	tr.Touch("c", t0)
+	tr.Forget("c")
+	if at, ok := tr.LastAccess("a"); !ok || !at.Equal(t0) {
+		t.Fatalf("unexpected last access %v, %v", at, ok)
+	}
+	if err := tr.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Недописанные и повреждённые строки пропускаются
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("garbage\nb not-a-number\nb 17")
+	f.Close()
+
+	tr, err = NewLogTracker(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+	for name, want := range map[string]time.Time{"a": t0, "b": t0} {
+		if at, ok := tr.LastAccess(name); !ok || !at.Equal(want) {
+			t.Fatalf("%s: unexpected last access %v, %v", name, at, ok)
+		}
+	}
+	if _, ok := tr.LastAccess("c"); ok {
+		t.Fatal("forgotten file is restored")
+	}
+}
+
+// Журнал с устаревшими записями перезаписывается.
+func TestLogTrackerCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), accessLogName)
+	tr, err := NewLogTracker(path, WithFlushInterval(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tr.Close()
+
+	t0 := time.Now()
+	for i := range 3000 {
+		tr.Touch("a", t0.Add(time.Duration(i)))
+		if err := tr.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines > 1100 {
+		t.Fatalf("log is not compacted: %d lines", lines)
+	}
+}
+
+func TestCleanLastAccess(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var files []*FileInfo
+	old := time.Now().Add(-48 * time.Hour)
+	for _, content := range []string{"stale", "accessed", "recreated"} {
+		fi := createBlob(t, s, []byte(content))
+		fullPath, err := s.GetFullPath(fi.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(fullPath, old, old)
+		s.access.Forget(fi.Name)
+		files = append(files, fi)
+	}
+
+	// Обращения отмечаются при чтении и повторном сохранении
+	f, err := s.Open(files[1].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	createBlob(t, s, []byte("recreated"))
+
+	// Сведения об обращениях сохраняются между запусками
+	s.Close()
+	s, err = NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if err := s.Clean(context.Background(), 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for i, fi := range files {
+		if ok, _ := s.IsExists(fi.Name); ok != (i > 0) {
+			t.Fatalf("%d: unexpected existence %v", i, ok)
+		}
+	}
+	if _, ok := s.access.LastAccess(files[0].Name); ok {
+		t.Fatal("removed file is not forgotten")
+	}
+}
+
+func TestEvictLRU(t *testing.T) {
+	s := newTestStorage(t)
+
+	var names []string
+	old := time.Now().Add(-time.Hour)
+	for i := range 5 {
+		fi := createBlob(t, s, []byte(strings.Repeat(string(rune('a'+i)), 1000)))
+		fullPath, err := s.GetFullPath(fi.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(fullPath, old, old)
+		s.access.Forget(fi.Name)
+		names = append(names, fi.Name)
+	}
+	// Порядок обращений: 3, 1, 4, 0, 2
+	for i, n := range []int{3, 1, 4, 0, 2} {
+		s.access.Touch(names[n], old.Add(time.Duration(i)*time.Minute))
+	}
+
+	if removed, err := s.EvictLRU(context.Background(), 5000); err != nil || len(removed) != 0 {
+		t.Fatalf("unexpected eviction %v, %v", removed, err)
+	}
+	removed, err := s.EvictLRU(context.Background(), 2500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{names[3], names[1], names[4]}; !slices.Equal(removed, want) {
+		t.Fatalf("expected %v to be evicted, got %v", want, removed)
+	}
+	for _, n := range []int{0, 2} {
+		if ok, _ := s.IsExists(names[n]); !ok {
+			t.Fatalf("recently used file %d is evicted", n)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tenrok/filestore/compression"
+	"github.com/tenrok/filestore/encryption"
+)
+
+var (
+	// ErrNoKeyProvider возвращается при открытии зашифрованного файла, если ключи не заданы.
+	ErrNoKeyProvider = errors.New("file is encrypted but no key provider is configured")
+
+	// ErrNotEncoded возвращается, если файл не хранится в запрошенном сжатом представлении.
+	ErrNotEncoded = errors.New("file is not stored with the requested encoding")
+)
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс File.
+var _ File = (*blobFile)(nil)
+
+// blobFile описывает файл хранилища, содержимое которого декодируется при чтении.
+type blobFile struct {
+	*io.SectionReader
+	file   *os.File
+	info   fs.FileInfo
+	closer io.Closer // дополнительно закрываемый ресурс (например, открытые фрагменты)
+}
+
+func (f *blobFile) Close() error {
+	if f.closer != nil {
+		f.closer.Close()
+	}
+	return f.file.Close()
+}
+
+// Readdir требуется для http.File. Для файлов возвращает ошибку.
+func (f *blobFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, fs.ErrInvalid
+}
+
+func (f *blobFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// blobInfo подменяет размер хранимого файла размером исходного содержимого.
+type blobInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (fi *blobInfo) Size() int64 { return fi.size }
+
+// encode подготавливает временный файл с исходным содержимым к сохранению в хранилище:
+// сначала сжимает его согласно политике, затем шифрует. Возвращает путь к файлу, который
+// необходимо переместить на место (это либо сам path, либо новый временный файл),
+// и способ кодирования, который необходимо записать в метаданные.
+func (s *LocalStorage) encode(path string, fi *FileInfo) (string, blobEncoding, error) {
+	var enc blobEncoding
+	cur := path
+
+	if s.compression != nil && s.compression.match(fi) {
+		compressed, err := s.compress(path, fi.Size)
+		if err != nil {
+			return "", enc, err
+		}
+		if compressed != "" {
+			cur = compressed
+			enc.Compressed = true
+		}
+	}
+
+	if s.keys == nil {
+		return cur, enc, nil
+	}
+
+	src, err := os.Open(cur)
+	if err != nil {
+		return "", enc, err
+	}
+	encrypted, err := s.encrypt(src)
+	src.Close()
+
+	// Промежуточный сжатый файл больше не нужен
+	if cur != path {
+		os.Remove(cur)
+	}
+	enc.Encrypted = true
+	return encrypted, enc, err
+}
+
+// encrypt шифрует содержимое r во временный файл и возвращает путь к нему.
+func (s *LocalStorage) encrypt(r io.Reader) (string, error) {
+	key, err := encryption.GenerateDataKey(s.keys)
+	if err != nil {
+		return "", err
+	}
+
+	tmpfile, err := os.CreateTemp(s.rootDir, "~tmp")
+	if err != nil {
+		return "", err
+	}
+
+	if err := func() error {
+		w, err := encryption.NewWriter(tmpfile, key)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		return tmpfile.Sync()
+	}(); err != nil {
+		tmpfile.Close()
+		os.Remove(tmpfile.Name())
+		return "", err
+	}
+
+	if err := tmpfile.Close(); err != nil {
+		os.Remove(tmpfile.Name())
+		return "", err
+	}
+
+	return tmpfile.Name(), nil
+}
+
+// decode возвращает File, декодирующий содержимое открытого файла хранилища согласно
+// записанному способу кодирования enc. Незакодированные файлы возвращаются как есть.
+func (s *LocalStorage) decode(file *os.File, info fs.FileInfo, enc blobEncoding) (File, error) {
+	r, size, err := s.decrypt(file, info, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	if enc.Chunked {
+		m, err := s.openManifest(r, size)
+		if err != nil {
+			return nil, err
+		}
+		return &blobFile{
+			SectionReader: io.NewSectionReader(m, 0, m.Size()),
+			file:          file,
+			info:          &blobInfo{FileInfo: info, size: m.Size()},
+			closer:        m,
+		}, nil
+	}
+
+	return s.decompress(file, info, r, size, enc)
+}
+
+// decompress возвращает File с распакованным содержимым r, если хранилище его сжимало.
+func (s *LocalStorage) decompress(file *os.File, info fs.FileInfo, r io.ReaderAt, size int64, enc blobEncoding) (File, error) {
+	if enc.Compressed {
+		cr, err := compression.NewReader(r, size)
+		if err != nil {
+			return nil, err
+		}
+		r, size = cr, cr.Size()
+	}
+
+	if r == io.ReaderAt(file) {
+		return file, nil
+	}
+
+	return &blobFile{
+		SectionReader: io.NewSectionReader(r, 0, size),
+		file:          file,
+		info:          &blobInfo{FileInfo: info, size: size},
+	}, nil
+}
+
+// decodeEncoded возвращает File со сжатым алгоритмом coding содержимым файла хранилища.
+func (s *LocalStorage) decodeEncoded(file *os.File, info fs.FileInfo, enc blobEncoding, coding string) (File, error) {
+	r, size, err := s.decrypt(file, info, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	if !enc.Compressed {
+		return nil, ErrNotEncoded
+	}
+	cr, err := compression.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	if cr.Codec().Name() != coding {
+		return nil, ErrNotEncoded
+	}
+
+	payload := cr.Payload()
+	return &blobFile{
+		SectionReader: payload,
+		file:          file,
+		info:          &blobInfo{FileInfo: info, size: payload.Size()},
+	}, nil
+}
+
+// decrypt возвращает расшифрованное содержимое файла хранилища и его размер.
+// Файлы, не зашифрованные хранилищем, возвращаются как есть.
+func (s *LocalStorage) decrypt(file *os.File, info fs.FileInfo, enc blobEncoding) (io.ReaderAt, int64, error) {
+	if !enc.encrypted(file) {
+		return file, info.Size(), nil
+	}
+	if s.keys == nil {
+		return nil, 0, ErrNoKeyProvider
+	}
+
+	r, err := encryption.NewReader(file, info.Size(), s.keys)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, r.Size(), nil
+}
+
+// isInternal определяет, является ли элемент корневого каталога служебным (временные файлы и т.п.).
+func isInternal(name string) bool {
+	return strings.HasPrefix(name, "~")
+}
+
+// walkBlobs обходит все файлы хранилища, пропуская служебные файлы и каталоги.
+func (s *LocalStorage) walkBlobs(ctx context.Context, fn func(name, path string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(s.rootDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == s.rootDir {
+				return err
+			}
+			return nil // игнорируем ошибки доступа к файлу
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if path == s.rootDir {
+			return nil
+		}
+		if isInternal(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.rootDir, path)
+		if err != nil {
+			return nil
+		}
+
+		return fn(strings.ReplaceAll(rel, string(os.PathSeparator), ""), path, info)
+	})
+}
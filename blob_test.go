@@ -0,0 +1,130 @@
+package filestore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/tenrok/filestore/encryption"
+)
+
+// encryptedMagic сигнатура зашифрованного потока.
+var encryptedMagic = []byte{'F', 'S', 'A', 'E', 'A', 'D', 0x00, 0x01}
+
+func newTestKeyring(t *testing.T, ids ...string) *encryption.Keyring {
+	t.Helper()
+
+	keyring := encryption.NewKeyring()
+	for _, id := range ids {
+		if err := keyring.GenerateKey(id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keyring
+}
+
+func TestEncryption(t *testing.T) {
+	keyring := newTestKeyring(t, "k1")
+	s := newTestStorage(t, WithEncryption(keyring))
+
+	plain := make([]byte, 3*encryption.DefaultChunkSize+10)
+	rand.Read(plain)
+	fi := createBlob(t, s, plain)
+
+	stored := readStored(t, s, fi.Name)
+	if !bytes.HasPrefix(stored, encryptedMagic) || bytes.Contains(stored, plain[:64]) {
+		t.Fatal("file is not encrypted at rest")
+	}
+	if keyID, _, err := encryption.Info(bytes.NewReader(stored), int64(len(stored))); err != nil || keyID != "k1" {
+		t.Fatalf("unexpected key %q: %v", keyID, err)
+	}
+
+	// Имя вычисляется по открытому содержимому, поэтому дедупликация сохраняется
+	if fi2 := createBlob(t, s, plain); fi2.Name != fi.Name {
+		t.Fatalf("expected name %s, got %s", fi.Name, fi2.Name)
+	}
+
+	f, err := s.Open(fi.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(plain)) {
+		t.Fatalf("expected size %d, got %d", len(plain), info.Size())
+	}
+
+	// Чтение произвольного диапазона на границе блоков
+	off := int64(encryption.DefaultChunkSize - 5)
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 10)
+	if _, err := io.ReadFull(f, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain[off:off+10]) {
+		t.Fatal("ranged read mismatch")
+	}
+
+	if !bytes.Equal(readBlob(t, s, fi.Name), plain) {
+		t.Fatal("decrypted data mismatch")
+	}
+}
+
+func TestEncryptionWithoutKeys(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStorage(dir, WithEncryption(newTestKeyring(t, "k1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi := createBlob(t, s, []byte("secret"))
+	s.Close()
+
+	s2, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s2.Close()
+	if _, err := s2.Open(fi.Name); !errors.Is(err, ErrNoKeyProvider) {
+		t.Fatalf("expected ErrNoKeyProvider, got %v", err)
+	}
+
+	s3, err := NewLocalStorage(dir, WithEncryption(newTestKeyring(t, "other")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s3.Close()
+	if _, err := s3.Open(fi.Name); !errors.Is(err, encryption.ErrUnknownKey) {
+		t.Fatalf("expected ErrUnknownKey, got %v", err)
+	}
+}
+
+// Пользовательский файл, который начинается с сигнатуры зашифрованного потока,
+// должен читаться как есть.
+func TestEncryptionMagicPrefix(t *testing.T) {
+	data := append(bytes.Clone(encryptedMagic), "user data"...)
+
+	cases := []struct {
+		name string
+		opts []LocalStorageOption
+	}{
+		{name: "Plain storage", opts: nil},
+		{name: "Encrypted storage", opts: []LocalStorageOption{WithEncryption(newTestKeyring(t, "k1"))}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestStorage(t, tc.opts...)
+			fi := createBlob(t, s, data)
+			if got := readBlob(t, s, fi.Name); !bytes.Equal(got, data) {
+				t.Fatalf("expected %q, got %q", data, got)
+			}
+		})
+	}
+}
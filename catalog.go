@@ -0,0 +1,651 @@
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// catalogDir каталог состояния каталога логических путей внутри rootDir
+const catalogDir = "~catalog"
+
+// catalogPinReason причина закрепления файлов, на которые ссылается каталог
+const catalogPinReason = "catalog"
+
+var (
+	// ErrNotDir возвращается, если элемент пути не является каталогом.
+	ErrNotDir = errors.New("not a directory")
+
+	// ErrIsDir возвращается при попытке выполнить над каталогом операцию для файлов.
+	ErrIsDir = errors.New("is a directory")
+
+	// ErrDirNotEmpty возвращается при попытке удалить непустой каталог.
+	ErrDirNotEmpty = errors.New("directory not empty")
+)
+
+// Catalog отображает логические пути (например, "/tenant/docs/report.pdf") на имена файлов
+// LocalStorage. Несколько логических файлов могут ссылаться на один файл хранилища.
+// Файлы, на которые ссылается каталог, закрепляются и не удаляются методами Clean и EvictLRU.
+//
+// Состояние каталога хранится в rootDir в журнале изменений, который периодически
+// сворачивается в снимок. Методы каталога безопасны для одновременного вызова из нескольких горутин.
+type Catalog struct {
+	s             *LocalStorage
+	dir           string
+	snapshotEvery int
+
+	mu      sync.RWMutex
+	root    *catalogNode
+	refs    map[string]int // количество ссылок на файлы хранилища
+	log     *os.File
+	seq     int64 // номер последней записи журнала
+	records int   // количество записей журнала после снимка
+}
+
+type CatalogOption func(*Catalog)
+
+// WithSnapshotInterval задаёт, после скольких записей журнал сворачивается в снимок.
+// По умолчанию — 1000.
+func WithSnapshotInterval(n int) CatalogOption {
+	return func(c *Catalog) {
+		c.snapshotEvery = n
+	}
+}
+
+// catalogNode описывает файл или каталог. У каталогов children не равно nil.
+type catalogNode struct {
+	name     string
+	blob     string
+	size     int64
+	modTime  time.Time
+	children map[string]*catalogNode
+}
+
+func (n *catalogNode) isDir() bool { return n.children != nil }
+
+// catalogRecord описывает запись журнала каталога. Снимок состоит из записей mkdir и put.
+type catalogRecord struct {
+	Seq  int64     `json:"seq"`
+	Op   string    `json:"op"` // mkdir, put, rename, remove
+	Path string    `json:"path"`
+	To   string    `json:"to,omitempty"`
+	Blob string    `json:"blob,omitempty"`
+	Size int64     `json:"size,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// NewCatalog открывает каталог логических путей хранилища s, восстанавливая его состояние.
+func NewCatalog(s *LocalStorage, opts ...CatalogOption) (*Catalog, error) {
+	c := &Catalog{
+		s:             s,
+		dir:           filepath.Join(s.rootDir, catalogDir),
+		snapshotEvery: 1000,
+		root:          &catalogNode{children: make(map[string]*catalogNode)},
+		refs:          make(map[string]int),
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			opt(c)
+		}
+	}
+
+	if err := os.MkdirAll(c.dir, s.perm); err != nil {
+		return nil, err
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Put сохраняет содержимое r в хранилище и связывает его с логическим путём name.
+// Недостающие родительские каталоги создаются. Существующий файл заменяется.
+func (c *Catalog) Put(ctx context.Context, name string, r io.Reader, opts ...CreateOption) (*FileInfo, error) {
+	fi, err := c.s.Create(ctx, r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.link(name, fi.Name, fi.Size); err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
+// Link связывает логический путь name с уже сохранённым файлом хранилища blob.
+func (c *Catalog) Link(name, blob string) error {
+	f, err := c.s.Open(blob)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return c.link(name, blob, info.Size())
+}
+
+// link связывает путь name с файлом хранилища blob размера size.
+func (c *Catalog) link(name, blob string, size int64) error {
+	p, err := cleanCatalogPath("put", name)
+	if err != nil {
+		return err
+	}
+	if p == "/" {
+		return &fs.PathError{Op: "put", Path: name, Err: ErrIsDir}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n, err := c.find(p); err == nil && n.isDir() {
+		return &fs.PathError{Op: "put", Path: name, Err: ErrIsDir}
+	}
+	if err := c.checkParents("put", p); err != nil {
+		return err
+	}
+
+	// Закрепляем файл до записи в журнал, чтобы он не был удалён очисткой
+	pinned := c.refs[blob] == 0
+	if pinned {
+		if err := c.s.Pin(blob, catalogPinReason); err != nil {
+			return err
+		}
+	}
+	if err := c.commit(&catalogRecord{Op: "put", Path: p, Blob: blob, Size: size}); err != nil {
+		// Если запись не применена, снимаем закрепление, которое ей не принадлежит
+		if pinned && c.refs[blob] == 0 {
+			_ = c.s.Unpin(blob, catalogPinReason)
+		}
+		return err
+	}
+	return nil
+}
+
+// Mkdir создаёт каталог name вместе с недостающими родительскими каталогами.
+// Если каталог уже существует, ошибка не возвращается.
+func (c *Catalog) Mkdir(name string) error {
+	p, err := cleanCatalogPath("mkdir", name)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n, err := c.find(p); err == nil {
+		if !n.isDir() {
+			return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+		}
+		return nil
+	}
+	if err := c.checkParents("mkdir", p); err != nil {
+		return err
+	}
+	return c.commit(&catalogRecord{Op: "mkdir", Path: p})
+}
+
+// Rename переименовывает или перемещает файл или каталог oldname в newname.
+// Существующий файл newname заменяется; каталог newname должен отсутствовать.
+// Недостающие родительские каталоги newname создаются.
+func (c *Catalog) Rename(oldname, newname string) error {
+	from, err := cleanCatalogPath("rename", oldname)
+	if err != nil {
+		return err
+	}
+	to, err := cleanCatalogPath("rename", newname)
+	if err != nil {
+		return err
+	}
+	if from == "/" || to == "/" || to == from {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrInvalid}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, err := c.find(from)
+	if err != nil {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: err}
+	}
+	// Каталог нельзя переместить внутрь самого себя
+	if n.isDir() && strings.HasPrefix(to, from+"/") {
+		return &fs.PathError{Op: "rename", Path: oldname, Err: fs.ErrInvalid}
+	}
+	if dst, err := c.find(to); err == nil && (dst.isDir() || n.isDir()) {
+		return &fs.PathError{Op: "rename", Path: newname, Err: fs.ErrExist}
+	}
+	if err := c.checkParents("rename", to); err != nil {
+		return err
+	}
+	return c.commit(&catalogRecord{Op: "rename", Path: from, To: to})
+}
+
+// Move перемещает файл или каталог name в каталог dir, сохраняя его имя.
+func (c *Catalog) Move(name, dir string) error {
+	return c.Rename(name, path.Join("/", dir, path.Base(path.Clean("/"+name))))
+}
+
+// Remove удаляет файл или пустой каталог name. Файл хранилища открепляется,
+// когда на него не остаётся ссылок, и удаляется методом Clean.
+func (c *Catalog) Remove(name string) error {
+	return c.remove("remove", name, false)
+}
+
+// RemoveAll удаляет файл или каталог name вместе с содержимым.
+// Если name не существует, ошибка не возвращается.
+func (c *Catalog) RemoveAll(name string) error {
+	err := c.remove("removeall", name, true)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (c *Catalog) remove(op, name string, all bool) error {
+	p, err := cleanCatalogPath(op, name)
+	if err != nil {
+		return err
+	}
+	if p == "/" {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, err := c.find(p)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if n.isDir() && len(n.children) > 0 && !all {
+		return &fs.PathError{Op: op, Path: name, Err: ErrDirNotEmpty}
+	}
+	return c.commit(&catalogRecord{Op: "remove", Path: p})
+}
+
+// Lookup возвращает имя файла хранилища, с которым связан логический путь name.
+func (c *Catalog) Lookup(name string) (string, error) {
+	p, err := cleanCatalogPath("lookup", name)
+	if err != nil {
+		return "", err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	n, err := c.find(p)
+	if err != nil {
+		return "", &fs.PathError{Op: "lookup", Path: name, Err: err}
+	}
+	if n.isDir() {
+		return "", &fs.PathError{Op: "lookup", Path: name, Err: ErrIsDir}
+	}
+	return n.blob, nil
+}
+
+// List возвращает содержимое каталога name, упорядоченное по имени.
+func (c *Catalog) List(name string) ([]fs.FileInfo, error) {
+	p, err := cleanCatalogPath("list", name)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	n, err := c.find(p)
+	if err != nil {
+		return nil, &fs.PathError{Op: "list", Path: name, Err: err}
+	}
+	if !n.isDir() {
+		return nil, &fs.PathError{Op: "list", Path: name, Err: ErrNotDir}
+	}
+	return n.list(), nil
+}
+
+// Close сохраняет снимок каталога и закрывает журнал.
+func (c *Catalog) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.log == nil {
+		return nil
+	}
+	err := c.snapshot()
+	if cerr := c.log.Close(); err == nil {
+		err = cerr
+	}
+	c.log = nil
+	return err
+}
+
+// commit записывает изменение в журнал и применяет его. Вызывающий должен удерживать мьютекс.
+func (c *Catalog) commit(rec *catalogRecord) error {
+	if c.log == nil {
+		return os.ErrClosed
+	}
+
+	rec.Seq = c.seq + 1
+	if rec.Time.IsZero() {
+		rec.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := c.log.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if c.s.durable {
+		if err := c.log.Sync(); err != nil {
+			return err
+		}
+	}
+	c.seq = rec.Seq
+	c.records++
+
+	for _, blob := range c.apply(rec) {
+		// Открепление не критично: файл лишь останется в хранилище дольше
+		_ = c.s.Unpin(blob, catalogPinReason)
+	}
+
+	if c.snapshotEvery > 0 && c.records >= c.snapshotEvery {
+		return c.snapshot()
+	}
+	return nil
+}
+
+// apply применяет запись к дереву каталога и возвращает файлы хранилища,
+// на которые больше нет ссылок. Записи, которые нельзя применить, пропускаются.
+func (c *Catalog) apply(rec *catalogRecord) []string {
+	switch rec.Op {
+	case "mkdir":
+		c.mkdirAll(rec.Path, rec.Time)
+
+	case "put":
+		dir := c.mkdirAll(path.Dir(rec.Path), rec.Time)
+		if dir == nil {
+			return nil
+		}
+		base := path.Base(rec.Path)
+		old, ok := dir.children[base]
+		if ok && old.isDir() {
+			return nil
+		}
+		// Ссылку на новый файл учитываем до освобождения старого: при замене файла
+		// тем же содержимым он не должен считаться освобождённым
+		dir.children[base] = &catalogNode{name: base, blob: rec.Blob, size: rec.Size, modTime: rec.Time}
+		c.refs[rec.Blob]++
+		if !ok {
+			return nil
+		}
+		return c.unref(old)
+
+	case "rename":
+		n, err := c.find(rec.Path)
+		if err != nil {
+			return nil
+		}
+		dir := c.mkdirAll(path.Dir(rec.To), rec.Time)
+		if dir == nil {
+			return nil
+		}
+		// Перемещаемый узел сохраняет свои ссылки, поэтому замена файла с тем же
+		// содержимым не освобождает его
+		var released []string
+		base := path.Base(rec.To)
+		if old, ok := dir.children[base]; ok {
+			if old.isDir() || n.isDir() {
+				return nil
+			}
+			released = c.unref(old)
+		}
+		src, _ := c.find(path.Dir(rec.Path))
+		delete(src.children, n.name)
+		n.name = base
+		dir.children[base] = n
+		return released
+
+	case "remove":
+		n, err := c.find(rec.Path)
+		if err != nil || rec.Path == "/" {
+			return nil
+		}
+		dir, _ := c.find(path.Dir(rec.Path))
+		delete(dir.children, n.name)
+		return c.unref(n)
+	}
+	return nil
+}
+
+// unref освобождает ссылки файла или всех файлов каталога n и возвращает файлы
+// хранилища, на которые больше нет ссылок.
+func (c *Catalog) unref(n *catalogNode) []string {
+	if !n.isDir() {
+		c.refs[n.blob]--
+		if c.refs[n.blob] > 0 {
+			return nil
+		}
+		delete(c.refs, n.blob)
+		return []string{n.blob}
+	}
+
+	var released []string
+	for _, child := range n.children {
+		released = append(released, c.unref(child)...)
+	}
+	return released
+}
+
+// mkdirAll создаёт каталог p вместе с родительскими. Возвращает nil, если элемент пути — файл.
+func (c *Catalog) mkdirAll(p string, t time.Time) *catalogNode {
+	n := c.root
+	for _, elem := range splitCatalogPath(p) {
+		child, ok := n.children[elem]
+		if !ok {
+			child = &catalogNode{name: elem, modTime: t, children: make(map[string]*catalogNode)}
+			n.children[elem] = child
+		}
+		if !child.isDir() {
+			return nil
+		}
+		n = child
+	}
+	return n
+}
+
+// find возвращает элемент каталога по очищенному пути p.
+func (c *Catalog) find(p string) (*catalogNode, error) {
+	n := c.root
+	for _, elem := range splitCatalogPath(p) {
+		if !n.isDir() {
+			return nil, ErrNotDir
+		}
+		child, ok := n.children[elem]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+		n = child
+	}
+	return n, nil
+}
+
+// checkParents проверяет, что родительские каталоги пути p существуют или могут быть созданы,
+// то есть ни один элемент пути не является файлом.
+func (c *Catalog) checkParents(op, p string) error {
+	n := c.root
+	for _, elem := range splitCatalogPath(path.Dir(p)) {
+		child, ok := n.children[elem]
+		if !ok {
+			return nil
+		}
+		if !child.isDir() {
+			return &fs.PathError{Op: op, Path: p, Err: ErrNotDir}
+		}
+		n = child
+	}
+	return nil
+}
+
+// list возвращает содержимое каталога, упорядоченное по имени.
+func (n *catalogNode) list() []fs.FileInfo {
+	infos := make([]fs.FileInfo, 0, len(n.children))
+	for _, child := range n.children {
+		infos = append(infos, child.info(child.name))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos
+}
+
+// load восстанавливает состояние каталога из снимка и журнала.
+func (c *Catalog) load() error {
+	snapshotPath := filepath.Join(c.dir, "snapshot")
+	if f, err := os.Open(snapshotPath); err == nil {
+		_, err = c.replay(f, -1)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	snapshotSeq := c.seq
+	c.records = 0
+
+	logPath := filepath.Join(c.dir, "log")
+	f, err := os.OpenFile(logPath, os.O_RDWR|os.O_CREATE, c.s.perm&0666)
+	if err != nil {
+		return err
+	}
+
+	// Записи, уже вошедшие в снимок, пропускаем; недописанную при сбое запись отрезаем
+	valid, err := c.replay(f, snapshotSeq)
+	if err == nil {
+		err = f.Truncate(valid)
+	}
+	if err == nil {
+		_, err = f.Seek(valid, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	c.log = f
+	return nil
+}
+
+// replay применяет записи из r с номерами больше after и возвращает размер
+// корректно прочитанной части.
+func (c *Catalog) replay(r io.Reader, after int64) (int64, error) {
+	var valid int64
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return valid, nil
+		}
+		if err != nil {
+			return valid, err
+		}
+
+		rec := &catalogRecord{}
+		if json.Unmarshal(line, rec) != nil {
+			return valid, nil
+		}
+		valid += int64(len(line))
+		if rec.Seq > after {
+			c.apply(rec)
+			c.seq = rec.Seq
+			c.records++
+		}
+	}
+}
+
+// snapshot атомарно сохраняет снимок каталога и очищает журнал.
+// Вызывающий должен удерживать мьютекс.
+func (c *Catalog) snapshot() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	var walk func(p string, n *catalogNode) error
+	walk = func(p string, n *catalogNode) error {
+		rec := &catalogRecord{Seq: c.seq, Path: p, Time: n.modTime}
+		if n.isDir() {
+			rec.Op = "mkdir"
+		} else {
+			rec.Op, rec.Blob, rec.Size = "put", n.blob, n.size
+		}
+		if p != "/" {
+			if err := enc.Encode(rec); err != nil {
+				return err
+			}
+		}
+		names := make([]string, 0, len(n.children))
+		for name := range n.children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := walk(path.Join(p, name), n.children[name]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk("/", c.root); err != nil {
+		return err
+	}
+	// Пустой каталог отмечаем записью корня, чтобы сохранить номер последней записи
+	if buf.Len() == 0 {
+		enc.Encode(&catalogRecord{Seq: c.seq, Op: "mkdir", Path: "/"})
+	}
+
+	tmpPath, err := c.s.writeTemp(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := c.s.rename(tmpPath, filepath.Join(c.dir, "snapshot")); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Журнал очищаем только после сохранения снимка: при сбое между этими шагами
+	// записи журнала пропускаются по номеру
+	if err := c.log.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := c.log.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	c.records = 0
+	return nil
+}
+
+// cleanCatalogPath приводит логический путь к виду "/a/b".
+func cleanCatalogPath(op, name string) (string, error) {
+	if strings.ContainsRune(name, 0) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Clean("/" + name), nil
+}
+
+// splitCatalogPath разбивает очищенный путь на элементы.
+func splitCatalogPath(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
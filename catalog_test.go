@@ -0,0 +1,268 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestCatalog(t *testing.T, s *LocalStorage, opts ...CatalogOption) *Catalog {
+	t.Helper()
+
+	c, err := NewCatalog(s, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// catalogPut сохраняет содержимое data по логическому пути name.
+func catalogPut(t *testing.T, c *Catalog, name, data string) *FileInfo {
+	t.Helper()
+
+	fi, err := c.Put(context.Background(), name, strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi
+}
+
+// listNames возвращает имена элементов каталога name; у подкаталогов в конце добавляется "/".
+func listNames(t *testing.T, c *Catalog, name string) string {
+	t.Helper()
+
+	infos, err := c.List(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(infos))
+	for i, info := range infos {
+		names[i] = info.Name()
+		if info.IsDir() {
+			names[i] += "/"
+		}
+	}
+	return strings.Join(names, " ")
+}
+
+func TestCatalog(t *testing.T) {
+	s := newTestStorage(t)
+	c := newTestCatalog(t, s)
+
+	report := catalogPut(t, c, "/tenant/docs/report.pdf", "report")
+	catalogPut(t, c, "tenant/docs/../notes.txt", "notes")
+	if err := c.Mkdir("/tenant/empty/nested"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Link("/tenant/copy.pdf", report.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := listNames(t, c, "/tenant"); got != "copy.pdf docs/ empty/ notes.txt" {
+		t.Fatalf("unexpected listing %q", got)
+	}
+	if blob, err := c.Lookup("/tenant/copy.pdf"); err != nil || blob != report.Name {
+		t.Fatalf("unexpected lookup %q, %v", blob, err)
+	}
+	infos, _ := c.List("/tenant/docs")
+	if infos[0].Size() != report.Size || infos[0].Mode().IsDir() {
+		t.Fatalf("unexpected file info %v", infos[0])
+	}
+
+	cases := []struct {
+		name string
+		fn   func() error
+		err  error
+	}{
+		{name: "Put over directory", fn: func() error { return c.Link("/tenant/docs", report.Name) }, err: ErrIsDir},
+		{name: "Put under file", fn: func() error { return c.Link("/tenant/notes.txt/a", report.Name) }, err: ErrNotDir},
+		{name: "Link missing file", fn: func() error { return c.Link("/missing", strings.Repeat("A", nameLen)) }, err: fs.ErrNotExist},
+		{name: "Mkdir over file", fn: func() error { return c.Mkdir("/tenant/notes.txt") }, err: fs.ErrExist},
+		{name: "Rename missing", fn: func() error { return c.Rename("/missing", "/other") }, err: fs.ErrNotExist},
+		{name: "Rename into itself", fn: func() error { return c.Rename("/tenant", "/tenant/docs/tenant") }, err: fs.ErrInvalid},
+		{name: "Rename over directory", fn: func() error { return c.Rename("/tenant/notes.txt", "/tenant/empty") }, err: fs.ErrExist},
+		{name: "Remove non-empty", fn: func() error { return c.Remove("/tenant/docs") }, err: ErrDirNotEmpty},
+		{name: "Remove root", fn: func() error { return c.RemoveAll("/") }, err: fs.ErrInvalid},
+		{name: "Lookup directory", fn: func() error { _, err := c.Lookup("/tenant"); return err }, err: ErrIsDir},
+		{name: "List file", fn: func() error { _, err := c.List("/tenant/notes.txt"); return err }, err: ErrNotDir},
+	}
+	for _, tc := range cases {
+		if err := tc.fn(); !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.err, err)
+		}
+	}
+
+	// Переименование заменяет существующий файл
+	if err := c.Rename("/tenant/notes.txt", "/tenant/docs/report.pdf"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Move("/tenant/docs", "/archive/2024"); err != nil {
+		t.Fatal(err)
+	}
+	if got := listNames(t, c, "/"); got != "archive/ tenant/" {
+		t.Fatalf("unexpected listing %q", got)
+	}
+	if got := listNames(t, c, "/archive/2024/docs"); got != "report.pdf" {
+		t.Fatalf("unexpected listing %q", got)
+	}
+	if err := c.Remove("/tenant/empty/nested"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveAll("/archive"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RemoveAll("/archive"); err != nil {
+		t.Fatal(err)
+	}
+	if got := listNames(t, c, "/tenant"); got != "copy.pdf empty/" {
+		t.Fatalf("unexpected listing %q", got)
+	}
+}
+
+// Файлы хранилища закреплены, пока на них ссылается хотя бы один логический путь.
+func TestCatalogPins(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	c := newTestCatalog(t, s)
+
+	fi := catalogPut(t, c, "/a.txt", "shared")
+	catalogPut(t, c, "/b.txt", "shared")
+	replaced := catalogPut(t, c, "/c.txt", "replaced")
+	catalogPut(t, c, "/c.txt", "replacement")
+
+	if err := s.Clean(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.IsExists(fi.Name); !ok {
+		t.Fatal("referenced file is removed")
+	}
+	if ok, _ := s.IsExists(replaced.Name); ok {
+		t.Fatal("replaced file is still pinned")
+	}
+
+	if err := c.Remove("/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	s.Clean(ctx, 0)
+	if ok, _ := s.IsExists(fi.Name); !ok {
+		t.Fatal("file referenced by another path is removed")
+	}
+
+	if err := c.Remove("/b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	s.Clean(ctx, 0)
+	if ok, _ := s.IsExists(fi.Name); ok {
+		t.Fatal("unreferenced file is kept")
+	}
+}
+
+// Замена файла тем же содержимым не открепляет его.
+func TestCatalogPutSameContent(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	c := newTestCatalog(t, s)
+
+	catalogPut(t, c, "/a.txt", "same")
+	catalogPut(t, c, "/a.txt", "same")
+	catalogPut(t, c, "/b.txt", "same")
+	if err := c.Rename("/b.txt", "/a.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Clean(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	f, err := c.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+// Закрепление снимается, если связь не записана в журнал.
+func TestCatalogLinkFailure(t *testing.T) {
+	s := newTestStorage(t)
+	c := newTestCatalog(t, s)
+
+	fi := createBlob(t, s, []byte("data"))
+	c.Close()
+	if err := c.Link("/a.txt", fi.Name); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("expected os.ErrClosed, got %v", err)
+	}
+	pins, err := s.ListPins(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 0 {
+		t.Fatalf("unexpected pins: %+v", pins)
+	}
+}
+
+func TestCatalogPersistence(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	c, err := NewCatalog(s, WithSnapshotInterval(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalogPut(t, c, "/a/1.txt", "one")
+	catalogPut(t, c, "/a/2.txt", "two")
+	c.Mkdir("/b")
+	catalogPut(t, c, "/b/3.txt", "three") // после снимка
+	c.Rename("/a/1.txt", "/b/1.txt")
+
+	// Сбой: журнал не закрыт, последняя запись дописана не полностью
+	c.log.Close()
+	logPath := filepath.Join(dir, catalogDir, "log")
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":99,"op":"remove","pa`)
+	f.Close()
+
+	c = newTestCatalog(t, s, WithSnapshotInterval(3))
+	want := map[string]string{"/": "a/ b/", "/a": "2.txt", "/b": "1.txt 3.txt"}
+	for p, names := range want {
+		if got := listNames(t, c, p); got != names {
+			t.Fatalf("%s: expected %q, got %q", p, names, got)
+		}
+	}
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), `"seq":99`) {
+		t.Fatal("torn record is not truncated")
+	}
+
+	// После восстановления журнал продолжает дописываться
+	if err := c.Remove("/a/2.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Mkdir("/closed"); !errors.Is(err, os.ErrClosed) {
+		t.Fatalf("expected os.ErrClosed, got %v", err)
+	}
+
+	c = newTestCatalog(t, s)
+	want["/a"] = ""
+	for p, names := range want {
+		if got := listNames(t, c, p); got != names {
+			t.Fatalf("%s: expected %q, got %q", p, names, got)
+		}
+	}
+}
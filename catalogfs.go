@@ -0,0 +1,164 @@
+package filestore
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"path"
+	"time"
+)
+
+// Убеждаемся в том, что мы всегда реализуем интерфейсы fs.FS.
+var (
+	_ fs.FS        = (*Catalog)(nil)
+	_ fs.StatFS    = (*Catalog)(nil)
+	_ fs.ReadDirFS = (*Catalog)(nil)
+)
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс http.FileSystem.
+var _ http.FileSystem = catalogHTTP{}
+
+// Open реализует метод fs.FS. Пути задаются без начальной косой черты, корень — ".".
+func (c *Catalog) Open(name string) (fs.File, error) {
+	return c.open("open", name)
+}
+
+// Stat реализует метод fs.StatFS.
+func (c *Catalog) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	n, err := c.find(catalogPath(name))
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+	return n.info(path.Base(name)), nil
+}
+
+// ReadDir реализует метод fs.ReadDirFS.
+func (c *Catalog) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	infos, err := c.List(catalogPath(name))
+	if err != nil {
+		return nil, err
+	}
+	return dirEntries(infos), nil
+}
+
+// HTTPFileSystem возвращает представление каталога в виде http.FileSystem,
+// например для http.FileServer.
+func (c *Catalog) HTTPFileSystem() http.FileSystem {
+	return catalogHTTP{c}
+}
+
+// catalogHTTP реализует http.FileSystem поверх каталога.
+type catalogHTTP struct {
+	c *Catalog
+}
+
+// Open реализует метод http.FileSystem.
+func (h catalogHTTP) Open(name string) (http.File, error) {
+	p, err := cleanCatalogPath("open", name)
+	if err != nil {
+		return nil, err
+	}
+	fsName := "."
+	if p != "/" {
+		fsName = p[1:]
+	}
+
+	f, err := h.c.open("open", fsName)
+	if err != nil {
+		return nil, err
+	}
+	return f.(http.File), nil
+}
+
+// open открывает файл или каталог по пути name в формате fs.FS.
+func (c *Catalog) open(op, name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	c.mu.RLock()
+	n, err := c.find(catalogPath(name))
+	if err != nil {
+		c.mu.RUnlock()
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	info := n.info(path.Base(name))
+	var entries []fs.DirEntry
+	if n.isDir() {
+		entries = dirEntries(n.list())
+	}
+	blob := n.blob
+	c.mu.RUnlock()
+
+	if info.IsDir() {
+		return &dirFile{info: info, entries: entries}, nil
+	}
+
+	f, err := c.s.Open(blob)
+	if err != nil {
+		var pe *fs.PathError
+		if errors.As(err, &pe) {
+			pe.Op, pe.Path = op, name
+		}
+		return nil, err
+	}
+	return &catalogFile{File: f, info: info}, nil
+}
+
+// catalogPath преобразует путь в формате fs.FS в логический путь каталога.
+func catalogPath(name string) string {
+	if name == "." {
+		return "/"
+	}
+	return "/" + name
+}
+
+// info возвращает сведения об элементе каталога с именем name.
+func (n *catalogNode) info(name string) fs.FileInfo {
+	return &catalogInfo{name: name, size: n.size, modTime: n.modTime, dir: n.isDir()}
+}
+
+// catalogInfo реализует fs.FileInfo для элементов каталога.
+type catalogInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (fi *catalogInfo) Name() string       { return fi.name }
+func (fi *catalogInfo) Size() int64        { return fi.size }
+func (fi *catalogInfo) ModTime() time.Time { return fi.modTime }
+func (fi *catalogInfo) IsDir() bool        { return fi.dir }
+func (fi *catalogInfo) Sys() any           { return nil }
+
+func (fi *catalogInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// catalogFile описывает открытый логический файл.
+type catalogFile struct {
+	File
+	info fs.FileInfo
+}
+
+// Stat возвращает сведения о логическом файле, а не о файле хранилища.
+func (f *catalogFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// Readdir реализует метод http.File. Для файлов всегда возвращает ошибку.
+func (f *catalogFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.info.Name(), Err: ErrNotDir}
+}
@@ -0,0 +1,631 @@
+package filestore
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// каталог со счётчиками ссылок на фрагменты
+const refsDir = "~refs"
+
+// длина имени файла хранилища (base32 от CRC32 и MD5)
+const nameLen = 32
+
+// manifestMagic начинает каждый манифест фрагментированного файла.
+var manifestMagic = [8]byte{'F', 'S', 'C', 'D', 'C', 'M', 'F', 0x01}
+
+// ErrInUse возвращается при попытке удалить фрагмент, на который ссылаются другие файлы.
+var ErrInUse = errors.New("file is referenced by chunked files")
+
+// ChunkingPolicy задаёт размеры фрагментов при разбиении файлов алгоритмом FastCDC.
+type ChunkingPolicy struct {
+	MinSize int // минимальный размер фрагмента
+	AvgSize int // средний размер фрагмента, округляется до степени двойки
+	MaxSize int // максимальный размер фрагмента; файлы не больше него не разбиваются
+}
+
+// DefaultChunkingPolicy размеры фрагментов по умолчанию.
+var DefaultChunkingPolicy = ChunkingPolicy{
+	MinSize: 256 << 10,
+	AvgSize: 1 << 20,
+	MaxSize: 4 << 20,
+}
+
+// WithChunking включает разбиение больших файлов на фрагменты по содержимому.
+// Фрагменты хранятся как обычные файлы и дедуплицируются между разными файлами,
+// а под именем самого файла сохраняется манифест со списком фрагментов.
+func WithChunking(policy ChunkingPolicy) LocalStorageOption {
+	return func(s *LocalStorage) {
+		if policy.AvgSize <= 0 {
+			policy.AvgSize = DefaultChunkingPolicy.AvgSize
+		}
+		if policy.MinSize <= 0 {
+			policy.MinSize = policy.AvgSize / 4
+		}
+		if policy.MaxSize <= 0 {
+			policy.MaxSize = policy.AvgSize * 4
+		}
+		policy.MinSize = min(policy.MinSize, policy.AvgSize)
+		policy.MaxSize = max(policy.MaxSize, policy.AvgSize)
+		s.chunking = &policy
+	}
+}
+
+// gearTable таблица случайных значений для скользящего хеша. Значения детерминированы,
+// иначе одинаковое содержимое разбивалось бы на разные фрагменты.
+var gearTable = func() (t [256]uint64) {
+	seed := uint64(0x9e3779b97f4a7c15)
+	for i := range t {
+		// splitmix64
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}()
+
+// chunker разбивает поток на фрагменты алгоритмом FastCDC с нормализацией размера.
+type chunker struct {
+	br           *bufio.Reader
+	min, avg     int
+	max          int
+	maskS, maskL uint64
+}
+
+func newChunker(r io.Reader, policy *ChunkingPolicy) *chunker {
+	bits := 0
+	for 1<<(bits+1) <= policy.AvgSize {
+		bits++
+	}
+	return &chunker{
+		br:  bufio.NewReaderSize(r, policy.MaxSize),
+		min: policy.MinSize,
+		avg: policy.AvgSize,
+		max: policy.MaxSize,
+		// Используются старшие биты хеша: они зависят от последних 64 байт, а не от нескольких
+		maskS: ^uint64(0) << (64 - (bits + 1)),
+		maskL: ^uint64(0) << (64 - (bits - 1)),
+	}
+}
+
+// next возвращает следующий фрагмент.
+func (c *chunker) next() ([]byte, error) {
+	data, err := c.br.Peek(c.max)
+	if len(data) == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	data = data[:c.cut(data)]
+	chunk := bytes.Clone(data)
+	c.br.Discard(len(data))
+	return chunk, nil
+}
+
+// cut возвращает длину очередного фрагмента в data.
+func (c *chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.min {
+		return n
+	}
+
+	normal := min(c.avg, n)
+	var fp uint64
+	i := c.min
+	for ; i < normal; i++ {
+		fp = fp<<1 + gearTable[data[i]]
+		if fp&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = fp<<1 + gearTable[data[i]]
+		if fp&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// chunkRef описывает фрагмент в манифесте.
+type chunkRef struct {
+	name string
+	size int64
+}
+
+// marshalManifest сериализует манифест: magic, размер файла, количество фрагментов и сами фрагменты.
+func marshalManifest(size int64, chunks []chunkRef) []byte {
+	var b bytes.Buffer
+	b.Write(manifestMagic[:])
+	binary.Write(&b, binary.BigEndian, uint64(size))
+	binary.Write(&b, binary.BigEndian, uint32(len(chunks)))
+	for _, c := range chunks {
+		b.WriteString(c.name)
+		binary.Write(&b, binary.BigEndian, uint32(c.size))
+	}
+	return b.Bytes()
+}
+
+// parseManifest разбирает манифест и возвращает список фрагментов и размер файла.
+func parseManifest(r io.ReaderAt, size int64) ([]chunkRef, int64, error) {
+	data := make([]byte, size)
+	if n, err := r.ReadAt(data, 0); n != len(data) {
+		return nil, 0, fmt.Errorf("invalid manifest: %v", err)
+	}
+
+	const fixed = len(manifestMagic) + 8 + 4
+	if len(data) < fixed || !bytes.Equal(data[:len(manifestMagic)], manifestMagic[:]) {
+		return nil, 0, errors.New("invalid manifest")
+	}
+
+	total := int64(binary.BigEndian.Uint64(data[len(manifestMagic):]))
+	count := int(binary.BigEndian.Uint32(data[len(manifestMagic)+8:]))
+	if len(data) != fixed+count*(nameLen+4) {
+		return nil, 0, errors.New("invalid manifest")
+	}
+
+	chunks := make([]chunkRef, count)
+	var sum int64
+	for i := range chunks {
+		entry := data[fixed+i*(nameLen+4):]
+		chunks[i] = chunkRef{
+			name: string(entry[:nameLen]),
+			size: int64(binary.BigEndian.Uint32(entry[nameLen:])),
+		}
+		sum += chunks[i].size
+	}
+	if sum != total {
+		return nil, 0, errors.New("invalid manifest: size mismatch")
+	}
+
+	return chunks, total, nil
+}
+
+// storeChunked разбивает временный файл path на фрагменты, сохраняет их и записывает
+// манифест в fullPath. Счётчики ссылок увеличиваются до записи манифеста, поэтому
+// прерванное сохранение может лишь оставить лишние ссылки, но не потерять нужные.
+func (s *LocalStorage) storeChunked(path string, fi *FileInfo, fullPath string) error {
+	mu := s.getMutex(fi.Name)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		s.releaseMutex(fi.Name)
+	}()
+
+	// Файл мог быть сохранён параллельно
+	if info, err := os.Stat(fullPath); err == nil && info.Size() > 0 {
+		return nil
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var chunks []chunkRef
+	c := newChunker(src, s.chunking)
+	for {
+		data, err := c.next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			var name string
+			if name, err = s.storeChunk(data, fi.Mimetype); err == nil {
+				chunks = append(chunks, chunkRef{name: name, size: int64(len(data))})
+				continue
+			}
+		}
+
+		// Освобождаем уже сохранённые фрагменты
+		for _, ref := range chunks {
+			s.releaseChunk(ref.name)
+		}
+		return err
+	}
+
+	manifest := marshalManifest(fi.Size, chunks)
+	var tmpPath string
+	enc := blobEncoding{Encrypted: s.keys != nil, Chunked: true}
+	if enc.Encrypted {
+		tmpPath, err = s.encrypt(bytes.NewReader(manifest))
+	} else {
+		tmpPath, err = s.writeTemp(manifest)
+	}
+	if err == nil {
+		if err = s.setEncoding(fi.Name, enc); err == nil {
+			err = s.rename(tmpPath, fullPath)
+		}
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}
+	if err != nil {
+		for _, ref := range chunks {
+			s.releaseChunk(ref.name)
+		}
+		return err
+	}
+	return nil
+}
+
+// storeChunk сохраняет фрагмент, если он ещё не сохранён, и увеличивает счётчик ссылок на него.
+func (s *LocalStorage) storeChunk(data []byte, mimetype string) (string, error) {
+	hashCRC32, hashMD5 := crc32.NewIEEE(), md5.New()
+	hashCRC32.Write(data)
+	hashMD5.Write(data)
+	name := base32.StdEncoding.EncodeToString(append(hashCRC32.Sum(nil), hashMD5.Sum(nil)...))
+
+	mu := s.getMutex(name)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		s.releaseMutex(name)
+	}()
+
+	fullPath, err := s.GetFullPath(name)
+	if err != nil {
+		return "", err
+	}
+
+	// Пустой файл фрагмента — след прерванной записи, перезаписываем его
+	if info, err := os.Stat(fullPath); errors.Is(err, os.ErrNotExist) || (err == nil && info.Size() == 0) {
+		tmpPath, err := s.writeTemp(data)
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(tmpPath)
+
+		src, enc, err := s.encode(tmpPath, &FileInfo{Mimetype: mimetype, Size: int64(len(data))})
+		if err != nil {
+			return "", err
+		}
+		if src != tmpPath {
+			defer os.Remove(src)
+		}
+
+		if err := os.MkdirAll(filepath.Dir(fullPath), s.perm); err != nil {
+			return "", err
+		}
+		m, err := s.readMeta(name)
+		if err != nil {
+			return "", err
+		}
+		m.blobEncoding, m.Chunk = enc, true
+		if err := s.writeMeta(name, m); err != nil {
+			return "", err
+		}
+		if err := s.rename(src, fullPath); err != nil {
+			return "", err
+		}
+	} else if err != nil {
+		return "", err
+	}
+
+	if _, err := s.addRef(name, 1); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// releaseChunk уменьшает счётчик ссылок на фрагмент и удаляет фрагмент, если ссылок не осталось.
+// Файл, который сохранён и самостоятельно, закреплён, находится на удержании или учтён
+// в квоте пространства имён, остаётся в хранилище как обычный файл.
+func (s *LocalStorage) releaseChunk(name string) error {
+	mu := s.getMutex(name)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		s.releaseMutex(name)
+	}()
+
+	refs, err := s.addRef(name, -1)
+	if err != nil || refs > 0 {
+		return err
+	}
+
+	m, err := s.readMeta(name)
+	if err != nil || !m.Chunk || m.protected() || len(m.Namespaces) > 0 {
+		return err
+	}
+
+	fullPath, err := s.GetFullPath(name)
+	if err != nil {
+		return err
+	}
+	if err := s.removeBlob(name, fullPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// adopt снимает с файла name отметку фрагмента: файл сохранён самостоятельно
+// и не должен удаляться вместе с последней ссылкой на него.
+func (s *LocalStorage) adopt(name string) error {
+	mu := s.getMutex(name)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		s.releaseMutex(name)
+	}()
+
+	m, err := s.readMeta(name)
+	if err != nil || !m.Chunk {
+		return err
+	}
+	m.Chunk = false
+	return s.writeMeta(name, m)
+}
+
+// refPath возвращает путь к файлу со счётчиком ссылок на фрагмент.
+func (s *LocalStorage) refPath(name string) (string, error) {
+	relPath := s.GetRelativePath(name)
+	if relPath == "" {
+		return "", fmt.Errorf("%w: %s", ErrInvalidName, name)
+	}
+	return s.safePath(filepath.Join(refsDir, relPath))
+}
+
+// refs возвращает количество манифестов, ссылающихся на фрагмент.
+func (s *LocalStorage) refs(name string) (int, error) {
+	path, err := s.refPath(name)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// addRef изменяет счётчик ссылок на фрагмент и возвращает новое значение.
+// Вызывающий должен удерживать мьютекс имени фрагмента.
+func (s *LocalStorage) addRef(name string, delta int) (int, error) {
+	refs, err := s.refs(name)
+	if err != nil {
+		return 0, err
+	}
+	refs += delta
+
+	path, err := s.refPath(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if refs <= 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return 0, err
+		}
+		s.removeEmptyParents(path)
+		return 0, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), s.perm); err != nil {
+		return 0, err
+	}
+	tmpPath, err := s.writeTemp([]byte(strconv.Itoa(refs)))
+	if err != nil {
+		return 0, err
+	}
+	if err := s.rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return 0, err
+	}
+	return refs, nil
+}
+
+// writeTemp записывает данные во временный файл и возвращает путь к нему.
+func (s *LocalStorage) writeTemp(data []byte) (string, error) {
+	tmpfile, err := os.CreateTemp(s.rootDir, "~tmp")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmpfile.Write(data); err != nil {
+		tmpfile.Close()
+		os.Remove(tmpfile.Name())
+		return "", err
+	}
+	if err := tmpfile.Close(); err != nil {
+		os.Remove(tmpfile.Name())
+		return "", err
+	}
+	return tmpfile.Name(), nil
+}
+
+// manifestChunks возвращает фрагменты, на которые ссылается файл name. Для файлов, которые
+// хранилище не сохраняло в виде манифеста, возвращает nil независимо от их содержимого.
+func (s *LocalStorage) manifestChunks(name, fullPath string) ([]chunkRef, error) {
+	m, err := s.readMeta(name)
+	if err != nil || !m.Chunked {
+		return nil, err
+	}
+
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	r, size, err := s.decrypt(file, info, m.blobEncoding)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, _, err := parseManifest(r, size)
+	return chunks, err
+}
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс io.ReaderAt.
+var _ io.ReaderAt = (*manifestReader)(nil)
+
+// manifestReader собирает содержимое фрагментированного файла из фрагментов.
+type manifestReader struct {
+	s       *LocalStorage
+	chunks  []chunkRef
+	offsets []int64 // смещения начала фрагментов; последний элемент — размер файла
+
+	mu     sync.Mutex
+	curIdx int
+	cur    File
+}
+
+// openManifest разбирает манифест и возвращает reader содержимого файла.
+func (s *LocalStorage) openManifest(r io.ReaderAt, size int64) (*manifestReader, error) {
+	chunks, _, err := parseManifest(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	offsets := make([]int64, len(chunks)+1)
+	for i, c := range chunks {
+		offsets[i+1] = offsets[i] + c.size
+	}
+
+	return &manifestReader{s: s, chunks: chunks, offsets: offsets, curIdx: -1}, nil
+}
+
+// Size возвращает размер файла.
+func (m *manifestReader) Size() int64 { return m.offsets[len(m.offsets)-1] }
+
+// ReadAt реализует метод io.ReaderAt.
+func (m *manifestReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if off >= m.Size() {
+			return n, io.EOF
+		}
+
+		// Находим фрагмент, содержащий смещение off
+		idx := sort.Search(len(m.chunks), func(i int) bool { return m.offsets[i+1] > off })
+		if err := m.open(idx); err != nil {
+			return n, err
+		}
+
+		want := int(min(int64(len(p)-n), m.offsets[idx+1]-off))
+		c, err := m.cur.ReadAt(p[n:n+want], off-m.offsets[idx])
+		n += c
+		off += int64(c)
+		if c < want {
+			if err == nil || err == io.EOF {
+				err = fmt.Errorf("chunk %s is truncated", m.chunks[idx].name)
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// open открывает фрагмент idx, закрывая предыдущий.
+func (m *manifestReader) open(idx int) error {
+	if idx == m.curIdx {
+		return nil
+	}
+	if m.cur != nil {
+		m.cur.Close()
+		m.cur, m.curIdx = nil, -1
+	}
+
+	f, err := m.s.openChunk(m.chunks[idx].name)
+	if err != nil {
+		return err
+	}
+	m.cur, m.curIdx = f, idx
+	return nil
+}
+
+// Close закрывает открытый фрагмент.
+func (m *manifestReader) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cur == nil {
+		return nil
+	}
+	err := m.cur.Close()
+	m.cur, m.curIdx = nil, -1
+	return err
+}
+
+// hasChunk проверяет наличие фрагмента. В отличие от IsExists, не учитывает срок хранения:
+// фрагмент, на который ссылается манифест, доступен и после истечения срока.
+func (s *LocalStorage) hasChunk(name string) bool {
+	fullPath, err := s.GetFullPath(name)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(fullPath)
+	return err == nil
+}
+
+// openChunk открывает фрагмент. В отличие от Open, не обновляет время доступа
+// и не интерпретирует содержимое как манифест.
+func (s *LocalStorage) openChunk(name string) (File, error) {
+	fullPath, err := s.GetFullPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := s.readMeta(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return nil, s.wrapPathError(err, name)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, s.wrapPathError(err, name)
+	}
+
+	r, size, err := s.decrypt(file, info, m.blobEncoding)
+	if err == nil {
+		var f File
+		if f, err = s.decompress(file, info, r, size, m.blobEncoding); err == nil {
+			return f, nil
+		}
+	}
+	file.Close()
+	return nil, s.wrapPathError(err, name)
+}
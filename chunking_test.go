@@ -0,0 +1,197 @@
+package filestore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+var testChunkingPolicy = ChunkingPolicy{MinSize: 1 << 10, AvgSize: 4 << 10, MaxSize: 16 << 10}
+
+// chunkNames возвращает имена фрагментов файла name.
+func chunkNames(t *testing.T, s *LocalStorage, name string) []string {
+	t.Helper()
+
+	fullPath, err := s.GetFullPath(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := s.manifestChunks(name, fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(chunks))
+	for i, c := range chunks {
+		names[i] = c.name
+	}
+	return names
+}
+
+func TestChunking(t *testing.T) {
+	cases := []struct {
+		name string
+		opts []LocalStorageOption
+	}{
+		{name: "Plain", opts: nil},
+		{name: "Encrypted", opts: []LocalStorageOption{WithEncryption(newTestKeyring(t, "k1"))}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestStorage(t, append(tc.opts, WithChunking(testChunkingPolicy))...)
+
+			// Два файла с общим началом делят фрагменты
+			shared := make([]byte, 100<<10)
+			rand.Read(shared)
+			a := append(bytes.Clone(shared), "tail a"...)
+			b := append(bytes.Clone(shared), "another tail b"...)
+			fa := createBlob(t, s, a)
+			fb := createBlob(t, s, b)
+
+			chunksA, chunksB := chunkNames(t, s, fa.Name), chunkNames(t, s, fb.Name)
+			if len(chunksA) < 2 {
+				t.Fatalf("expected several chunks, got %d", len(chunksA))
+			}
+			common := 0
+			for i := range min(len(chunksA), len(chunksB)) {
+				if chunksA[i] == chunksB[i] {
+					common++
+				}
+			}
+			if common == 0 {
+				t.Fatal("files share no chunks")
+			}
+
+			// Маленький файл не разбивается
+			small := createBlob(t, s, []byte("small"))
+			if chunks := chunkNames(t, s, small.Name); len(chunks) != 0 {
+				t.Fatalf("small file is chunked: %v", chunks)
+			}
+
+			f, err := s.Open(fa.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			info, _ := f.Stat()
+			if info.Size() != int64(len(a)) {
+				t.Fatalf("expected size %d, got %d", len(a), info.Size())
+			}
+			off := int64(len(a) - 30000)
+			if _, err := f.Seek(off, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(f)
+			f.Close()
+			if err != nil || !bytes.Equal(got, a[off:]) {
+				t.Fatalf("ranged read mismatch: %v", err)
+			}
+			if !bytes.Equal(readBlob(t, s, fb.Name), b) {
+				t.Fatal("data mismatch")
+			}
+
+			// Фрагмент, на который ссылается манифест, нельзя удалить
+			if err := s.Remove(chunksA[0]); !errors.Is(err, ErrInUse) {
+				t.Fatalf("expected ErrInUse, got %v", err)
+			}
+
+			// Общие фрагменты удаляются вместе с последним ссылающимся файлом
+			if err := s.Remove(fa.Name); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(readBlob(t, s, fb.Name), b) {
+				t.Fatal("data mismatch after removing a file with shared chunks")
+			}
+			if err := s.Remove(fb.Name); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range append(chunksA, chunksB...) {
+				if s.hasChunk(name) {
+					t.Fatalf("chunk %s is left", name)
+				}
+			}
+		})
+	}
+}
+
+// Пользовательский файл, совпадающий по формату с манифестом, не должен давать доступ
+// к чужим файлам и освобождать их при удалении.
+func TestChunkingFakeManifest(t *testing.T) {
+	s := newTestStorage(t, WithChunking(testChunkingPolicy))
+
+	secret := []byte("victim's secret data")
+	victim := createBlob(t, s, secret)
+
+	fake := marshalManifest(int64(len(secret)), []chunkRef{{name: victim.Name, size: int64(len(secret))}})
+	attacker := createBlob(t, s, fake)
+
+	// Чтение через поддельный манифест
+	if got := readBlob(t, s, attacker.Name); !bytes.Equal(got, fake) {
+		t.Fatalf("fake manifest is interpreted: got %q", got)
+	}
+
+	// Удаление поддельного манифеста
+	if err := s.Remove(attacker.Name); err != nil {
+		t.Fatal(err)
+	}
+	if got := readBlob(t, s, victim.Name); !bytes.Equal(got, secret) {
+		t.Fatalf("victim file is damaged: got %q", got)
+	}
+}
+
+// Содержимое, сохранённое и самостоятельно, и как фрагмент, не удаляется вместе
+// с последним ссылающимся на него манифестом.
+func TestChunkStoredStandalone(t *testing.T) {
+	data := make([]byte, 100<<10)
+	rand.Read(data)
+	first, err := newChunker(bytes.NewReader(data), &testChunkingPolicy).next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("HoldBefore", func(t *testing.T) {
+		s := newTestStorage(t, WithChunking(testChunkingPolicy))
+
+		standalone := createBlob(t, s, first)
+		if err := s.PlaceHold(standalone.Name, "case-1"); err != nil {
+			t.Fatal(err)
+		}
+		chunked := createBlob(t, s, data)
+		chunks := chunkNames(t, s, chunked.Name)
+		if chunks[0] != standalone.Name {
+			t.Fatalf("expected first chunk %s, got %s", standalone.Name, chunks[0])
+		}
+
+		if err := s.Remove(chunked.Name); err != nil {
+			t.Fatal(err)
+		}
+		if got := readBlob(t, s, standalone.Name); !bytes.Equal(got, first) {
+			t.Fatal("standalone file on hold is removed with the chunked file")
+		}
+		for _, name := range chunks[1:] {
+			if s.hasChunk(name) {
+				t.Fatalf("chunk %s is left", name)
+			}
+		}
+	})
+
+	t.Run("StoredAfter", func(t *testing.T) {
+		s := newTestStorage(t, WithChunking(testChunkingPolicy))
+
+		chunked := createBlob(t, s, data)
+		standalone := createBlob(t, s, first)
+		if chunks := chunkNames(t, s, chunked.Name); chunks[0] != standalone.Name {
+			t.Fatalf("expected first chunk %s, got %s", standalone.Name, chunks[0])
+		}
+
+		if err := s.Remove(chunked.Name); err != nil {
+			t.Fatal(err)
+		}
+		if got := readBlob(t, s, standalone.Name); !bytes.Equal(got, first) {
+			t.Fatal("standalone file is removed with the chunked file")
+		}
+		if err := s.Remove(standalone.Name); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+// Команда filestore-rotate перешифровывает локальное хранилище текущим мастер-ключом.
+//
+// Использование:
+//
+//	filestore-rotate -root /var/lib/filestore -keyring /etc/filestore/keyring.json [-new-key 2026-10]
+//
+// С флагом -new-key в файл ключей добавляется новый случайный ключ, который становится текущим.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/tenrok/filestore"
+	"github.com/tenrok/filestore/encryption"
+)
+
+func main() {
+	rootDir := flag.String("root", "", "корневой каталог хранилища")
+	keyringPath := flag.String("keyring", "", "файл с мастер-ключами")
+	newKey := flag.String("new-key", "", "идентификатор нового мастер-ключа")
+	flag.Parse()
+
+	if *rootDir == "" || *keyringPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	keyring, err := encryption.LoadKeyring(*keyringPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *newKey != "" {
+		if err := keyring.GenerateKey(*newKey); err != nil {
+			log.Fatal(err)
+		}
+		if err := keyring.Save(*keyringPath); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("new current key: %s", *newKey)
+	}
+
+	storage, err := filestore.NewLocalStorage(*rootDir, filestore.WithEncryption(keyring))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	rotated, err := storage.RotateKeys(ctx)
+	log.Printf("rotated %d files", rotated)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,110 @@
+package filestore
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tenrok/filestore/compression"
+)
+
+// DefaultCompressibleMimetypes типы содержимого, которые сжимаются, если в политике они не заданы.
+// Значение, оканчивающееся на "/", задаёт префикс типа.
+var DefaultCompressibleMimetypes = []string{
+	"text/",
+	"application/json",
+	"application/xml",
+	"application/javascript",
+	"application/x-javascript",
+	"image/svg+xml",
+}
+
+// CompressionPolicy описывает, какие файлы и каким алгоритмом сжимаются при сохранении.
+type CompressionPolicy struct {
+	Codec     compression.Codec // алгоритм сжатия, зарегистрированный функцией compression.Register; nil — gzip
+	BlockSize int               // размер блока; 0 — compression.DefaultBlockSize
+	MinSize   int64             // минимальный размер файла, начиная с которого он сжимается
+	Mimetypes []string          // сжимаемые типы; nil — DefaultCompressibleMimetypes
+}
+
+// WithCompression включает прозрачное сжатие файлов согласно политике. Имена файлов
+// вычисляются по исходному содержимому, а Open возвращает распакованные данные.
+// Если алгоритм сжатия не зарегистрирован, NewLocalStorage возвращает ошибку.
+func WithCompression(policy CompressionPolicy) LocalStorageOption {
+	return func(s *LocalStorage) {
+		if policy.Codec == nil {
+			policy.Codec = compression.Gzip
+		}
+		if policy.BlockSize <= 0 {
+			policy.BlockSize = compression.DefaultBlockSize
+		}
+		if policy.Mimetypes == nil {
+			policy.Mimetypes = DefaultCompressibleMimetypes
+		}
+		s.compression = &policy
+	}
+}
+
+// validate проверяет, что сжатые файлы можно будет прочитать: при чтении алгоритм
+// определяется по имени, записанному в сжатом потоке.
+func (p *CompressionPolicy) validate() error {
+	if _, err := compression.Lookup(p.Codec.Name()); err != nil {
+		return fmt.Errorf("compression policy: %w", err)
+	}
+	return nil
+}
+
+// match проверяет, нужно ли сжимать файл.
+func (p *CompressionPolicy) match(fi *FileInfo) bool {
+	if fi.Size == 0 || fi.Size < p.MinSize {
+		return false
+	}
+
+	mimetype, _, _ := strings.Cut(fi.Mimetype, ";")
+	mimetype = strings.TrimSpace(mimetype)
+	for _, m := range p.Mimetypes {
+		if (strings.HasSuffix(m, "/") && strings.HasPrefix(mimetype, m)) || m == mimetype {
+			return true
+		}
+	}
+	return false
+}
+
+// compress сжимает содержимое файла path во временный файл и возвращает путь к нему.
+// Если сжатие не уменьшает размер, возвращает пустую строку.
+func (s *LocalStorage) compress(path string, size int64) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	tmpfile, err := os.CreateTemp(s.rootDir, "~tmp")
+	if err != nil {
+		return "", err
+	}
+
+	compressed, err := func() (int64, error) {
+		w, err := compression.NewWriterSize(tmpfile, s.compression.Codec, s.compression.BlockSize)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := io.Copy(w, src); err != nil {
+			return 0, err
+		}
+		if err := w.Close(); err != nil {
+			return 0, err
+		}
+		return tmpfile.Seek(0, io.SeekCurrent)
+	}()
+	if cerr := tmpfile.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || compressed >= size {
+		os.Remove(tmpfile.Name())
+		return "", err
+	}
+
+	return tmpfile.Name(), nil
+}
@@ -0,0 +1,145 @@
+package filestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/tenrok/filestore/compression"
+)
+
+// compressedMagic сигнатура сжатого потока.
+var compressedMagic = []byte{'F', 'S', 'B', 'L', 'K', 'Z', 0x00, 0x01}
+
+// testCodec алгоритм сжатия, который регистрируется только тестами.
+type testCodec struct {
+	compression.GzipCodec
+	name string
+}
+
+func (c *testCodec) Name() string { return c.name }
+
+var registeredCodec = &testCodec{GzipCodec: compression.GzipCodec{Level: gzip.DefaultCompression}, name: "x-test-registered"}
+
+func init() {
+	compression.Register(registeredCodec)
+}
+
+func TestCompression(t *testing.T) {
+	text := []byte(strings.Repeat("compress me please ", 10000))
+	random := make([]byte, 64<<10)
+	rand.Read(random)
+
+	cases := []struct {
+		name       string
+		policy     CompressionPolicy
+		data       []byte
+		compressed bool
+	}{
+		{name: "Text", policy: CompressionPolicy{}, data: text, compressed: true},
+		{name: "Custom codec", policy: CompressionPolicy{Codec: registeredCodec, BlockSize: 1 << 10}, data: text, compressed: true},
+		{name: "Too small", policy: CompressionPolicy{MinSize: int64(len(text)) + 1}, data: text},
+		{name: "Mimetype mismatch", policy: CompressionPolicy{Mimetypes: []string{"application/json"}}, data: text},
+		{name: "Incompressible", policy: CompressionPolicy{Mimetypes: []string{"application/"}}, data: random},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestStorage(t, WithCompression(tc.policy))
+			fi := createBlob(t, s, tc.data)
+
+			stored := readStored(t, s, fi.Name)
+			if compressed := len(stored) < len(tc.data); compressed != tc.compressed {
+				t.Fatalf("expected compressed %v, stored %d of %d bytes", tc.compressed, len(stored), len(tc.data))
+			}
+			if !tc.compressed && !bytes.Equal(stored, tc.data) {
+				t.Fatal("uncompressed file is stored modified")
+			}
+
+			f, err := s.Open(fi.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			info, err := f.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Size() != int64(len(tc.data)) {
+				t.Fatalf("expected size %d, got %d", len(tc.data), info.Size())
+			}
+
+			off := int64(len(tc.data) / 2)
+			if _, err := f.Seek(off, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tc.data[off:]) {
+				t.Fatal("data mismatch")
+			}
+		})
+	}
+}
+
+// Пользовательский файл, который сам является сжатым потоком, должен читаться как есть.
+func TestCompressionUserStream(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := compression.NewWriter(&buf, compression.Gzip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "hello")
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	cases := []struct {
+		name string
+		opts []LocalStorageOption
+	}{
+		{name: "Plain storage", opts: nil},
+		{name: "Compressed storage", opts: []LocalStorageOption{WithCompression(CompressionPolicy{Mimetypes: []string{"application/"}})}},
+		{name: "Encrypted storage", opts: []LocalStorageOption{WithEncryption(newTestKeyring(t, "k1"))}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestStorage(t, tc.opts...)
+			fi := createBlob(t, s, data)
+			if got := readBlob(t, s, fi.Name); !bytes.Equal(got, data) {
+				t.Fatalf("expected the stream itself (%d bytes), got %q", len(data), got)
+			}
+			if _, err := s.OpenEncoded(fi.Name, "gzip"); !errors.Is(err, ErrNotEncoded) {
+				t.Fatalf("expected ErrNotEncoded, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCompressionUnregisteredCodec(t *testing.T) {
+	policy := CompressionPolicy{Codec: &testCodec{name: "x-test-unregistered"}}
+	if _, err := NewLocalStorage(t.TempDir(), WithCompression(policy)); !errors.Is(err, compression.ErrUnknownCodec) {
+		t.Fatalf("expected ErrUnknownCodec, got %v", err)
+	}
+}
+
+func TestCompressionWithEncryption(t *testing.T) {
+	s := newTestStorage(t, WithCompression(CompressionPolicy{}), WithEncryption(newTestKeyring(t, "k1")))
+	data := []byte(strings.Repeat("compressed and encrypted ", 1000))
+	fi := createBlob(t, s, data)
+
+	stored := readStored(t, s, fi.Name)
+	if !bytes.HasPrefix(stored, encryptedMagic) || len(stored) >= len(data) {
+		t.Fatalf("expected compressed and encrypted file, stored %d of %d bytes", len(stored), len(data))
+	}
+	if got := readBlob(t, s, fi.Name); !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+}
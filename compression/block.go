@@ -0,0 +1,346 @@
+package compression
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	// DefaultBlockSize размер блока исходных данных по умолчанию.
+	DefaultBlockSize = 256 << 10
+
+	// максимальный допустимый размер блока
+	maxBlockSize = 16 << 20
+
+	// размер окончания потока: смещение индекса, количество блоков, исходный размер и magic
+	footerSize int64 = 8 + 4 + 8 + 8
+)
+
+var (
+	// magic начинает каждый сжатый поток.
+	magic = [8]byte{'F', 'S', 'B', 'L', 'K', 'Z', 0x00, 0x01}
+
+	// footerMagic завершает каждый сжатый поток.
+	footerMagic = [8]byte{'F', 'S', 'B', 'L', 'K', 'E', 'N', 'D'}
+)
+
+var (
+	ErrInvalidFormat = errors.New("compression: invalid format")
+	ErrUnknownCodec  = errors.New("compression: unknown codec")
+)
+
+// IsCompressed проверяет, начинаются ли данные с заголовка сжатого потока.
+func IsCompressed(r io.ReaderAt) bool {
+	var b [len(magic)]byte
+	if err := readFullAt(r, b[:], 0); err != nil {
+		return false
+	}
+	return b == magic
+}
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс io.WriteCloser.
+var _ io.WriteCloser = (*Writer)(nil)
+
+// Writer сжимает записываемые данные блоками. Close дописывает индекс, но не закрывает нижележащий поток.
+type Writer struct {
+	w         io.Writer
+	codec     Codec
+	blockSize int
+	buf       []byte
+	out       bytes.Buffer
+	lengths   []uint32
+	written   int64
+	size      int64
+	started   bool
+	closed    bool
+}
+
+// NewWriter создаёт Writer с размером блока по умолчанию.
+func NewWriter(w io.Writer, codec Codec) (*Writer, error) {
+	return NewWriterSize(w, codec, DefaultBlockSize)
+}
+
+// NewWriterSize создаёт Writer с заданным размером блока.
+func NewWriterSize(w io.Writer, codec Codec, blockSize int) (*Writer, error) {
+	if blockSize <= 0 || blockSize > maxBlockSize {
+		return nil, fmt.Errorf("compression: invalid block size %d", blockSize)
+	}
+	if name := codec.Name(); name == "" || len(name) > 255 {
+		return nil, fmt.Errorf("compression: invalid codec name %q", name)
+	}
+
+	return &Writer{
+		w:         w,
+		codec:     codec,
+		blockSize: blockSize,
+		buf:       make([]byte, 0, blockSize),
+	}, nil
+}
+
+// Write реализует метод io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("compression: write to closed writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close реализует метод io.Closer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	if len(w.buf) > 0 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+
+	// Индекс: длины сжатых блоков, затем окончание потока
+	var b bytes.Buffer
+	for _, l := range w.lengths {
+		binary.Write(&b, binary.BigEndian, l)
+	}
+	binary.Write(&b, binary.BigEndian, uint64(w.written))
+	binary.Write(&b, binary.BigEndian, uint32(len(w.lengths)))
+	binary.Write(&b, binary.BigEndian, uint64(w.size))
+	b.Write(footerMagic[:])
+
+	_, err := w.w.Write(b.Bytes())
+	return err
+}
+
+// writeHeader записывает заголовок потока, если он ещё не записан.
+func (w *Writer) writeHeader() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+
+	name := w.codec.Name()
+	var b bytes.Buffer
+	b.Write(magic[:])
+	b.WriteByte(byte(len(name)))
+	b.WriteString(name)
+	binary.Write(&b, binary.BigEndian, uint32(w.blockSize))
+
+	n, err := w.w.Write(b.Bytes())
+	w.written += int64(n)
+	return err
+}
+
+// flush сжимает накопленный блок и записывает его в поток.
+func (w *Writer) flush() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	w.out.Reset()
+	cw, err := w.codec.NewWriter(&w.out)
+	if err != nil {
+		return err
+	}
+	if _, err := cw.Write(w.buf); err != nil {
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return err
+	}
+
+	n, err := w.w.Write(w.out.Bytes())
+	w.written += int64(n)
+	if err != nil {
+		return err
+	}
+
+	w.lengths = append(w.lengths, uint32(w.out.Len()))
+	w.size += int64(len(w.buf))
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс io.ReaderAt.
+var _ io.ReaderAt = (*Reader)(nil)
+
+// Reader распаковывает сжатый поток с произвольным доступом.
+type Reader struct {
+	r         io.ReaderAt
+	codec     Codec
+	blockSize int
+	offsets   []int64 // смещения сжатых блоков; последний элемент — смещение индекса
+	size      int64
+
+	mu       sync.Mutex
+	cacheIdx int
+	cache    []byte
+}
+
+// NewReader создаёт Reader для сжатого потока размера size.
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	fixed := make([]byte, len(magic)+1)
+	if err := readFullAt(r, fixed, 0); err != nil {
+		return nil, ErrInvalidFormat
+	}
+	if !bytes.Equal(fixed[:len(magic)], magic[:]) {
+		return nil, ErrInvalidFormat
+	}
+
+	rest := make([]byte, int(fixed[len(magic)])+4)
+	if err := readFullAt(r, rest, int64(len(fixed))); err != nil {
+		return nil, ErrInvalidFormat
+	}
+	codec, err := Lookup(string(rest[:len(rest)-4]))
+	if err != nil {
+		return nil, err
+	}
+	blockSize := int(binary.BigEndian.Uint32(rest[len(rest)-4:]))
+	if blockSize <= 0 || blockSize > maxBlockSize {
+		return nil, ErrInvalidFormat
+	}
+	headerSize := int64(len(fixed) + len(rest))
+
+	footer := make([]byte, footerSize)
+	if size < headerSize+footerSize {
+		return nil, ErrInvalidFormat
+	}
+	if err := readFullAt(r, footer, size-footerSize); err != nil {
+		return nil, ErrInvalidFormat
+	}
+	if !bytes.Equal(footer[footerSize-int64(len(footerMagic)):], footerMagic[:]) {
+		return nil, ErrInvalidFormat
+	}
+	indexOffset := int64(binary.BigEndian.Uint64(footer))
+	blocks := int64(binary.BigEndian.Uint32(footer[8:]))
+	logicalSize := int64(binary.BigEndian.Uint64(footer[12:]))
+
+	if indexOffset < headerSize || indexOffset+blocks*4 != size-footerSize ||
+		logicalSize < 0 || (logicalSize+int64(blockSize)-1)/int64(blockSize) != blocks {
+		return nil, ErrInvalidFormat
+	}
+
+	index := make([]byte, blocks*4)
+	if err := readFullAt(r, index, indexOffset); err != nil {
+		return nil, ErrInvalidFormat
+	}
+
+	offsets := make([]int64, blocks+1)
+	offsets[0] = headerSize
+	for i := range blocks {
+		offsets[i+1] = offsets[i] + int64(binary.BigEndian.Uint32(index[i*4:]))
+	}
+	if offsets[blocks] != indexOffset {
+		return nil, ErrInvalidFormat
+	}
+
+	return &Reader{
+		r:         r,
+		codec:     codec,
+		blockSize: blockSize,
+		offsets:   offsets,
+		size:      logicalSize,
+		cacheIdx:  -1,
+	}, nil
+}
+
+// Size возвращает размер исходных данных.
+func (r *Reader) Size() int64 { return r.size }
+
+// Codec возвращает алгоритм сжатия потока.
+func (r *Reader) Codec() Codec { return r.codec }
+
+// Payload возвращает последовательность сжатых блоков без заголовка и индекса.
+// Для gzip это корректный многочленный поток gzip, который можно отдавать клиенту как есть.
+func (r *Reader) Payload() *io.SectionReader {
+	return io.NewSectionReader(r.r, r.offsets[0], r.offsets[len(r.offsets)-1]-r.offsets[0])
+}
+
+// ReadAt реализует метод io.ReaderAt.
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("compression: negative offset")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+
+		idx := int(off / int64(r.blockSize))
+		block, err := r.block(idx)
+		if err != nil {
+			return n, err
+		}
+
+		c := copy(p[n:], block[off-int64(idx)*int64(r.blockSize):])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+// block возвращает распакованный блок idx. Последний распакованный блок кешируется.
+func (r *Reader) block(idx int) ([]byte, error) {
+	if idx == r.cacheIdx {
+		return r.cache, nil
+	}
+	r.cacheIdx = -1
+
+	length := min(int64(r.blockSize), r.size-int64(idx)*int64(r.blockSize))
+	if int64(cap(r.cache)) < length {
+		r.cache = make([]byte, r.blockSize)
+	}
+	r.cache = r.cache[:length]
+
+	src := io.NewSectionReader(r.r, r.offsets[idx], r.offsets[idx+1]-r.offsets[idx])
+	cr, err := r.codec.NewReader(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: block %d: %v", ErrInvalidFormat, idx, err)
+	}
+	defer cr.Close()
+
+	if _, err := io.ReadFull(cr, r.cache); err != nil {
+		return nil, fmt.Errorf("%w: block %d: %v", ErrInvalidFormat, idx, err)
+	}
+
+	r.cacheIdx = idx
+	return r.cache, nil
+}
+
+// readFullAt читает ровно len(p) байт со смещения off.
+func readFullAt(r io.ReaderAt, p []byte, off int64) error {
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBlock(t *testing.T) {
+	cases := []struct {
+		name      string
+		data      string
+		blockSize int
+	}{
+		{name: "Empty", data: "", blockSize: 16},
+		{name: "Partial block", data: "hello", blockSize: 16},
+		{name: "Exact blocks", data: strings.Repeat("a", 64), blockSize: 16},
+		{name: "Many blocks", data: strings.Repeat("hello world ", 100), blockSize: 16},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriterSize(&buf, Gzip, tc.blockSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(w, tc.data); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Size() != int64(len(tc.data)) {
+				t.Fatalf("expected size %d, got %d", len(tc.data), r.Size())
+			}
+
+			got, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.data {
+				t.Fatal("decompressed data mismatch")
+			}
+
+			// Последовательность блоков gzip должна читаться стандартной библиотекой
+			if tc.data != "" {
+				gr, err := gzip.NewReader(r.Payload())
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := io.ReadAll(gr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tc.data {
+					t.Fatal("gzip payload mismatch")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Package compression реализует блочный формат сжатия с произвольным доступом.
+//
+// Содержимое разбивается на блоки фиксированного размера, каждый блок сжимается отдельно,
+// а в конце потока записывается индекс блоков. Это позволяет читать произвольный диапазон,
+// распаковывая только нужные блоки.
+package compression
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Codec описывает алгоритм сжатия.
+type Codec interface {
+	// Name возвращает имя алгоритма. Для стандартных алгоритмов совпадает со значением Content-Encoding.
+	Name() string
+
+	// NewWriter возвращает поток, сжимающий данные в w.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+
+	// NewReader возвращает поток, распаковывающий данные из r.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = make(map[string]Codec)
+)
+
+func init() {
+	Register(Gzip)
+}
+
+// Register глобально регистрирует алгоритм сжатия.
+func Register(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+
+	if codec == nil {
+		panic("Register codec is nil")
+	}
+
+	name := codec.Name()
+	if _, exists := codecs[name]; exists {
+		panic("Register called twice for codec " + name)
+	}
+
+	codecs[name] = codec
+}
+
+// Lookup возвращает зарегистрированный алгоритм сжатия по имени.
+func Lookup(name string) (Codec, error) {
+	codecsMu.RLock()
+	codec, ok := codecs[name]
+	codecsMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, name)
+	}
+	return codec, nil
+}
+
+// Gzip алгоритм сжатия gzip со степенью сжатия по умолчанию.
+var Gzip Codec = &GzipCodec{Level: gzip.DefaultCompression}
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс Codec.
+var _ Codec = (*GzipCodec)(nil)
+
+// GzipCodec реализует Codec на основе compress/gzip.
+// Сжатые блоки являются отдельными членами gzip, поэтому их последовательность — корректный поток gzip.
+type GzipCodec struct {
+	Level int
+}
+
+func (c *GzipCodec) Name() string { return "gzip" }
+
+func (c *GzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriterLevel(w, c.Level)
+}
+
+func (c *GzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
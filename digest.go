@@ -0,0 +1,130 @@
+package filestore
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// ErrDigestMismatch возвращается, если содержимое не совпадает с ожидаемой хеш-суммой или размером.
+// Конкретные значения содержит *DigestMismatchError.
+var ErrDigestMismatch = errors.New("digest mismatch")
+
+// Expect описывает ожидаемые характеристики сохраняемого содержимого.
+// Пустые поля не проверяются.
+type Expect struct {
+	Size   int64  `json:"size,omitempty"`   // размер в байтах; 0 — не проверяется
+	MD5    string `json:"md5,omitempty"`    // MD5 в шестнадцатеричном виде
+	SHA256 string `json:"sha256,omitempty"` // SHA-256 в шестнадцатеричном виде
+}
+
+// DigestMismatchError описывает несовпадение содержимого с ожидаемым.
+type DigestMismatchError struct {
+	Algorithm string // "size", "md5" или "sha256"
+	Expected  string
+	Actual    string
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("%s mismatch: expected %s, got %s", e.Algorithm, e.Expected, e.Actual)
+}
+
+func (e *DigestMismatchError) Unwrap() error { return ErrDigestMismatch }
+
+// verify сравнивает фактические характеристики содержимого с ожидаемыми.
+func (e *Expect) verify(h *hasher, size int64) error {
+	if e == nil {
+		return nil
+	}
+	if e.Size > 0 && e.Size != size {
+		return &DigestMismatchError{Algorithm: "size", Expected: strconv.FormatInt(e.Size, 10), Actual: strconv.FormatInt(size, 10)}
+	}
+	if e.MD5 != "" {
+		if actual := hex.EncodeToString(h.md5.Sum(nil)); !strings.EqualFold(e.MD5, actual) {
+			return &DigestMismatchError{Algorithm: "md5", Expected: strings.ToLower(e.MD5), Actual: actual}
+		}
+	}
+	if e.SHA256 != "" {
+		if actual := hex.EncodeToString(h.sha256.Sum(nil)); !strings.EqualFold(e.SHA256, actual) {
+			return &DigestMismatchError{Algorithm: "sha256", Expected: strings.ToLower(e.SHA256), Actual: actual}
+		}
+	}
+	return nil
+}
+
+// hasher одновременно считает все хеш-суммы содержимого файла.
+type hasher struct {
+	crc32  hash.Hash32
+	md5    hash.Hash
+	sha256 hash.Hash
+}
+
+func newHasher() *hasher {
+	return &hasher{
+		crc32:  crc32.NewIEEE(),
+		md5:    md5.New(),
+		sha256: sha256.New(),
+	}
+}
+
+// Write реализует метод io.Writer.
+func (h *hasher) Write(p []byte) (int, error) {
+	h.crc32.Write(p)
+	h.md5.Write(p)
+	h.sha256.Write(p)
+	return len(p), nil
+}
+
+// name возвращает имя файла хранилища: base32 от CRC32 и MD5.
+func (h *hasher) name() string {
+	return base32.StdEncoding.EncodeToString(append(h.crc32.Sum(nil), h.md5.Sum(nil)...))
+}
+
+// hashState описывает сохранённое состояние хеш-функций.
+type hashState struct {
+	CRC32  []byte `json:"crc32"`
+	MD5    []byte `json:"md5"`
+	SHA256 []byte `json:"sha256"`
+}
+
+// state возвращает состояние хеш-функций для продолжения подсчёта после перезапуска.
+func (h *hasher) state() (*hashState, error) {
+	st := &hashState{}
+	for _, v := range []struct {
+		h   hash.Hash
+		dst *[]byte
+	}{{h.crc32, &st.CRC32}, {h.md5, &st.MD5}, {h.sha256, &st.SHA256}} {
+		b, err := v.h.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		*v.dst = b
+	}
+	return st, nil
+}
+
+// restoreHasher восстанавливает хеш-функции из сохранённого состояния.
+func restoreHasher(st *hashState) (*hasher, error) {
+	if st == nil {
+		return nil, errors.New("missing hash state")
+	}
+
+	h := newHasher()
+	for _, v := range []struct {
+		h   hash.Hash
+		src []byte
+	}{{h.crc32, st.CRC32}, {h.md5, st.MD5}, {h.sha256, st.SHA256}} {
+		if err := v.h.(encoding.BinaryUnmarshaler).UnmarshalBinary(v.src); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
@@ -0,0 +1,106 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCreateVerified(t *testing.T) {
+	data := []byte("hello world")
+	md5sum := md5.Sum(data)
+	shasum := sha256.Sum256(data)
+	md5hex, shahex := hex.EncodeToString(md5sum[:]), hex.EncodeToString(shasum[:])
+
+	cases := []struct {
+		name      string
+		expect    Expect
+		algorithm string // алгоритм несовпадения; пустой — файл сохраняется
+	}{
+		{name: "Nothing expected", expect: Expect{}},
+		{name: "All match", expect: Expect{Size: int64(len(data)), MD5: md5hex, SHA256: strings.ToUpper(shahex)}},
+		{name: "Smaller size", expect: Expect{Size: 5}, algorithm: "size"},
+		{name: "Larger size", expect: Expect{Size: 100}, algorithm: "size"},
+		{name: "MD5 mismatch", expect: Expect{MD5: shahex[:32]}, algorithm: "md5"},
+		{name: "SHA-256 mismatch", expect: Expect{MD5: md5hex, SHA256: strings.Repeat("0", 64)}, algorithm: "sha256"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestStorage(t)
+
+			fi, err := s.CreateVerified(context.Background(), bytes.NewReader(data), tc.expect)
+			if tc.algorithm == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fi.MD5 != md5hex || fi.SHA256 != shahex {
+					t.Fatalf("unexpected file info %+v", fi)
+				}
+				return
+			}
+
+			var de *DigestMismatchError
+			if !errors.As(err, &de) || !errors.Is(err, ErrDigestMismatch) || de.Algorithm != tc.algorithm {
+				t.Fatalf("expected %s mismatch, got %v", tc.algorithm, err)
+			}
+
+			// Ни файл, ни временные файлы не остаются
+			entries, err := os.ReadDir(s.rootDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				if e.Name() != accessLogName {
+					t.Fatalf("unexpected entry %s", e.Name())
+				}
+			}
+		})
+	}
+}
+
+func TestHandlerDigestHeaders(t *testing.T) {
+	data := []byte("hello world")
+	md5sum := md5.Sum(data)
+	shasum := sha256.Sum256(data)
+	md5b64 := base64.StdEncoding.EncodeToString(md5sum[:])
+	shab64 := base64.StdEncoding.EncodeToString(shasum[:])
+	wrong := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	cases := []struct {
+		name   string
+		header map[string]string
+		status int
+	}{
+		{name: "Content-MD5", header: map[string]string{"Content-MD5": md5b64}, status: http.StatusCreated},
+		{name: "Digest", header: map[string]string{"Digest": "MD5=" + md5b64 + ", SHA-256=" + shab64}, status: http.StatusCreated},
+		{name: "Repr-Digest", header: map[string]string{"Repr-Digest": "sha-256=:" + shab64 + ":"}, status: http.StatusCreated},
+		{name: "Unknown algorithm", header: map[string]string{"Digest": "unixsum=30637"}, status: http.StatusCreated},
+		{name: "Mismatch", header: map[string]string{"Digest": "sha-256=" + wrong}, status: http.StatusBadRequest},
+		{name: "Wrong length", header: map[string]string{"Content-MD5": shab64}, status: http.StatusBadRequest},
+		{name: "Invalid base64", header: map[string]string{"Content-MD5": "!!!"}, status: http.StatusBadRequest},
+		{name: "Conflict", header: map[string]string{"Content-MD5": md5b64, "Digest": "md5=" + base64.StdEncoding.EncodeToString(make([]byte, md5.Size))}, status: http.StatusBadRequest},
+		{name: "Invalid Digest", header: map[string]string{"Digest": "sha-256"}, status: http.StatusBadRequest},
+		{name: "Invalid Repr-Digest", header: map[string]string{"Repr-Digest": "sha-256=" + shab64}, status: http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h, _ := newTestHandler(t)
+			w := do(h, http.MethodPost, "/blobs", data, tc.header)
+			if tc.status != http.StatusCreated {
+				assertError(t, w, tc.status)
+				return
+			}
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got %d: %s", tc.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package filestore
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// WithDurability включает сброс данных на диск (fsync) перед помещением файлов в хранилище,
+// а также сброс каталогов после создания, перемещения и удаления файлов. Это гарантирует,
+// что после сбоя питания под именем файла не окажется пустого или неполного содержимого.
+func WithDurability() LocalStorageOption {
+	return func(s *LocalStorage) {
+		s.durable = true
+	}
+}
+
+// rename атомарно перемещает файл src в dst. В режиме надёжной записи содержимое src
+// сбрасывается на диск до перемещения, а каталоги dst — после.
+func (s *LocalStorage) rename(src, dst string) error {
+	if s.durable {
+		if err := syncFile(src); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(src, dst); err != nil {
+		return err
+	}
+	if s.durable {
+		return s.syncDirs(filepath.Dir(dst))
+	}
+	return nil
+}
+
+// syncRemoved сбрасывает на диск ближайший существующий каталог удалённого файла path.
+func (s *LocalStorage) syncRemoved(path string) error {
+	if !s.durable {
+		return nil
+	}
+
+	dir := filepath.Dir(path)
+	for dir != s.rootDir && len(dir) > len(s.rootDir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return s.syncDirs(dir)
+}
+
+// syncDirs сбрасывает на диск каталог dir и все его родительские каталоги до rootDir включительно,
+// чтобы новые каталоги, созданные MkdirAll, также сохранились.
+func (s *LocalStorage) syncDirs(dir string) error {
+	for {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+		if dir == s.rootDir || len(dir) <= len(s.rootDir) {
+			return nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// syncFile сбрасывает содержимое файла на диск.
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+// syncDir сбрасывает на диск содержимое каталога. В Windows каталоги не синхронизируются.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
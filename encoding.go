@@ -0,0 +1,195 @@
+package filestore
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// encodingExt задаёт расширения объектов-двойников со сжатым представлением в удалённом хранилище.
+var encodingExt = map[string]string{
+	"gzip": ".gz",
+}
+
+// NewEncodingHandler возвращает обработчик, который отдаёт файлы HttpFS с учётом Accept-Encoding.
+// Клиентам, принимающим gzip, сжатые файлы отдаются как есть с заголовком Content-Encoding: gzip,
+// остальным — в распакованном виде. Запросы с Range всегда обслуживаются в исходном представлении.
+// В отличие от http.FileServer, ответы содержат сильный ETag, поэтому условные запросы
+// (If-None-Match, If-Match, If-Range) работают и для локального, и для удалённого хранилища.
+func NewEncodingHandler(f *HttpFS) http.Handler {
+	return &encodingHandler{fs: f}
+}
+
+type encodingHandler struct {
+	fs *HttpFS
+}
+
+func (h *encodingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := serveFile(w, r, h.fs, strings.TrimPrefix(r.URL.Path, "/")); err != nil {
+		msg, code := toHTTPError(err)
+		http.Error(w, msg, code)
+	}
+}
+
+// serveFile отдаёт файл name, выбирая представление по заголовку Accept-Encoding.
+func serveFile(w http.ResponseWriter, r *http.Request, f *HttpFS, name string) error {
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	if r.Header.Get("Range") == "" && acceptsEncoding(r, "gzip") {
+		if ef, err := f.OpenEncoded(name, "gzip"); err == nil {
+			defer ef.Close()
+			return serveEncoded(w, r, name, ef, "gzip")
+		} else if !isNotEncoded(err) {
+			return err
+		}
+	}
+
+	file, err := f.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Файл может существовать только в сжатом виде — распаковываем его на лету
+		if ef, eerr := f.OpenEncoded(name, "gzip"); eerr == nil {
+			defer ef.Close()
+			return serveDecoded(w, r, name, ef)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fs.ErrNotExist
+	}
+
+	modtime := setCacheHeaders(w, name, info, "")
+	http.ServeContent(w, r, name, modtime, file)
+	return nil
+}
+
+// serveEncoded отдаёт сжатое представление файла как есть.
+func serveEncoded(w http.ResponseWriter, r *http.Request, name string, ef http.File, coding string) error {
+	info, err := ef.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Тип содержимого определяем по распакованным данным
+	if w.Header().Get("Content-Type") == "" {
+		ctype, err := sniffEncoded(ef)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", ctype)
+	}
+
+	w.Header().Set("Content-Encoding", coding)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	modtime := setCacheHeaders(w, name, info, coding)
+	http.ServeContent(w, r, name, modtime, ef)
+	return nil
+}
+
+// serveDecoded распаковывает сжатое представление на лету. Диапазоны в этом случае не поддерживаются.
+func serveDecoded(w http.ResponseWriter, r *http.Request, name string, ef http.File) error {
+	// ETag распакованного представления совпадает с ETag исходного файла
+	if isContentName(name) {
+		setCacheHeaders(w, name, nil, "")
+		if checkNotModified(w, r) {
+			return nil
+		}
+	}
+
+	zr, err := gzip.NewReader(ef)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	var buf [512]byte
+	n, err := io.ReadFull(zr, buf[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", http.DetectContentType(buf[:n]))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method != http.MethodHead {
+		w.Write(buf[:n])
+		io.Copy(w, zr)
+	}
+	return nil
+}
+
+// sniffEncoded определяет тип распакованного содержимого и возвращает файл в начало.
+func sniffEncoded(ef http.File) (string, error) {
+	zr, err := gzip.NewReader(ef)
+	if err != nil {
+		return "", err
+	}
+
+	var buf [512]byte
+	n, err := io.ReadFull(zr, buf[:])
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	if _, err := ef.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// acceptsEncoding проверяет, принимает ли клиент алгоритм сжатия coding.
+func acceptsEncoding(r *http.Request, coding string) bool {
+	wildcard := false
+	for _, field := range r.Header.Values("Accept-Encoding") {
+		for part := range strings.SplitSeq(field, ",") {
+			token, params, _ := strings.Cut(part, ";")
+			token = strings.ToLower(strings.TrimSpace(token))
+
+			q := 1.0
+			if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if f, err := strconv.ParseFloat(v, 64); err == nil {
+					q = f
+				}
+			}
+
+			switch token {
+			case coding, "x-" + coding:
+				// Явное указание алгоритма имеет приоритет над "*"
+				return q > 0
+			case "*":
+				wildcard = q > 0
+			}
+		}
+	}
+	return wildcard
+}
+
+// isNotEncoded определяет, означает ли ошибка отсутствие сжатого представления.
+func isNotEncoded(err error) bool {
+	return errors.Is(err, ErrNotEncoded) || errors.Is(err, fs.ErrNotExist)
+}
+
+// toHTTPError преобразует ошибку в текст и код ответа HTTP.
+func toHTTPError(err error) (string, int) {
+	code := errorStatus(err)
+	return strconv.Itoa(code) + " " + http.StatusText(code), code
+}
@@ -0,0 +1,138 @@
+package filestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tenrok/filestore/remote"
+	_ "github.com/tenrok/filestore/remote/memstorage"
+)
+
+func gunzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plain
+}
+
+func TestEncodingHandler(t *testing.T) {
+	fsys, err := NewHttpFS(t.TempDir(), WithLocalStorageOptions(WithCompression(CompressionPolicy{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+
+	text := []byte(strings.Repeat("hello encoding ", 1000))
+	compressed, err := fsys.Create(context.Background(), bytes.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary := []byte{0, 1, 2, 3, 4, 5}
+	plain, err := fsys.Create(context.Background(), bytes.NewReader(binary))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewEncodingHandler(fsys)
+
+	cases := []struct {
+		name     string
+		file     *FileInfo
+		header   map[string]string
+		encoding string
+		status   int
+		body     []byte
+	}{
+		{name: "Gzip accepted", file: compressed, header: map[string]string{"Accept-Encoding": "br, gzip"}, encoding: "gzip", status: http.StatusOK, body: text},
+		{name: "Wildcard", file: compressed, header: map[string]string{"Accept-Encoding": "*"}, encoding: "gzip", status: http.StatusOK, body: text},
+		{name: "Gzip refused", file: compressed, header: map[string]string{"Accept-Encoding": "gzip;q=0, *"}, status: http.StatusOK, body: text},
+		{name: "No Accept-Encoding", file: compressed, status: http.StatusOK, body: text},
+		{name: "Range", file: compressed, header: map[string]string{"Accept-Encoding": "gzip", "Range": "bytes=6-13"}, status: http.StatusPartialContent, body: text[6:14]},
+		{name: "Not compressed", file: plain, header: map[string]string{"Accept-Encoding": "gzip"}, status: http.StatusOK, body: binary},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(h, http.MethodGet, "/"+tc.file.Name, nil, tc.header)
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, w.Code)
+			}
+			if got := w.Header().Get("Content-Encoding"); got != tc.encoding {
+				t.Fatalf("expected Content-Encoding %q, got %q", tc.encoding, got)
+			}
+			if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+				t.Fatalf("expected Vary: Accept-Encoding, got %q", got)
+			}
+
+			body := w.Body.Bytes()
+			if tc.encoding == "gzip" {
+				body = gunzip(t, body)
+				if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+					t.Fatalf("unexpected Content-Type %q", ct)
+				}
+			}
+			if !bytes.Equal(body, tc.body) {
+				t.Fatalf("unexpected body %q", body)
+			}
+		})
+	}
+
+	if w := do(h, http.MethodPost, "/"+compressed.Name, nil, nil); w.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %d", w.Code)
+	}
+	if w := do(h, http.MethodGet, "/missing", nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+}
+
+// Удалённое хранилище может содержать только сжатый объект-двойник.
+func TestEncodingHandlerRemoteTwin(t *testing.T) {
+	storage, err := remote.NewStorage(context.Background(), "mem://"+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := NewHttpFS(t.TempDir(), WithRemoteStorage(storage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+
+	text := []byte(strings.Repeat("remote twin ", 100))
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(text)
+	zw.Close()
+	if err := storage.Uploader().Upload("doc.txt.gz", bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewEncodingHandler(fsys)
+
+	w := do(h, http.MethodGet, "/doc.txt", nil, map[string]string{"Accept-Encoding": "gzip"})
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip response, got %d %q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+	if !bytes.Equal(gunzip(t, w.Body.Bytes()), text) {
+		t.Fatal("unexpected body")
+	}
+
+	// Клиенту без поддержки gzip объект распаковывается на лету
+	w = do(h, http.MethodGet, "/doc.txt", nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("expected plain response, got %d %q", w.Code, w.Header().Get("Content-Encoding"))
+	}
+	if !bytes.Equal(w.Body.Bytes(), text) {
+		t.Fatal("unexpected body")
+	}
+}
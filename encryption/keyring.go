@@ -0,0 +1,227 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс KeyProvider.
+var _ KeyProvider = (*Keyring)(nil)
+
+// KeyProvider шифрует (оборачивает) и расшифровывает ключи данных.
+// Локальный Keyring хранит мастер-ключи в файле, реализации для KMS подключаются через этот же интерфейс.
+type KeyProvider interface {
+	// CurrentKeyID возвращает идентификатор мастер-ключа, которым шифруются новые ключи данных.
+	CurrentKeyID() string
+
+	// WrapKey шифрует ключ данных текущим мастер-ключом.
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+
+	// UnwrapKey расшифровывает ключ данных мастер-ключом keyID.
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Keyring хранит набор мастер-ключей AES-256. Новые ключи данных шифруются текущим ключом,
+// остальные ключи используются только для расшифровки.
+type Keyring struct {
+	mu      sync.RWMutex
+	current string
+	keys    map[string][]byte
+}
+
+// keyringFile описывает формат файла с ключами.
+type keyringFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// NewKeyring создаёт пустой набор ключей.
+func NewKeyring() *Keyring {
+	return &Keyring{keys: make(map[string][]byte)}
+}
+
+// LoadKeyring загружает набор ключей из файла.
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var kf keyringFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("encryption: invalid keyring file: %w", err)
+	}
+
+	k := NewKeyring()
+	for id, s := range kf.Keys {
+		key, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("encryption: invalid key %q: %w", id, err)
+		}
+		if err := k.AddKey(id, key); err != nil {
+			return nil, err
+		}
+	}
+	if kf.Current != "" {
+		if err := k.SetCurrent(kf.Current); err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+// Save сохраняет набор ключей в файл. Файл перезаписывается атомарно.
+func (k *Keyring) Save(path string) error {
+	k.mu.RLock()
+	kf := keyringFile{Current: k.current, Keys: make(map[string]string, len(k.keys))}
+	for id, key := range k.keys {
+		kf.Keys[id] = base64.StdEncoding.EncodeToString(key)
+	}
+	k.mu.RUnlock()
+
+	data, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpfile, err := os.CreateTemp(filepath.Dir(path), ".keyring")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpfile.Name())
+
+	if _, err := tmpfile.Write(data); err != nil {
+		tmpfile.Close()
+		return err
+	}
+	if err := tmpfile.Sync(); err != nil {
+		tmpfile.Close()
+		return err
+	}
+	if err := tmpfile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpfile.Name(), path)
+}
+
+// AddKey добавляет мастер-ключ. Первый добавленный ключ становится текущим.
+func (k *Keyring) AddKey(id string, key []byte) error {
+	if id == "" {
+		return errors.New("encryption: key id is empty")
+	}
+	if len(key) != KeySize {
+		return fmt.Errorf("encryption: key %q must be %d bytes", id, KeySize)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, exists := k.keys[id]; exists {
+		return fmt.Errorf("encryption: key %q already exists", id)
+	}
+	k.keys[id] = append([]byte(nil), key...)
+	if k.current == "" {
+		k.current = id
+	}
+	return nil
+}
+
+// GenerateKey создаёт случайный мастер-ключ и делает его текущим.
+func (k *Keyring) GenerateKey(id string) error {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	if err := k.AddKey(id, key); err != nil {
+		return err
+	}
+	return k.SetCurrent(id)
+}
+
+// SetCurrent делает ключ id текущим.
+func (k *Keyring) SetCurrent(id string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if _, ok := k.keys[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, id)
+	}
+	k.current = id
+	return nil
+}
+
+// CurrentKeyID реализует метод KeyProvider.
+func (k *Keyring) CurrentKeyID() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.current
+}
+
+// WrapKey реализует метод KeyProvider.
+func (k *Keyring) WrapKey(dataKey []byte) (string, []byte, error) {
+	k.mu.RLock()
+	id, master := k.current, k.keys[k.current]
+	k.mu.RUnlock()
+
+	if master == nil {
+		return "", nil, errors.New("encryption: keyring has no current key")
+	}
+
+	aead, err := newGCM(master)
+	if err != nil {
+		return "", nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+
+	return id, aead.Seal(nonce, nonce, dataKey, []byte(id)), nil
+}
+
+// UnwrapKey реализует метод KeyProvider.
+func (k *Keyring) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	k.mu.RLock()
+	master := k.keys[keyID]
+	k.mu.RUnlock()
+
+	if master == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+
+	aead, err := newGCM(master)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("encryption: wrapped key is too short")
+	}
+	nonce, ciphertext := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+
+	dataKey, err := aead.Open(nil, nonce, ciphertext, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("encryption: unwrap key %q: %w", keyID, err)
+	}
+	return dataKey, nil
+}
+
+// newGCM создаёт AES-GCM для ключа.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
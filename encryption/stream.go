@@ -0,0 +1,416 @@
+// Package encryption реализует потоковое шифрование AES-256-GCM с произвольным доступом.
+//
+// Поток состоит из заголовка и последовательности блоков. Каждый блок шифруется отдельно,
+// поэтому для чтения произвольного диапазона достаточно расшифровать только нужные блоки.
+// Для каждого потока генерируется свой ключ данных, который хранится в заголовке
+// в зашифрованном мастер-ключом виде (envelope encryption).
+package encryption
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+)
+
+const (
+	// KeySize размер ключа данных и мастер-ключа (AES-256).
+	KeySize = 32
+
+	// DefaultChunkSize размер блока открытого текста по умолчанию.
+	DefaultChunkSize = 64 << 10
+
+	// максимальный допустимый размер блока
+	maxChunkSize = 16 << 20
+
+	// размер тега аутентификации GCM
+	tagSize = 16
+
+	// размер случайного префикса nonce; оставшиеся 5 байт — номер блока и признак последнего блока
+	noncePrefixSize = 7
+
+	// размер фиксированной части заголовка: magic, размер блока, префикс nonce
+	fixedHeaderSize = len(magic) + 4 + noncePrefixSize
+)
+
+// magic начинает каждый зашифрованный поток.
+var magic = [8]byte{'F', 'S', 'A', 'E', 'A', 'D', 0x00, 0x01}
+
+var (
+	ErrInvalidHeader = errors.New("encryption: invalid header")
+	ErrUnknownKey    = errors.New("encryption: unknown key")
+	ErrCorrupted     = errors.New("encryption: stream is corrupted")
+)
+
+// DataKey описывает ключ данных отдельного потока.
+type DataKey struct {
+	KeyID   string // идентификатор мастер-ключа
+	key     []byte
+	wrapped []byte
+}
+
+// GenerateDataKey создаёт случайный ключ данных и шифрует его текущим мастер-ключом.
+func GenerateDataKey(kp KeyProvider) (*DataKey, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	keyID, wrapped, err := kp.WrapKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataKey{KeyID: keyID, key: key, wrapped: wrapped}, nil
+}
+
+// header описывает заголовок зашифрованного потока.
+type header struct {
+	chunkSize   int
+	noncePrefix [noncePrefixSize]byte
+	keyID       string
+	wrappedKey  []byte
+	raw         []byte // сериализованный заголовок, используется как дополнительные данные AEAD
+}
+
+func (h *header) marshal() []byte {
+	var b bytes.Buffer
+	b.Write(magic[:])
+	binary.Write(&b, binary.BigEndian, uint32(h.chunkSize))
+	b.Write(h.noncePrefix[:])
+	binary.Write(&b, binary.BigEndian, uint16(len(h.keyID)))
+	b.WriteString(h.keyID)
+	binary.Write(&b, binary.BigEndian, uint16(len(h.wrappedKey)))
+	b.Write(h.wrappedKey)
+	return b.Bytes()
+}
+
+// readHeader читает и разбирает заголовок потока.
+func readHeader(r io.ReaderAt) (*header, error) {
+	fixed := make([]byte, fixedHeaderSize+2)
+	if err := readFullAt(r, fixed, 0); err != nil {
+		return nil, ErrInvalidHeader
+	}
+	if !bytes.Equal(fixed[:len(magic)], magic[:]) {
+		return nil, ErrInvalidHeader
+	}
+
+	h := &header{}
+	h.chunkSize = int(binary.BigEndian.Uint32(fixed[len(magic):]))
+	if h.chunkSize <= 0 || h.chunkSize > maxChunkSize {
+		return nil, ErrInvalidHeader
+	}
+	copy(h.noncePrefix[:], fixed[len(magic)+4:])
+
+	off := int64(len(fixed))
+	keyID := make([]byte, binary.BigEndian.Uint16(fixed[fixedHeaderSize:]))
+	if err := readFullAt(r, keyID, off); err != nil {
+		return nil, ErrInvalidHeader
+	}
+	off += int64(len(keyID))
+
+	var l [2]byte
+	if err := readFullAt(r, l[:], off); err != nil {
+		return nil, ErrInvalidHeader
+	}
+	off += 2
+
+	wrapped := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if err := readFullAt(r, wrapped, off); err != nil {
+		return nil, ErrInvalidHeader
+	}
+
+	h.keyID = string(keyID)
+	h.wrappedKey = wrapped
+	h.raw = h.marshal()
+	return h, nil
+}
+
+// layout вычисляет количество блоков и размер открытого текста по размеру потока.
+func (h *header) layout(size int64) (chunks, plainSize int64, err error) {
+	payload := size - int64(len(h.raw))
+	if payload < tagSize {
+		return 0, 0, ErrCorrupted
+	}
+
+	sealed := int64(h.chunkSize) + tagSize
+	chunks = (payload + sealed - 1) / sealed
+	if last := payload - (chunks-1)*sealed; last < tagSize {
+		return 0, 0, ErrCorrupted
+	}
+	return chunks, payload - chunks*tagSize, nil
+}
+
+// IsEncrypted проверяет, начинаются ли данные с заголовка зашифрованного потока.
+func IsEncrypted(r io.ReaderAt) bool {
+	var b [len(magic)]byte
+	if err := readFullAt(r, b[:], 0); err != nil {
+		return false
+	}
+	return b == magic
+}
+
+// Info возвращает идентификатор мастер-ключа и размер открытого текста без расшифровки потока.
+func Info(r io.ReaderAt, size int64) (keyID string, plainSize int64, err error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return "", 0, err
+	}
+	_, plainSize, err = h.layout(size)
+	if err != nil {
+		return "", 0, err
+	}
+	return h.keyID, plainSize, nil
+}
+
+// nonce формирует nonce для блока: префикс, номер блока и признак последнего блока.
+func (h *header) nonce(dst []byte, idx uint32, last bool) []byte {
+	dst = append(dst[:0], h.noncePrefix[:]...)
+	dst = binary.BigEndian.AppendUint32(dst, idx)
+	if last {
+		return append(dst, 1)
+	}
+	return append(dst, 0)
+}
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс io.WriteCloser.
+var _ io.WriteCloser = (*Writer)(nil)
+
+// Writer шифрует записываемые данные. Close дописывает последний блок, но не закрывает нижележащий поток.
+type Writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	hdr     *header
+	buf     []byte
+	out     []byte
+	nonce   []byte
+	counter uint32
+	started bool
+	closed  bool
+}
+
+// NewWriter создаёт Writer с размером блока по умолчанию.
+func NewWriter(w io.Writer, key *DataKey) (*Writer, error) {
+	return NewWriterSize(w, key, DefaultChunkSize)
+}
+
+// NewWriterSize создаёт Writer с заданным размером блока.
+func NewWriterSize(w io.Writer, key *DataKey, chunkSize int) (*Writer, error) {
+	if chunkSize <= 0 || chunkSize > maxChunkSize {
+		return nil, fmt.Errorf("encryption: invalid chunk size %d", chunkSize)
+	}
+	if len(key.KeyID) > math.MaxUint16 || len(key.wrapped) > math.MaxUint16 {
+		return nil, errors.New("encryption: key id or wrapped key is too long")
+	}
+
+	aead, err := newGCM(key.key)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &header{chunkSize: chunkSize, keyID: key.KeyID, wrappedKey: key.wrapped}
+	if _, err := rand.Read(h.noncePrefix[:]); err != nil {
+		return nil, err
+	}
+	h.raw = h.marshal()
+
+	return &Writer{
+		w:    w,
+		aead: aead,
+		hdr:  h,
+		buf:  make([]byte, 0, chunkSize),
+	}, nil
+}
+
+// KeyID возвращает идентификатор мастер-ключа потока.
+func (w *Writer) KeyID() string { return w.hdr.keyID }
+
+// Write реализует метод io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("encryption: write to closed writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// Полный блок сбрасываем только когда известно, что он не последний
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close реализует метод io.Closer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush(true)
+}
+
+// flush шифрует накопленный блок и записывает его в поток.
+func (w *Writer) flush(last bool) error {
+	if !w.started {
+		if _, err := w.w.Write(w.hdr.raw); err != nil {
+			return err
+		}
+		w.started = true
+	}
+
+	if w.counter == math.MaxUint32 {
+		return errors.New("encryption: stream is too long")
+	}
+
+	w.nonce = w.hdr.nonce(w.nonce, w.counter, last)
+	w.out = w.aead.Seal(w.out[:0], w.nonce, w.buf, w.hdr.raw)
+	if _, err := w.w.Write(w.out); err != nil {
+		return err
+	}
+
+	w.counter++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс io.ReaderAt.
+var _ io.ReaderAt = (*Reader)(nil)
+
+// Reader расшифровывает поток с произвольным доступом.
+type Reader struct {
+	r         io.ReaderAt
+	aead      cipher.AEAD
+	hdr       *header
+	chunks    int64
+	size      int64
+	streamLen int64
+
+	mu       sync.Mutex
+	cacheIdx int64
+	cache    []byte
+	sealed   []byte
+	nonce    []byte
+}
+
+// NewReader создаёт Reader для потока размера size.
+func NewReader(r io.ReaderAt, size int64, kp KeyProvider) (*Reader, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks, plainSize, err := h.layout(size)
+	if err != nil {
+		return nil, err
+	}
+	if chunks > math.MaxUint32 {
+		return nil, ErrCorrupted
+	}
+
+	dataKey, err := kp.UnwrapKey(h.keyID, h.wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reader{
+		r:         r,
+		aead:      aead,
+		hdr:       h,
+		chunks:    chunks,
+		size:      plainSize,
+		streamLen: size,
+		cacheIdx:  -1,
+	}, nil
+}
+
+// Size возвращает размер открытого текста.
+func (r *Reader) Size() int64 { return r.size }
+
+// KeyID возвращает идентификатор мастер-ключа потока.
+func (r *Reader) KeyID() string { return r.hdr.keyID }
+
+// ReadAt реализует метод io.ReaderAt.
+func (r *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("encryption: negative offset")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		if off >= r.size {
+			return n, io.EOF
+		}
+
+		idx := off / int64(r.hdr.chunkSize)
+		chunk, err := r.chunk(idx)
+		if err != nil {
+			return n, err
+		}
+
+		c := copy(p[n:], chunk[off-idx*int64(r.hdr.chunkSize):])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+// chunk возвращает расшифрованный блок idx. Последний прочитанный блок кешируется.
+func (r *Reader) chunk(idx int64) ([]byte, error) {
+	if idx == r.cacheIdx {
+		return r.cache, nil
+	}
+
+	sealedSize := int64(r.hdr.chunkSize) + tagSize
+	start := int64(len(r.hdr.raw)) + idx*sealedSize
+	length := min(sealedSize, r.streamLen-start)
+
+	if int64(cap(r.sealed)) < length {
+		r.sealed = make([]byte, sealedSize)
+	}
+	r.sealed = r.sealed[:length]
+	if err := readFullAt(r.r, r.sealed, start); err != nil {
+		return nil, err
+	}
+
+	r.nonce = r.hdr.nonce(r.nonce, uint32(idx), idx == r.chunks-1)
+	plain, err := r.aead.Open(r.cache[:0], r.nonce, r.sealed, r.hdr.raw)
+	if err != nil {
+		r.cacheIdx = -1
+		return nil, fmt.Errorf("%w: chunk %d: %v", ErrCorrupted, idx, err)
+	}
+
+	r.cache, r.cacheIdx = plain, idx
+	return plain, nil
+}
+
+// readFullAt читает ровно len(p) байт со смещения off.
+func readFullAt(r io.ReaderAt, p []byte, off int64) error {
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,89 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+)
+
+func TestStream(t *testing.T) {
+	keyring := NewKeyring()
+	if err := keyring.GenerateKey("k1"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name      string
+		size      int
+		chunkSize int
+	}{
+		{name: "Empty", size: 0, chunkSize: 16},
+		{name: "Partial chunk", size: 10, chunkSize: 16},
+		{name: "Exact chunks", size: 64, chunkSize: 16},
+		{name: "Many chunks", size: 1000, chunkSize: 16},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			plain := make([]byte, tc.size)
+			rand.Read(plain)
+
+			key, err := GenerateDataKey(keyring)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			w, err := NewWriterSize(&buf, key, tc.chunkSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(plain); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			sealed := bytes.NewReader(buf.Bytes())
+			r, err := NewReader(sealed, int64(buf.Len()), keyring)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Size() != int64(tc.size) {
+				t.Fatalf("expected size %d, got %d", tc.size, r.Size())
+			}
+
+			got, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain) {
+				t.Fatal("decrypted data mismatch")
+			}
+
+			// Чтение диапазона, пересекающего границу блоков
+			if tc.size > tc.chunkSize+5 {
+				part := make([]byte, tc.chunkSize)
+				if _, err := r.ReadAt(part, int64(tc.chunkSize/2)); err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(part, plain[tc.chunkSize/2:tc.chunkSize/2+tc.chunkSize]) {
+					t.Fatal("range data mismatch")
+				}
+			}
+
+			// Усечение потока должно обнаруживаться
+			if tc.size > 0 {
+				truncated := buf.Bytes()[:buf.Len()-1]
+				r, err := NewReader(bytes.NewReader(truncated), int64(len(truncated)), keyring)
+				if err == nil {
+					_, err = io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+				}
+				if err == nil {
+					t.Fatal("expected error for truncated stream")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package filestore
+
+import (
+	"encoding/base32"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// immutableCacheControl разрешает кешировать файлы с именами по содержимому без ограничений:
+// содержимое под таким именем никогда не меняется.
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// isContentName проверяет, является ли имя именем по содержимому (base32 от CRC32 и MD5).
+func isContentName(name string) bool {
+	if len(name) != nameLen {
+		return false
+	}
+	b, err := base32.StdEncoding.DecodeString(name)
+	return err == nil && len(b) == 4+16
+}
+
+// setCacheHeaders выставляет ETag и Cache-Control для представления файла и возвращает время
+// изменения, которое следует передать в http.ServeContent.
+//
+// Для имён по содержимому ETag строится из самого имени, поэтому он одинаков для локального
+// и удалённого хранилища. Время изменения в этом случае не отдаётся: содержимое под таким
+// именем неизменно, и сильный ETag полностью заменяет Last-Modified, а время изменения одного
+// и того же файла в разных хранилищах различается. Для остальных файлов используется ETag
+// удалённого хранилища, если оно его предоставляет.
+func setCacheHeaders(w http.ResponseWriter, name string, info fs.FileInfo, coding string) time.Time {
+	var etag string
+	modtime := time.Time{}
+
+	if isContentName(name) {
+		etag = name
+		w.Header().Set("Cache-Control", immutableCacheControl)
+	} else if info != nil {
+		modtime = info.ModTime()
+		if e, ok := info.(interface{ ETag() string }); ok {
+			etag = strings.Trim(e.ETag(), `"`)
+		}
+	}
+
+	if etag != "" {
+		// Разные представления должны иметь разные сильные ETag
+		if coding != "" {
+			etag += "-" + coding
+		}
+		w.Header().Set("ETag", `"`+etag+`"`)
+	}
+	return modtime
+}
+
+// checkNotModified обрабатывает If-None-Match для ответов, которые формируются без
+// http.ServeContent, и при совпадении отвечает 304 Not Modified.
+func checkNotModified(w http.ResponseWriter, r *http.Request) bool {
+	etag := w.Header().Get("ETag")
+	inm := r.Header.Get("If-None-Match")
+	if etag == "" || inm == "" {
+		return false
+	}
+
+	for candidate := range strings.SplitSeq(inm, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
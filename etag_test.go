@@ -0,0 +1,133 @@
+package filestore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/tenrok/filestore/remote"
+)
+
+func TestIsContentName(t *testing.T) {
+	s := newTestStorage(t)
+	fi := createBlob(t, s, []byte("content name"))
+
+	cases := []struct {
+		name string
+		ok   bool
+	}{
+		{name: fi.Name, ok: true},
+		{name: fi.Name[:nameLen-1], ok: false},
+		{name: strings.Repeat("1", nameLen), ok: false},
+		{name: "report.pdf", ok: false},
+	}
+	for _, tc := range cases {
+		if got := isContentName(tc.name); got != tc.ok {
+			t.Errorf("isContentName(%q): expected %v, got %v", tc.name, tc.ok, got)
+		}
+	}
+}
+
+func TestETag(t *testing.T) {
+	fsys, err := NewHttpFS(t.TempDir(), WithLocalStorageOptions(WithCompression(CompressionPolicy{})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+	fi, err := fsys.Create(context.Background(), strings.NewReader(strings.Repeat("cache me ", 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(fsys)
+	target := "/blobs/" + fi.Name
+
+	cases := []struct {
+		name   string
+		header map[string]string
+		etag   string
+		status int
+	}{
+		{name: "Identity", etag: `"` + fi.Name + `"`, status: http.StatusOK},
+		{name: "Gzip", header: map[string]string{"Accept-Encoding": "gzip"}, etag: `"` + fi.Name + `-gzip"`, status: http.StatusOK},
+		{name: "Not modified", header: map[string]string{"If-None-Match": `"` + fi.Name + `"`}, etag: `"` + fi.Name + `"`, status: http.StatusNotModified},
+		{name: "Weak match", header: map[string]string{"If-None-Match": `"other", W/"` + fi.Name + `"`}, etag: `"` + fi.Name + `"`, status: http.StatusNotModified},
+		{name: "Other representation", header: map[string]string{"Accept-Encoding": "gzip", "If-None-Match": `"` + fi.Name + `"`}, etag: `"` + fi.Name + `-gzip"`, status: http.StatusOK},
+		{name: "If-Match failed", header: map[string]string{"If-Match": `"other"`}, etag: `"` + fi.Name + `"`, status: http.StatusPreconditionFailed},
+		{name: "If-Range mismatch", header: map[string]string{"Range": "bytes=0-4", "If-Range": `"other"`}, etag: `"` + fi.Name + `"`, status: http.StatusOK},
+		{name: "If-Range match", header: map[string]string{"Range": "bytes=0-4", "If-Range": `"` + fi.Name + `"`}, etag: `"` + fi.Name + `"`, status: http.StatusPartialContent},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := do(h, http.MethodGet, target, nil, tc.header)
+			if w.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, w.Code)
+			}
+			if etag := w.Header().Get("ETag"); etag != tc.etag {
+				t.Fatalf("expected ETag %s, got %s", tc.etag, etag)
+			}
+			if cc := w.Header().Get("Cache-Control"); cc != immutableCacheControl {
+				t.Fatalf("unexpected Cache-Control %q", cc)
+			}
+			if lm := w.Header().Get("Last-Modified"); lm != "" {
+				t.Fatalf("unexpected Last-Modified %q", lm)
+			}
+		})
+	}
+}
+
+func TestETagRemote(t *testing.T) {
+	storage, err := remote.NewStorage(context.Background(), "mem://"+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := NewHttpFS(t.TempDir(), WithRemoteStorage(storage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+	h := NewEncodingHandler(fsys)
+
+	// Для произвольных имён используется ETag удалённого хранилища
+	if err := storage.Uploader().Upload("page.html", strings.NewReader("<html></html>")); err != nil {
+		t.Fatal(err)
+	}
+	info, err := storage.Stat("page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := `"` + strings.Trim(info.ETag(), `"`) + `"`
+	w := do(h, http.MethodGet, "/page.html", nil, nil)
+	if w.Header().Get("ETag") != etag || w.Header().Get("Cache-Control") != "" {
+		t.Fatalf("unexpected cache headers %v", w.Header())
+	}
+	if w := do(h, http.MethodGet, "/page.html", nil, map[string]string{"If-None-Match": etag}); w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", w.Code)
+	}
+
+	// Файл, существующий только в сжатом виде, распаковывается на лету с ETag исходного файла
+	fi, err := fsys.Create(context.Background(), strings.NewReader("only gzip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("only gzip"))
+	zw.Close()
+	if err := storage.Uploader().Upload(fi.Name+".gz", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Remove(fi.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	w = do(h, http.MethodGet, "/"+fi.Name, nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "only gzip" || w.Header().Get("ETag") != `"`+fi.Name+`"` {
+		t.Fatalf("unexpected response %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+	if w := do(h, http.MethodGet, "/"+fi.Name, nil, map[string]string{"If-None-Match": `"` + fi.Name + `"`}); w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304, got %d", w.Code)
+	}
+}
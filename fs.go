@@ -0,0 +1,257 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Убеждаемся в том, что мы всегда реализуем интерфейсы fs.FS.
+var (
+	_ fs.FS          = localFS{}
+	_ fs.StatFS      = localFS{}
+	_ fs.ReadDirFS   = localFS{}
+	_ fs.ReadFileFS  = localFS{}
+	_ fs.ReadDirFile = (*dirFile)(nil)
+)
+
+// FS возвращает представление хранилища в виде fs.FS, например для fs.WalkDir или http.FS.
+// Файлы хранилища находятся в корневом каталоге под своими именами, подкаталогов нет.
+// Файлы с истёкшим сроком хранения не видны, служебные файлы и фрагменты
+// больших файлов (см. WithChunking) не перечисляются.
+func (s *LocalStorage) FS() fs.FS {
+	return localFS{s}
+}
+
+// localFS реализует fs.FS поверх LocalStorage.
+type localFS struct {
+	s *LocalStorage
+}
+
+// Open реализует метод fs.FS.
+func (f localFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		info, err := f.rootInfo()
+		if err != nil {
+			return nil, err
+		}
+		entries, err := f.readRoot()
+		if err != nil {
+			return nil, err
+		}
+		return &dirFile{info: info, entries: entries}, nil
+	}
+
+	file, err := f.open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &localFile{File: file, info: namedInfo{info, name}}, nil
+}
+
+// Stat реализует метод fs.StatFS.
+func (f localFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return f.rootInfo()
+	}
+	return f.stat(name)
+}
+
+// ReadDir реализует метод fs.ReadDirFS.
+func (f localFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return f.readRoot()
+	}
+	if _, err := f.stat(name); err != nil {
+		return nil, err
+	}
+	return nil, &fs.PathError{Op: "readdir", Path: name, Err: ErrNotDir}
+}
+
+// ReadFile реализует метод fs.ReadFileFS.
+func (f localFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: ErrIsDir}
+	}
+
+	file, err := f.open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// open открывает файл хранилища. Имена, которые не могут быть именами файлов хранилища
+// (в том числе пути с подкаталогами), считаются отсутствующими.
+func (f localFS) open(name string) (File, error) {
+	if strings.Contains(name, "/") {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	file, err := f.s.Open(name)
+	if err != nil {
+		if errors.Is(err, ErrInvalidName) || errors.Is(err, fs.ErrNotExist) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// stat возвращает сведения о файле хранилища с размером исходного содержимого.
+// Обращение к файлу не отмечается, чтобы обход хранилища не влиял на очистку.
+func (f localFS) stat(name string) (fs.FileInfo, error) {
+	if strings.Contains(name, "/") {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	info, err := f.s.statContent(name)
+	if err != nil {
+		if errors.Is(err, ErrInvalidName) || errors.Is(err, fs.ErrNotExist) {
+			return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+		}
+		return nil, err
+	}
+	return namedInfo{info, name}, nil
+}
+
+// rootInfo возвращает сведения о корневом каталоге.
+func (f localFS) rootInfo() (fs.FileInfo, error) {
+	info, err := os.Stat(f.s.rootDir)
+	if err != nil {
+		return nil, err
+	}
+	return namedInfo{info, "."}, nil
+}
+
+// readRoot перечисляет файлы хранилища. Фрагменты, которые сохранены только в составе
+// других файлов, не перечисляются. Сведения о файлах читаются при обращении к ним.
+func (f localFS) readRoot() ([]fs.DirEntry, error) {
+	now := time.Now()
+	var entries []fs.DirEntry
+	err := f.s.walkBlobs(context.Background(), func(name, path string, info fs.FileInfo) error {
+		m, err := f.s.readMeta(name)
+		if err != nil || m.Chunk || m.expired(now) {
+			return nil
+		}
+		entries = append(entries, &localDirEntry{fs: f, name: name})
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// localFile описывает открытый файл хранилища с именем, под которым он был открыт.
+type localFile struct {
+	File
+	info fs.FileInfo
+}
+
+func (f *localFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// localDirEntry описывает файл хранилища в корневом каталоге.
+type localDirEntry struct {
+	fs   localFS
+	name string
+}
+
+func (e *localDirEntry) Name() string               { return e.name }
+func (e *localDirEntry) IsDir() bool                { return false }
+func (e *localDirEntry) Type() fs.FileMode          { return 0 }
+func (e *localDirEntry) Info() (fs.FileInfo, error) { return e.fs.stat(e.name) }
+
+// namedInfo подменяет имя в сведениях о файле.
+type namedInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (fi namedInfo) Name() string { return fi.name }
+
+// dirFile описывает открытый каталог. Содержимое каталога фиксируется при открытии.
+type dirFile struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dirFile) Close() error               { return nil }
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: ErrIsDir}
+}
+
+// Seek поддерживает только возврат к началу каталога, как этого требует http.File.
+func (d *dirFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		d.offset = 0
+		return 0, nil
+	}
+	return 0, &fs.PathError{Op: "seek", Path: d.info.Name(), Err: ErrIsDir}
+}
+
+// ReadDir реализует метод fs.ReadDirFile.
+func (d *dirFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	d.offset += count
+	return rest[:count], nil
+}
+
+// Readdir реализует метод http.File.
+func (d *dirFile) Readdir(count int) ([]fs.FileInfo, error) {
+	entries, err := d.ReadDir(count)
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, ierr := e.Info()
+		if ierr != nil {
+			// Файл мог быть удалён после открытия каталога
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, err
+}
+
+// dirEntries преобразует сведения о файлах в элементы каталога.
+func dirEntries(infos []fs.FileInfo) []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	return entries
+}
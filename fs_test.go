@@ -0,0 +1,166 @@
+package filestore
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io/fs"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// countingTracker учитывает обращения к файлам в памяти.
+type countingTracker struct {
+	mu      sync.Mutex
+	touches map[string]int
+}
+
+func (t *countingTracker) Touch(name string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.touches[name]++
+}
+
+func (t *countingTracker) LastAccess(name string) (time.Time, bool) { return time.Time{}, false }
+func (t *countingTracker) Forget(name string)                       {}
+func (t *countingTracker) Close() error                             { return nil }
+
+func (t *countingTracker) count(name string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.touches[name]
+}
+
+func TestLocalFS(t *testing.T) {
+	tracker := &countingTracker{touches: make(map[string]int)}
+	s := newTestStorage(t, WithAccessTracker(tracker), WithCompression(CompressionPolicy{}), WithEncryption(newTestKeyring(t, "k1")))
+
+	var names []string
+	for _, data := range []string{"plain", strings.Repeat("compressible ", 1000), ""} {
+		names = append(names, createBlob(t, s, []byte(data)).Name)
+	}
+	expired := createBlob(t, s, []byte("expired"), WithExpiresAt(time.Now().Add(-time.Second)))
+
+	fsys := s.FS()
+	if err := fstest.TestFS(fsys, names...); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(fsys, expired.Name); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist for expired file, got %v", err)
+	}
+
+	// Перечисление и сведения о файлах не считаются обращениями
+	before := tracker.count(names[1])
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.Name() == names[1] && info.Size() != int64(len("compressible "))*1000 {
+			t.Fatalf("expected size of original content, got %d", info.Size())
+		}
+	}
+	if _, err := fs.Stat(fsys, names[1]); err != nil {
+		t.Fatal(err)
+	}
+	if got := tracker.count(names[1]); got != before {
+		t.Fatalf("stat touched the file %d times", got-before)
+	}
+	if _, err := fs.ReadFile(fsys, names[1]); err != nil {
+		t.Fatal(err)
+	}
+	if got := tracker.count(names[1]); got != before+1 {
+		t.Fatalf("expected read to touch the file once, got %d", got-before)
+	}
+}
+
+// Фрагменты больших файлов не перечисляются, пока то же содержимое не сохранено самостоятельно.
+func TestLocalFSChunks(t *testing.T) {
+	s := newTestStorage(t, WithChunking(testChunkingPolicy))
+
+	data := make([]byte, 100<<10)
+	rand.Read(data)
+	names := []string{createBlob(t, s, data).Name, createBlob(t, s, []byte("small")).Name}
+	if chunks := chunkNames(t, s, names[0]); len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+
+	listed := func() []string {
+		t.Helper()
+		entries, err := fs.ReadDir(s.FS(), ".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name())
+		}
+		return got
+	}
+	sort.Strings(names)
+	if got := listed(); !slices.Equal(got, names) {
+		t.Fatalf("expected %v, got %v", names, got)
+	}
+	if err := fstest.TestFS(s.FS(), names...); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := newChunker(bytes.NewReader(data), &testChunkingPolicy).next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = append(names, createBlob(t, s, first).Name)
+	sort.Strings(names)
+	if got := listed(); !slices.Equal(got, names) {
+		t.Fatalf("expected %v, got %v", names, got)
+	}
+}
+
+func TestCatalogFS(t *testing.T) {
+	s := newTestStorage(t)
+	c := newTestCatalog(t, s)
+
+	catalogPut(t, c, "/docs/report.txt", "report")
+	catalogPut(t, c, "/docs/copy.txt", "report")
+	catalogPut(t, c, "/readme.md", "# readme")
+	if err := c.Mkdir("/empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fstest.TestFS(c, "docs/report.txt", "docs/copy.txt", "readme.md", "empty"); err != nil {
+		t.Fatal(err)
+	}
+
+	h := http.FileServer(c.HTTPFileSystem())
+	w := do(h, http.MethodGet, "/docs/report.txt", nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "report" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+	w = do(h, http.MethodGet, "/docs/", nil, nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "copy.txt") || !strings.Contains(w.Body.String(), "report.txt") {
+		t.Fatalf("unexpected listing %d %q", w.Code, w.Body.String())
+	}
+	if w := do(h, http.MethodGet, "/missing.txt", nil, nil); w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", w.Code)
+	}
+
+	// Файлы хранилища доступны через http.FS под своими именами
+	blob, err := c.Lookup("/readme.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = do(http.FileServer(http.FS(s.FS())), http.MethodGet, "/"+blob, nil, nil)
+	if w.Code != http.StatusOK || w.Body.String() != "# readme" {
+		t.Fatalf("unexpected response %d %q", w.Code, w.Body.String())
+	}
+}
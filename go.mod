@@ -4,7 +4,10 @@ go 1.25.4
 
 replace github.com/tenrok/filestore/remote => ./remote
 
-require github.com/minio/minio-go/v7 v7.0.100
+require (
+	github.com/minio/minio-go/v7 v7.0.100
+	golang.org/x/sys v0.39.0
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -23,7 +26,6 @@ require (
 	go.yaml.in/yaml/v3 v3.0.4 // indirect
 	golang.org/x/crypto v0.46.0 // indirect
 	golang.org/x/net v0.48.0 // indirect
-	golang.org/x/sys v0.39.0 // indirect
 	golang.org/x/text v0.32.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
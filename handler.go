@@ -0,0 +1,439 @@
+package filestore
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Operation описывает операцию, для которой запрашивается авторизация.
+type Operation string
+
+const (
+	OpUpload   Operation = "upload"
+	OpDownload Operation = "download"
+	OpDelete   Operation = "delete"
+)
+
+// ErrUnauthorized возвращается Authorizer, если запрос не аутентифицирован.
+// Остальные ошибки Authorizer означают отказ в доступе.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Authorizer проверяет право на выполнение операции над файлом name.
+// Для загрузки имя файла ещё неизвестно и передаётся пустым.
+type Authorizer func(r *http.Request, op Operation, name string) error
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс http.Handler.
+var _ http.Handler = (*Handler)(nil)
+
+// Handler реализует HTTP API для загрузки, получения и удаления файлов HttpFS:
+//
+//	POST   /blobs        загрузка файла (тело запроса или multipart/form-data)
+//	GET    /blobs/{name} получение файла (также HEAD)
+//	DELETE /blobs/{name} удаление файла
+//	HEAD   /blobs/by-digest/{alg}/{hex} поиск файла по хеш-сумме содержимого (также GET)
+//
+// При загрузке тела запроса его содержимое сверяется с заголовками Content-MD5, Digest и Repr-Digest;
+// при несовпадении файл не сохраняется и возвращается 400.
+// Ошибки возвращаются в формате {"error": {"code": 404, "message": "..."}}. Если загрузка
+// multipart/form-data прервалась на одном из файлов, в ответ добавляется поле "files" с уже
+// сохранёнными файлами: они остаются в хранилище и учтены в квоте, клиент может удалить их
+// запросами DELETE или не загружать повторно.
+type Handler struct {
+	fs            *HttpFS
+	maxUploadSize int64
+	authorize     Authorizer
+	namespace     func(r *http.Request) string
+}
+
+type HandlerOption func(*Handler)
+
+// WithMaxUploadSize ограничивает размер загружаемых данных.
+func WithMaxUploadSize(n int64) HandlerOption {
+	return func(h *Handler) {
+		h.maxUploadSize = n
+	}
+}
+
+// WithAuthorizer задаёт функцию проверки прав доступа.
+func WithAuthorizer(authorize Authorizer) HandlerOption {
+	return func(h *Handler) {
+		h.authorize = authorize
+	}
+}
+
+// WithNamespaceFunc задаёт функцию, определяющую пространство имён (например, арендатора),
+// от имени которого сохраняются загружаемые файлы. Превышение квоты пространства имён
+// возвращается с кодом 413, если файл больше всей квоты, и 507 в остальных случаях.
+// DELETE исключает файл из пространства имён запроса, а сам файл удаляется, когда
+// на него не ссылается ни одно пространство имён.
+func WithNamespaceFunc(fn func(r *http.Request) string) HandlerOption {
+	return func(h *Handler) {
+		h.namespace = fn
+	}
+}
+
+// NewHandler создаёт обработчик HTTP API для файловой системы f.
+func NewHandler(f *HttpFS, opts ...HandlerOption) *Handler {
+	h := &Handler{fs: f}
+
+	for _, opt := range opts {
+		if opt != nil {
+			opt(h)
+		}
+	}
+
+	return h
+}
+
+// ServeHTTP реализует метод http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	switch {
+	case path == "/blobs" || path == "/blobs/":
+		if r.Method != http.MethodPost {
+			h.methodNotAllowed(w, "POST")
+			return
+		}
+		h.upload(w, r)
+
+	case strings.HasPrefix(path, "/blobs/by-digest/"):
+		if r.Method != http.MethodHead && r.Method != http.MethodGet {
+			h.methodNotAllowed(w, "GET, HEAD")
+			return
+		}
+		alg, sum, _ := strings.Cut(strings.TrimPrefix(path, "/blobs/by-digest/"), "/")
+		h.lookup(w, r, alg+":"+sum)
+
+	case strings.HasPrefix(path, "/blobs/"):
+		name := strings.TrimPrefix(path, "/blobs/")
+		if strings.Contains(name, "/") {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			h.download(w, r, name)
+		case http.MethodDelete:
+			h.delete(w, r, name)
+		default:
+			h.methodNotAllowed(w, "GET, HEAD, DELETE")
+		}
+
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// upload сохраняет тело запроса или файлы из multipart/form-data.
+func (h *Handler) upload(w http.ResponseWriter, r *http.Request) {
+	if !h.allow(w, r, OpUpload, "") {
+		return
+	}
+
+	if h.maxUploadSize > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadSize)
+	}
+
+	mediatype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediatype != "multipart/form-data" {
+		expect, err := parseExpect(r.Header)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		fi, err := h.fs.CreateVerified(r.Context(), r.Body, expect, h.createOptions(r)...)
+		if err != nil {
+			writeErr(w, err)
+			return
+		}
+		w.Header().Set("Location", h.location(r, fi.Name))
+		writeJSON(w, http.StatusCreated, fi)
+		return
+	}
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	files := []*FileInfo{}
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			writeUploadErr(w, err, files)
+			return
+		}
+
+		// Поля формы без файлов пропускаем
+		if part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		fi, err := h.fs.Create(r.Context(), part, h.createOptions(r)...)
+		part.Close()
+		if err != nil {
+			writeUploadErr(w, err, files)
+			return
+		}
+		files = append(files, fi)
+	}
+
+	if len(files) == 0 {
+		writeError(w, http.StatusBadRequest, "no files in multipart form")
+		return
+	}
+	writeJSON(w, http.StatusCreated, files)
+}
+
+// createOptions возвращает опции сохранения файлов для запроса r.
+func (h *Handler) createOptions(r *http.Request) []CreateOption {
+	if ns := h.requestNamespace(r); ns != "" {
+		return []CreateOption{WithNamespace(ns)}
+	}
+	return nil
+}
+
+// requestNamespace возвращает пространство имён запроса r или пустую строку.
+func (h *Handler) requestNamespace(r *http.Request) string {
+	if h.namespace == nil {
+		return ""
+	}
+	return h.namespace(r)
+}
+
+// lookup ищет файл по хеш-сумме, позволяя клиенту не загружать уже сохранённое содержимое.
+// Ответ содержит ссылку на файл в Location и информацию о нём в теле (для GET).
+// Найденный файл учитывается в квоте пространства имён запроса, как при загрузке.
+func (h *Handler) lookup(w http.ResponseWriter, r *http.Request, digest string) {
+	if !h.allow(w, r, OpUpload, "") {
+		return
+	}
+
+	fi, err := h.fs.Lookup(digest, h.createOptions(r)...)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	w.Header().Set("Location", "../../"+fi.Name)
+	w.Header().Set("ETag", `"`+fi.Name+`"`)
+	writeJSON(w, http.StatusOK, fi)
+}
+
+// download отдаёт файл с поддержкой Range и согласованием Content-Encoding.
+func (h *Handler) download(w http.ResponseWriter, r *http.Request, name string) {
+	if !h.allow(w, r, OpDownload, name) {
+		return
+	}
+
+	if err := serveFile(w, r, h.fs, name); err != nil {
+		writeErr(w, err)
+	}
+}
+
+// delete удаляет файл. Если задано пространство имён запроса, файл лишь исключается из него
+// и удаляется, только когда больше не принадлежит ни одному пространству имён.
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, name string) {
+	if !h.allow(w, r, OpDelete, name) {
+		return
+	}
+
+	remove := h.fs.Remove
+	if ns := h.requestNamespace(r); ns != "" {
+		remove = func(name string) error { return h.fs.Release(ns, name) }
+	}
+	if err := remove(name); err != nil {
+		writeErr(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allow проверяет права доступа и при отказе записывает ответ с ошибкой.
+func (h *Handler) allow(w http.ResponseWriter, r *http.Request, op Operation, name string) bool {
+	if h.authorize == nil {
+		return true
+	}
+
+	err := h.authorize(r, op, name)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, ErrUnauthorized) {
+		writeError(w, http.StatusUnauthorized, err.Error())
+	} else {
+		writeError(w, http.StatusForbidden, err.Error())
+	}
+	return false
+}
+
+func (h *Handler) methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// location возвращает ссылку на загруженный файл относительно пути запроса.
+func (h *Handler) location(r *http.Request, name string) string {
+	if strings.HasSuffix(r.URL.Path, "/") {
+		return name
+	}
+	return "blobs/" + name
+}
+
+// parseExpect извлекает ожидаемые хеш-суммы тела запроса из заголовков Content-MD5,
+// Digest (RFC 3230) и Repr-Digest (RFC 9530). Неизвестные алгоритмы игнорируются.
+func parseExpect(header http.Header) (Expect, error) {
+	var expect Expect
+
+	set := func(alg, value string) error {
+		var dst *string
+		var size int
+		switch alg {
+		case "md5":
+			dst, size = &expect.MD5, md5.Size
+		case "sha-256":
+			dst, size = &expect.SHA256, sha256.Size
+		default:
+			return nil
+		}
+
+		sum, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || len(sum) != size {
+			return fmt.Errorf("invalid %s digest", alg)
+		}
+
+		v := hex.EncodeToString(sum)
+		if *dst != "" && *dst != v {
+			return fmt.Errorf("conflicting %s digests", alg)
+		}
+		*dst = v
+		return nil
+	}
+
+	if v := header.Get("Content-MD5"); v != "" {
+		if err := set("md5", strings.TrimSpace(v)); err != nil {
+			return Expect{}, err
+		}
+	}
+
+	// Digest: md5=base64, sha-256=base64
+	for _, field := range header.Values("Digest") {
+		for part := range strings.SplitSeq(field, ",") {
+			alg, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if !ok {
+				return Expect{}, errors.New("invalid Digest header")
+			}
+			if err := set(strings.ToLower(alg), value); err != nil {
+				return Expect{}, err
+			}
+		}
+	}
+
+	// Repr-Digest: sha-256=:base64:
+	for _, field := range header.Values("Repr-Digest") {
+		for part := range strings.SplitSeq(field, ",") {
+			alg, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+			if !ok || len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+				return Expect{}, errors.New("invalid Repr-Digest header")
+			}
+			if err := set(strings.ToLower(alg), value[1:len(value)-1]); err != nil {
+				return Expect{}, err
+			}
+		}
+	}
+
+	return expect, nil
+}
+
+// errorStatus возвращает код ответа HTTP для ошибки.
+func errorStatus(err error) int {
+	var maxBytesErr *http.MaxBytesError
+	var quotaErr *QuotaExceededError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.As(err, &quotaErr) && quotaErr.Resource == "bytes" && quotaErr.Requested > quotaErr.Limit:
+		// Файл не поместится в квоту, даже если освободить её целиком
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, ErrInvalidName):
+		return http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return http.StatusForbidden
+	case errors.Is(err, ErrDigestMismatch), errors.Is(err, ErrInvalidDigest):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrInUse), errors.Is(err, ErrPinned), errors.Is(err, ErrOnHold),
+		errors.Is(err, ErrOffsetMismatch),
+		errors.Is(err, ErrUploadIncomplete), errors.Is(err, ErrUploadCommitted):
+		return http.StatusConflict
+	case errors.Is(err, ErrUploadExpired):
+		return http.StatusGone
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// errorBody описывает ошибку в ответе.
+type errorBody struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// errorResponse описывает ответ с ошибкой. Files содержит файлы, сохранённые до ошибки.
+type errorResponse struct {
+	Error errorBody   `json:"error"`
+	Files []*FileInfo `json:"files,omitempty"`
+}
+
+// writeErr записывает ответ с ошибкой. Текст внутренних ошибок клиенту не передаётся.
+func writeErr(w http.ResponseWriter, err error) {
+	writeUploadErr(w, err, nil)
+}
+
+// writeUploadErr записывает ответ с ошибкой загрузки и файлами files, сохранёнными до неё.
+func writeUploadErr(w http.ResponseWriter, err error, files []*FileInfo) {
+	code := errorStatus(err)
+	message := err.Error()
+	if code == http.StatusInternalServerError {
+		message = http.StatusText(code)
+	}
+	writeErrorResponse(w, code, errorResponse{Error: errorBody{Code: code, Message: message}, Files: files})
+}
+
+// writeError записывает ответ с ошибкой в формате JSON.
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeErrorResponse(w, code, errorResponse{Error: errorBody{Code: code, Message: message}})
+}
+
+// writeErrorResponse записывает ответ с ошибкой resp.
+func writeErrorResponse(w http.ResponseWriter, code int, resp errorResponse) {
+	// Заголовки, выставленные для успешного ответа, к ошибке не относятся
+	w.Header().Del("Content-Encoding")
+	w.Header().Del("Content-Length")
+	writeJSON(w, code, resp)
+}
+
+// writeJSON записывает ответ в формате JSON.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
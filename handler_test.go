@@ -0,0 +1,227 @@
+package filestore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestHandler(t *testing.T, opts ...HandlerOption) (*Handler, *HttpFS) {
+	t.Helper()
+
+	fsys, err := NewHttpFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fsys.Close() })
+	return NewHandler(fsys, opts...), fsys
+}
+
+// do выполняет запрос к обработчику h.
+func do(h http.Handler, method, target string, body []byte, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, bytes.NewReader(body))
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// decodeJSON разбирает тело ответа w в v.
+func decodeJSON(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		t.Fatalf("unexpected Content-Type %q", ct)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid JSON %q: %v", w.Body.String(), err)
+	}
+}
+
+// assertError проверяет код ответа и формат ошибки.
+func assertError(t *testing.T, w *httptest.ResponseRecorder, code int) {
+	t.Helper()
+
+	if w.Code != code {
+		t.Fatalf("expected status %d, got %d: %s", code, w.Code, w.Body.String())
+	}
+	var body struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	decodeJSON(t, w, &body)
+	if body.Error.Code != code || body.Error.Message == "" {
+		t.Fatalf("unexpected error body %s", w.Body.String())
+	}
+}
+
+func TestHandlerUploadDownloadDelete(t *testing.T) {
+	h, _ := newTestHandler(t)
+	data := []byte("hello handler")
+
+	w := do(h, http.MethodPost, "/blobs", data, nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var fi FileInfo
+	decodeJSON(t, w, &fi)
+	if fi.Size != int64(len(data)) || fi.Name == "" {
+		t.Fatalf("unexpected file info %+v", fi)
+	}
+	if loc := w.Header().Get("Location"); loc != "blobs/"+fi.Name {
+		t.Fatalf("unexpected Location %q", loc)
+	}
+	if w := do(h, http.MethodPost, "/blobs/", data, nil); w.Header().Get("Location") != fi.Name {
+		t.Fatalf("unexpected Location %q", w.Header().Get("Location"))
+	}
+
+	w = do(h, http.MethodGet, "/blobs/"+fi.Name, nil, nil)
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), data) {
+		t.Fatalf("unexpected download %d %q", w.Code, w.Body.String())
+	}
+	w = do(h, http.MethodHead, "/blobs/"+fi.Name, nil, nil)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "13" {
+		t.Fatalf("unexpected HEAD response %d %v", w.Code, w.Header())
+	}
+	w = do(h, http.MethodGet, "/blobs/"+fi.Name, nil, map[string]string{"Range": "bytes=6-"})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "handler" {
+		t.Fatalf("unexpected range response %d %q", w.Code, w.Body.String())
+	}
+
+	if w := do(h, http.MethodDelete, "/blobs/"+fi.Name, nil, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	assertError(t, do(h, http.MethodGet, "/blobs/"+fi.Name, nil, nil), http.StatusNotFound)
+	assertError(t, do(h, http.MethodDelete, "/blobs/"+fi.Name, nil, nil), http.StatusNotFound)
+}
+
+func TestHandlerMultipart(t *testing.T) {
+	h, fsys := newTestHandler(t)
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("comment", "ignored")
+	for _, content := range []string{"first file", "second file"} {
+		part, _ := mw.CreateFormFile("file", content+".txt")
+		part.Write([]byte(content))
+	}
+	mw.Close()
+
+	w := do(h, http.MethodPost, "/blobs", body.Bytes(), map[string]string{"Content-Type": mw.FormDataContentType()})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var files []FileInfo
+	decodeJSON(t, w, &files)
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files, got %d", len(files))
+	}
+	for i, content := range []string{"first file", "second file"} {
+		if got := readBlob(t, fsys.LocalStorage(), files[i].Name); string(got) != content {
+			t.Fatalf("expected %q, got %q", content, got)
+		}
+	}
+
+	body.Reset()
+	mw = multipart.NewWriter(&body)
+	mw.WriteField("comment", "no files")
+	mw.Close()
+	w = do(h, http.MethodPost, "/blobs", body.Bytes(), map[string]string{"Content-Type": mw.FormDataContentType()})
+	assertError(t, w, http.StatusBadRequest)
+}
+
+// Ошибка на одном из файлов multipart/form-data сообщает о файлах, сохранённых до неё.
+func TestHandlerMultipartPartialFailure(t *testing.T) {
+	h, fsys := newTestHandler(t, WithNamespaceFunc(func(r *http.Request) string { return "t1" }))
+	s := fsys.LocalStorage()
+	if err := s.SetQuota("t1", Quota{Objects: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, content := range []string{"stored", "over quota"} {
+		part, _ := mw.CreateFormFile("file", content+".txt")
+		part.Write([]byte(content))
+	}
+	mw.Close()
+
+	w := do(h, http.MethodPost, "/blobs", body.Bytes(), map[string]string{"Content-Type": mw.FormDataContentType()})
+	assertError(t, w, http.StatusInsufficientStorage)
+	var resp struct {
+		Files []FileInfo `json:"files"`
+	}
+	decodeJSON(t, w, &resp)
+	if len(resp.Files) != 1 || string(readBlob(t, s, resp.Files[0].Name)) != "stored" {
+		t.Fatalf("unexpected stored files %+v", resp.Files)
+	}
+
+	// Клиент освобождает квоту, удаляя сохранённые файлы
+	if w := do(h, http.MethodDelete, "/blobs/"+resp.Files[0].Name, nil, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if u, _ := s.Usage("t1"); u != (QuotaUsage{}) {
+		t.Fatalf("quota is not released: %+v", u)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	h, _ := newTestHandler(t, WithMaxUploadSize(10))
+
+	assertError(t, do(h, http.MethodPost, "/blobs", bytes.Repeat([]byte("x"), 11), nil), http.StatusRequestEntityTooLarge)
+	assertError(t, do(h, http.MethodGet, "/other", nil, nil), http.StatusNotFound)
+	assertError(t, do(h, http.MethodGet, "/blobs/a/b", nil, nil), http.StatusNotFound)
+	assertError(t, do(h, http.MethodGet, "/blobs/short", nil, nil), http.StatusNotFound)
+
+	w := do(h, http.MethodGet, "/blobs", nil, nil)
+	assertError(t, w, http.StatusMethodNotAllowed)
+	if allow := w.Header().Get("Allow"); allow != "POST" {
+		t.Fatalf("unexpected Allow %q", allow)
+	}
+	w = do(h, http.MethodPut, "/blobs/name", nil, nil)
+	assertError(t, w, http.StatusMethodNotAllowed)
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, DELETE" {
+		t.Fatalf("unexpected Allow %q", allow)
+	}
+}
+
+func TestHandlerAuthorizer(t *testing.T) {
+	var calls []string
+	h, fsys := newTestHandler(t, WithAuthorizer(func(r *http.Request, op Operation, name string) error {
+		calls = append(calls, string(op)+":"+name)
+		switch r.Header.Get("Authorization") {
+		case "":
+			return ErrUnauthorized
+		case "reader":
+			if op != OpDownload {
+				return errors.New("read only")
+			}
+		}
+		return nil
+	}))
+	fi := createBlob(t, fsys.LocalStorage(), []byte("protected"))
+
+	assertError(t, do(h, http.MethodGet, "/blobs/"+fi.Name, nil, nil), http.StatusUnauthorized)
+	assertError(t, do(h, http.MethodPost, "/blobs", []byte("x"), map[string]string{"Authorization": "reader"}), http.StatusForbidden)
+	assertError(t, do(h, http.MethodDelete, "/blobs/"+fi.Name, nil, map[string]string{"Authorization": "reader"}), http.StatusForbidden)
+	if w := do(h, http.MethodGet, "/blobs/"+fi.Name, nil, map[string]string{"Authorization": "reader"}); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	if w := do(h, http.MethodPost, "/blobs", []byte("x"), map[string]string{"Authorization": "writer"}); w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+
+	want := []string{"download:" + fi.Name, "upload:", "delete:" + fi.Name, "download:" + fi.Name, "upload:"}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Fatalf("unexpected authorizer calls %v", calls)
+	}
+}
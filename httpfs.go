@@ -1,7 +1,11 @@
 package filestore
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"net/http"
+	"os"
 	"strings"
 
 	"github.com/tenrok/filestore/remote"
@@ -12,6 +16,7 @@ var _ http.FileSystem = (*HttpFS)(nil)
 
 type HttpFS struct {
 	localStorage  *LocalStorage
+	localOpts     []LocalStorageOption
 	remoteStorage remote.Storage
 }
 
@@ -24,15 +29,16 @@ func WithRemoteStorage(storage remote.Storage) HttpFSOption {
 	}
 }
 
-// NewHttpFS создаёт новый экземпляр файловой системы.
-func NewHttpFS(rootDir string, opts ...HttpFSOption) (*HttpFS, error) {
-	localStorage, err := NewLocalStorage(rootDir)
-	if err != nil {
-		return nil, err
+// WithLocalStorageOptions задаёт параметры локального хранилища.
+func WithLocalStorageOptions(opts ...LocalStorageOption) HttpFSOption {
+	return func(f *HttpFS) {
+		f.localOpts = append(f.localOpts, opts...)
 	}
+}
 
+// NewHttpFS создаёт новый экземпляр файловой системы.
+func NewHttpFS(rootDir string, opts ...HttpFSOption) (*HttpFS, error) {
 	f := &HttpFS{}
-	f.localStorage = localStorage
 
 	for _, opt := range opts {
 		if opt != nil {
@@ -40,9 +46,44 @@ func NewHttpFS(rootDir string, opts ...HttpFSOption) (*HttpFS, error) {
 		}
 	}
 
+	localStorage, err := NewLocalStorage(rootDir, f.localOpts...)
+	if err != nil {
+		return nil, err
+	}
+	f.localStorage = localStorage
+
 	return f, nil
 }
 
+// Create сохраняет файл в локальном хранилище. Если задано удалённое хранилище,
+// файл также загружается в него под тем же именем.
+func (f *HttpFS) Create(ctx context.Context, r io.Reader, opts ...CreateOption) (*FileInfo, error) {
+	return f.CreateVerified(ctx, r, Expect{}, opts...)
+}
+
+// CreateVerified сохраняет файл так же, как Create, предварительно проверив его содержимое.
+// Если содержимое не совпадает с ожидаемым, возвращается *DigestMismatchError.
+func (f *HttpFS) CreateVerified(ctx context.Context, r io.Reader, expect Expect, opts ...CreateOption) (*FileInfo, error) {
+	fi, err := f.localStorage.CreateVerified(ctx, r, expect, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if f.remoteStorage == nil {
+		return fi, nil
+	}
+
+	file, err := f.localStorage.Open(fi.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := f.remoteStorage.Uploader().Upload(fi.Name, file, remote.WithContentType(fi.Mimetype)); err != nil {
+		return nil, err
+	}
+	return fi, nil
+}
+
 // Open реализует метод http.FileSystem.
 func (f *HttpFS) Open(name string) (http.File, error) {
 	name = strings.TrimPrefix(name, "/")
@@ -52,15 +93,82 @@ func (f *HttpFS) Open(name string) (http.File, error) {
 	return f.localStorage.Open(name)
 }
 
+// OpenEncoded открывает сжатое представление файла. Для локального хранилища это сжатое
+// содержимое самого файла, для удалённого — объект-двойник с расширением алгоритма (например, ".gz").
+func (f *HttpFS) OpenEncoded(name, coding string) (http.File, error) {
+	name = strings.TrimPrefix(name, "/")
+	if f.remoteStorage != nil {
+		ext, ok := encodingExt[coding]
+		if !ok {
+			return nil, ErrNotEncoded
+		}
+		// Объект может загружаться лениво, поэтому проверяем его наличие сразу
+		file, err := f.remoteStorage.Open(name + ext)
+		if err == nil {
+			if _, err = file.Stat(); err != nil {
+				file.Close()
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotEncoded, err)
+		}
+		return file, nil
+	}
+	return f.localStorage.OpenEncoded(name, coding)
+}
+
+// Lookup ищет файл по хеш-сумме содержимого (см. LocalStorage.Lookup). Если задано
+// удалённое хранилище, дополнительно проверяется наличие файла в нём; квота пространства
+// имён из opts учитывается только для найденного там файла.
+func (f *HttpFS) Lookup(digest string, opts ...CreateOption) (*FileInfo, error) {
+	if f.remoteStorage == nil {
+		return f.localStorage.Lookup(digest, opts...)
+	}
+
+	fi, err := f.localStorage.Lookup(digest)
+	if err != nil {
+		return nil, err
+	}
+	// Любую ошибку считаем отсутствием файла: клиент просто загрузит его заново
+	if ok, err := f.remoteStorage.IsExists(fi.Name); err != nil || !ok {
+		return nil, os.ErrNotExist
+	}
+	if o := newCreateOptions(opts); o.namespace != "" {
+		if _, err := f.localStorage.charge(o.namespace, fi); err != nil {
+			return nil, err
+		}
+	}
+	return fi, nil
+}
+
 // Remove удаляет файл.
 func (f *HttpFS) Remove(name string) error {
 	name = strings.TrimPrefix(name, "/")
 	if f.remoteStorage != nil {
+		// Защита файлов от удаления задаётся в локальном хранилище
+		if err := f.localStorage.checkRemove(name); err != nil {
+			return err
+		}
 		return f.remoteStorage.Remove(name)
 	}
 	return f.localStorage.Remove(name)
 }
 
+// Release исключает файл name из пространства имён ns (см. LocalStorage.Release) и удаляет
+// его, если файл больше не принадлежит ни одному пространству имён и его можно удалить методом Remove.
+func (f *HttpFS) Release(ns, name string) error {
+	name = strings.TrimPrefix(name, "/")
+	if f.remoteStorage != nil {
+		return f.localStorage.release(ns, name, func(name, _ string) error {
+			return f.remoteStorage.Remove(name)
+		})
+	}
+	return f.localStorage.release(ns, name, f.localStorage.removeBlob)
+}
+
+// Close закрывает локальное хранилище, сохраняя сведения об обращениях к файлам.
+func (f *HttpFS) Close() error { return f.localStorage.Close() }
+
 // LocalStorage возвращает указатель на локальное хранилище.
 func (f *HttpFS) LocalStorage() *LocalStorage { return f.localStorage }
 
@@ -0,0 +1,243 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ImportMode задаёт способ переноса существующего файла в хранилище.
+type ImportMode int
+
+const (
+	// ImportCopy копирует содержимое файла.
+	ImportCopy ImportMode = iota
+
+	// ImportHardlink создаёт жёсткую ссылку на файл. Исходный файл и файл хранилища
+	// становятся одним и тем же файлом, поэтому исходный файл нельзя изменять.
+	ImportHardlink
+
+	// ImportReflink создаёт копию, разделяющую блоки данных с исходным файлом (FICLONE в Linux).
+	ImportReflink
+
+	// ImportMove перемещает файл в хранилище.
+	ImportMove
+)
+
+// String реализует интерфейс fmt.Stringer.
+func (m ImportMode) String() string {
+	switch m {
+	case ImportCopy:
+		return "copy"
+	case ImportHardlink:
+		return "hardlink"
+	case ImportReflink:
+		return "reflink"
+	case ImportMove:
+		return "move"
+	default:
+		return fmt.Sprintf("ImportMode(%d)", int(m))
+	}
+}
+
+// CreateFromPath сохраняет в хранилище существующий файл path без чтения его через io.Reader.
+// Файл переносится способом mode; если он недоступен (например, файл находится на другой
+// файловой системе или она не поддерживает reflink), содержимое копируется.
+// Если файл сохраняется сжатым, зашифрованным или разбитым на фрагменты, перенос служит
+// лишь для подготовки, а хранимый файл создаётся заново.
+func (s *LocalStorage) CreateFromPath(ctx context.Context, path string, mode ImportMode, opts ...CreateOption) (*FileInfo, error) {
+	if mode < ImportCopy || mode > ImportMove {
+		return nil, fmt.Errorf("%w: unknown import mode %v", fs.ErrInvalid, mode)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, &os.PathError{Op: "import", Path: path, Err: fs.ErrInvalid}
+	}
+
+	tmpPath, h, moved, err := s.stage(ctx, path, mode)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpPath)
+
+	// Хеш-суммы считаем по подготовленному файлу, если они не посчитаны при копировании
+	if h == nil {
+		if h, err = hashFile(ctx, tmpPath); err != nil {
+			s.unstage(path, tmpPath, moved)
+			return nil, s.wrapPathError(err, path)
+		}
+	}
+
+	mimetype, size, err := sniffFile(tmpPath)
+	if err != nil {
+		s.unstage(path, tmpPath, moved)
+		return nil, s.wrapPathError(err, path)
+	}
+
+	fi := s.newFileInfo(h, mimetype, size)
+	if err := s.commit(tmpPath, fi, newCreateOptions(opts)); err != nil {
+		s.unstage(path, tmpPath, moved)
+		return nil, err
+	}
+
+	// При перемещении с копированием исходный файл удаляем только после сохранения
+	if mode == ImportMove && !moved {
+		if err := os.Remove(path); err != nil {
+			return fi, err
+		}
+	}
+	return fi, nil
+}
+
+// ImportDir сохраняет в хранилище все обычные файлы каталога dir и его подкаталогов
+// и возвращает соответствие исходных путей именам файлов хранилища. При ошибке
+// возвращается соответствие для уже сохранённых файлов.
+func (s *LocalStorage) ImportDir(ctx context.Context, dir string, mode ImportMode) (map[string]string, error) {
+	names := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		fi, err := s.CreateFromPath(ctx, path, mode)
+		if err != nil {
+			return err
+		}
+		names[path] = fi.Name
+		return nil
+	})
+	return names, err
+}
+
+// stage переносит файл path во временный файл в rootDir способом mode. Если содержимое
+// пришлось копировать, возвращает посчитанные при копировании хеш-суммы; moved сообщает,
+// что исходный файл был перемещён.
+func (s *LocalStorage) stage(ctx context.Context, path string, mode ImportMode) (tmpPath string, h *hasher, moved bool, err error) {
+	tmpfile, err := os.CreateTemp(s.rootDir, "~tmp")
+	if err != nil {
+		return "", nil, false, s.wrapPathError(err, tmpfileName)
+	}
+	tmpPath = tmpfile.Name()
+
+	switch mode {
+	case ImportCopy:
+		// Временный файл открывается заново при копировании
+		tmpfile.Close()
+
+	case ImportMove:
+		tmpfile.Close()
+		if os.Rename(path, tmpPath) == nil {
+			return tmpPath, nil, true, nil
+		}
+
+	case ImportHardlink:
+		tmpfile.Close()
+		os.Remove(tmpPath)
+		if os.Link(path, tmpPath) == nil {
+			return tmpPath, nil, false, nil
+		}
+
+	case ImportReflink:
+		src, err := os.Open(path)
+		if err != nil {
+			tmpfile.Close()
+			os.Remove(tmpPath)
+			return "", nil, false, err
+		}
+		err = reflink(tmpfile, src)
+		src.Close()
+		if err == nil {
+			if err := tmpfile.Close(); err != nil {
+				os.Remove(tmpPath)
+				return "", nil, false, s.wrapPathError(err, tmpfileName)
+			}
+			return tmpPath, nil, false, nil
+		}
+		tmpfile.Close()
+	}
+
+	// Копируем содержимое, одновременно считая хеш-суммы
+	if h, err = s.copyFile(ctx, path, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return "", nil, false, err
+	}
+	return tmpPath, h, false, nil
+}
+
+// unstage возвращает перемещённый файл на прежнее место после неудачного сохранения.
+func (s *LocalStorage) unstage(path, tmpPath string, moved bool) {
+	if moved {
+		os.Rename(tmpPath, path)
+	}
+}
+
+// copyFile копирует файл src в dst и возвращает хеш-суммы содержимого.
+func (s *LocalStorage) copyFile(ctx context.Context, src, dst string) (*hasher, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, s.perm&0666)
+	if err != nil {
+		return nil, s.wrapPathError(err, tmpfileName)
+	}
+
+	h := newHasher()
+	if _, err := copyHashed(ctx, out, in, h); err != nil {
+		out.Close()
+		return nil, err
+	}
+	if err := out.Close(); err != nil {
+		return nil, s.wrapPathError(err, tmpfileName)
+	}
+	return h, nil
+}
+
+// hashFile считает хеш-суммы содержимого файла.
+func hashFile(ctx context.Context, path string) (*hasher, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	h := newHasher()
+	if _, err := copyHashed(ctx, io.Discard, file, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// sniffFile определяет MIME-тип и размер файла.
+func sniffFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	var buf [512]byte
+	n, err := io.ReadFull(file, buf[:])
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", 0, err
+	}
+	return http.DetectContentType(buf[:n]), info.Size(), nil
+}
@@ -0,0 +1,193 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateFromPath(t *testing.T) {
+	data := []byte("imported without a reader")
+
+	cases := []struct {
+		mode ImportMode
+		kept bool // исходный файл остаётся на месте
+	}{
+		{mode: ImportCopy, kept: true},
+		{mode: ImportHardlink, kept: true},
+		{mode: ImportReflink, kept: true},
+		{mode: ImportMove, kept: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.mode.String(), func(t *testing.T) {
+			s := newTestStorage(t)
+			path := filepath.Join(t.TempDir(), "source.txt")
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			fi, err := s.CreateFromPath(context.Background(), path, tc.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Size != int64(len(data)) || string(readBlob(t, s, fi.Name)) != string(data) {
+				t.Fatalf("unexpected file %+v", fi)
+			}
+			if want := createBlob(t, newTestStorage(t), data); fi.Name != want.Name || fi.Mimetype != want.Mimetype {
+				t.Fatalf("expected the same file info as Create, got %+v", fi)
+			}
+
+			src, err := os.Stat(path)
+			if tc.kept != (err == nil) {
+				t.Fatalf("unexpected source state: %v", err)
+			}
+			if tc.mode == ImportHardlink {
+				fullPath, err := s.GetFullPath(fi.Name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				stored, err := os.Stat(fullPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !os.SameFile(src, stored) {
+					t.Fatal("expected stored file to be a hard link to the source")
+				}
+			}
+		})
+	}
+}
+
+// Сжатый файл создаётся заново, а перемещённый исходный файл удаляется.
+func TestCreateFromPathEncoded(t *testing.T) {
+	s := newTestStorage(t, WithCompression(CompressionPolicy{}))
+	data := []byte(strings.Repeat("compress me please ", 1000))
+	path := filepath.Join(t.TempDir(), "source.txt")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := s.CreateFromPath(context.Background(), path, ImportMove)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(readBlob(t, s, fi.Name)) != string(data) || string(readStored(t, s, fi.Name)) == string(data) {
+		t.Fatal("expected compressed file")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected source to be removed, got %v", err)
+	}
+}
+
+func TestCreateFromPathErrors(t *testing.T) {
+	s := newTestStorage(t)
+	dir := t.TempDir()
+
+	if _, err := s.CreateFromPath(context.Background(), dir, ImportCopy); !errors.Is(err, fs.ErrInvalid) {
+		t.Fatalf("expected fs.ErrInvalid, got %v", err)
+	}
+	if _, err := s.CreateFromPath(context.Background(), filepath.Join(dir, "missing"), ImportMove); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+	if _, err := s.CreateFromPath(context.Background(), filepath.Join(dir, "missing"), ImportMode(42)); !errors.Is(err, fs.ErrInvalid) {
+		t.Fatalf("expected fs.ErrInvalid for unknown mode, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	path := filepath.Join(dir, "source.txt")
+	if err := os.WriteFile(path, []byte("cancelled"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateFromPath(ctx, path, ImportCopy); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// Импорт не оставляет открытых файлов.
+func TestCreateFromPathDescriptors(t *testing.T) {
+	if _, err := os.Stat("/proc/self/fd"); err != nil {
+		t.Skip("/proc/self/fd is not available")
+	}
+	openFiles := func() int {
+		entries, err := os.ReadDir("/proc/self/fd")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+
+	s := newTestStorage(t)
+	dir := t.TempDir()
+	for _, mode := range []ImportMode{ImportCopy, ImportHardlink, ImportReflink, ImportMove} {
+		before := openFiles()
+		for i := range 10 {
+			path := filepath.Join(dir, "source.txt")
+			if err := os.WriteFile(path, []byte(fmt.Sprint(mode, i)), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.CreateFromPath(context.Background(), path, mode); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if after := openFiles(); after > before {
+			t.Fatalf("%s: %d files are left open", mode, after-before)
+		}
+	}
+}
+
+func TestImportDir(t *testing.T) {
+	s := newTestStorage(t)
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"a.txt":         "first",
+		"sub/b.txt":     "second",
+		"sub/sub/c.txt": "first",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Символические ссылки пропускаются
+	if err := os.Symlink(filepath.Join(dir, "a.txt"), filepath.Join(dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := s.ImportDir(context.Background(), dir, ImportMove)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != len(files) {
+		t.Fatalf("unexpected result %v", names)
+	}
+	for name, content := range files {
+		stored, ok := names[filepath.Join(dir, name)]
+		if !ok {
+			t.Fatalf("%s is not imported", name)
+		}
+		if got := readBlob(t, s, stored); string(got) != content {
+			t.Fatalf("%s: unexpected content %q", name, got)
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Fatalf("%s is not moved: %v", name, err)
+		}
+	}
+	if names[filepath.Join(dir, "a.txt")] != names[filepath.Join(dir, "sub/sub/c.txt")] {
+		t.Fatal("expected identical files to share a name")
+	}
+
+	if _, err := s.ImportDir(context.Background(), filepath.Join(dir, "missing"), ImportCopy); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package filestore
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// indexDir каталог индекса хеш-сумм внутри rootDir
+const indexDir = "~index"
+
+// ErrInvalidDigest возвращается для хеш-сумм в неподдерживаемом формате.
+var ErrInvalidDigest = errors.New("invalid digest")
+
+// digestAlgorithms задаёт поддерживаемые алгоритмы и длины хеш-сумм в шестнадцатеричном виде.
+var digestAlgorithms = map[string]int{
+	"md5":    32,
+	"sha256": 64,
+}
+
+// ParseDigest разбирает хеш-сумму вида "алгоритм:hex" (например, "sha256:9f86d0...").
+// Допускаются названия алгоритмов "md5", "sha256" и "sha-256" в любом регистре.
+func ParseDigest(digest string) (alg, sum string, err error) {
+	alg, sum, ok := strings.Cut(digest, ":")
+	if !ok {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidDigest, digest)
+	}
+	alg = strings.ReplaceAll(strings.ToLower(alg), "-", "")
+	sum = strings.ToLower(sum)
+
+	size, ok := digestAlgorithms[alg]
+	if !ok || len(sum) != size {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidDigest, digest)
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidDigest, digest)
+	}
+	return alg, sum, nil
+}
+
+// Lookup ищет файл по хеш-сумме его содержимого без передачи самого содержимого.
+// digest задаётся в виде "алгоритм:hex", поддерживаются md5 и sha256. Если файл найден,
+// обращение к нему учитывается так же, как при повторном сохранении, и возвращается
+// информация о нём; иначе возвращается ошибка os.ErrNotExist. Если в opts задано пространство
+// имён (WithNamespace), найденный файл учитывается в его квоте так же, как при сохранении.
+func (s *LocalStorage) Lookup(digest string, opts ...CreateOption) (*FileInfo, error) {
+	alg, sum, err := ParseDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+
+	indexPath := s.indexPath(alg, sum)
+	data, err := os.ReadFile(indexPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+
+	fi := &FileInfo{}
+	if err := json.Unmarshal(data, fi); err != nil {
+		return nil, err
+	}
+
+	// Отмечаем обращение к файлу; если он уже удалён, удаляем устаревшую запись индекса
+	if _, err := s.statBlob(fi.Name); err != nil {
+		if os.IsNotExist(err) {
+			os.Remove(indexPath)
+			s.removeEmptyParents(indexPath)
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+	s.touch(fi.Name)
+
+	if o := newCreateOptions(opts); o.namespace != "" {
+		if _, err := s.charge(o.namespace, fi); err != nil {
+			return nil, err
+		}
+	}
+
+	return fi, nil
+}
+
+// indexPath возвращает путь к записи индекса для хеш-суммы sum алгоритма alg.
+func (s *LocalStorage) indexPath(alg, sum string) string {
+	return filepath.Join(s.rootDir, indexDir, alg, sum[:2], sum)
+}
+
+// addIndex добавляет файл в индекс хеш-сумм. Ошибки индексации не мешают сохранению
+// файла, поэтому вызывающий может их игнорировать: файл просто не будет найден через Lookup.
+func (s *LocalStorage) addIndex(fi *FileInfo) error {
+	data, err := json.Marshal(fi)
+	if err != nil {
+		return err
+	}
+
+	for alg, sum := range map[string]string{"md5": fi.MD5, "sha256": fi.SHA256} {
+		if len(sum) != digestAlgorithms[alg] {
+			continue
+		}
+
+		path := s.indexPath(alg, sum)
+		if err := os.MkdirAll(filepath.Dir(path), s.perm); err != nil {
+			return err
+		}
+		tmp, err := s.writeTemp(data)
+		if err != nil {
+			return err
+		}
+		if err := s.rename(tmp, path); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanIndex удаляет записи индекса, которые ссылаются на отсутствующие файлы.
+func (s *LocalStorage) cleanIndex(ctx context.Context) error {
+	root := filepath.Join(s.rootDir, indexDir)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // игнорируем ошибки доступа к файлу
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		fi := &FileInfo{}
+		if err := json.Unmarshal(data, fi); err != nil {
+			os.Remove(path)
+			return nil
+		}
+		if ok, err := s.IsExists(fi.Name); !ok && os.IsNotExist(err) {
+			os.Remove(path)
+			s.removeEmptyParents(path)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLookup(t *testing.T) {
+	s := newTestStorage(t)
+	fi := createBlob(t, s, []byte("find me by digest"))
+
+	for _, digest := range []string{
+		"md5:" + fi.MD5,
+		"sha256:" + fi.SHA256,
+		"SHA-256:" + strings.ToUpper(fi.SHA256),
+	} {
+		got, err := s.Lookup(digest)
+		if err != nil {
+			t.Fatalf("Lookup(%s): %v", digest, err)
+		}
+		if *got != *fi {
+			t.Fatalf("Lookup(%s): unexpected file info %+v", digest, got)
+		}
+	}
+
+	for _, digest := range []string{"md5", "crc32:0d4a1185", "md5:" + fi.SHA256, "sha256:" + strings.Repeat("z", 64)} {
+		if _, err := s.Lookup(digest); !errors.Is(err, ErrInvalidDigest) {
+			t.Fatalf("Lookup(%s): expected ErrInvalidDigest, got %v", digest, err)
+		}
+	}
+	if _, err := s.Lookup("md5:" + strings.Repeat("0", 32)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+
+	// Запись индекса удалённого файла удаляется при поиске
+	if err := s.Remove(fi.Name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Lookup("md5:" + fi.MD5); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+	if _, err := os.Stat(s.indexPath("md5", fi.MD5)); !os.IsNotExist(err) {
+		t.Fatalf("stale index entry is kept: %v", err)
+	}
+}
+
+func TestLookupExpired(t *testing.T) {
+	s := newTestStorage(t)
+	fi := createBlob(t, s, []byte("short-lived"), WithTTL(time.Millisecond))
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := s.Lookup("sha256:" + fi.SHA256); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestLookupNamespace(t *testing.T) {
+	s := newTestStorage(t)
+	fi := createBlob(t, s, []byte("shared content"), WithNamespace("a"))
+
+	if err := s.SetQuota("c", Quota{Objects: 1}); err != nil {
+		t.Fatal(err)
+	}
+	createBlob(t, s, []byte("occupies quota"), WithNamespace("c"))
+
+	if _, err := s.Lookup("md5:"+fi.MD5, WithNamespace("b")); err != nil {
+		t.Fatal(err)
+	}
+	// Повторный поиск не учитывает файл дважды
+	if _, err := s.Lookup("md5:"+fi.MD5, WithNamespace("b")); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := s.Usage("b"); err != nil || u != (QuotaUsage{Bytes: fi.Size, Objects: 1}) {
+		t.Fatalf("unexpected usage %+v, %v", u, err)
+	}
+
+	if _, err := s.Lookup("md5:"+fi.MD5, WithNamespace("c")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+}
+
+func TestHandlerLookup(t *testing.T) {
+	h, fsys := newTestHandler(t, WithNamespaceFunc(func(r *http.Request) string {
+		return r.Header.Get("X-Tenant")
+	}))
+	fi, err := fsys.Create(context.Background(), strings.NewReader("uploaded once"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := do(h, http.MethodGet, "/blobs/by-digest/sha-256/"+fi.SHA256, nil, map[string]string{"X-Tenant": "t1"})
+	var got FileInfo
+	decodeJSON(t, w, &got)
+	if w.Code != http.StatusOK || got != *fi {
+		t.Fatalf("unexpected response %d %+v", w.Code, got)
+	}
+	if w.Header().Get("Location") != "../../"+fi.Name || w.Header().Get("ETag") != `"`+fi.Name+`"` {
+		t.Fatalf("unexpected headers %v", w.Header())
+	}
+
+	// Найденный файл учитывается в квоте пространства имён
+	if u, err := fsys.LocalStorage().Usage("t1"); err != nil || u.Objects != 1 {
+		t.Fatalf("unexpected usage %+v, %v", u, err)
+	}
+	if err := fsys.LocalStorage().SetQuota("t2", Quota{Bytes: fi.Size - 1}); err != nil {
+		t.Fatal(err)
+	}
+	assertError(t, do(h, http.MethodHead, "/blobs/by-digest/md5/"+fi.MD5, nil, map[string]string{"X-Tenant": "t2"}), http.StatusRequestEntityTooLarge)
+
+	if w := do(h, http.MethodHead, "/blobs/by-digest/md5/"+fi.MD5, nil, nil); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	assertError(t, do(h, http.MethodGet, "/blobs/by-digest/md5/"+strings.Repeat("0", 32), nil, nil), http.StatusNotFound)
+	assertError(t, do(h, http.MethodGet, "/blobs/by-digest/md5/xyz", nil, nil), http.StatusBadRequest)
+	assertError(t, do(h, http.MethodPost, "/blobs/by-digest/md5/"+fi.MD5, nil, nil), http.StatusMethodNotAllowed)
+}
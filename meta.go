@@ -0,0 +1,324 @@
+package filestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/tenrok/filestore/encryption"
+)
+
+// metaDir каталог метаданных файлов внутри rootDir
+const metaDir = "~meta"
+
+// blobMeta описывает метаданные файла хранилища, которые не следуют из его содержимого.
+type blobMeta struct {
+	Expires time.Time            `json:"expires,omitzero"` // момент, после которого файл считается удалённым
+	Pins    map[string]time.Time `json:"pins,omitempty"`   // закрепления по причинам
+	Holds   map[string]time.Time `json:"holds,omitempty"`  // удержания по идентификаторам
+
+	// Namespaces хранит размер, учтённый в квоте каждого пространства имён, которое ссылается на файл
+	Namespaces map[string]int64 `json:"namespaces,omitempty"`
+
+	// Chunk отмечает файл, который сохранён только как фрагмент других файлов. Такой файл
+	// удаляется вместе с последней ссылкой на него; самостоятельное сохранение снимает отметку.
+	Chunk bool `json:"chunk,omitempty"`
+
+	blobEncoding
+}
+
+// blobEncoding описывает, как хранилище закодировало содержимое файла. Способ кодирования
+// записывается при сохранении и не определяется по содержимому: иначе пользовательский файл,
+// который начинается с сигнатуры формата, читался бы как закодированный.
+type blobEncoding struct {
+	Encrypted  bool `json:"encrypted,omitempty"`  // содержимое зашифровано
+	Compressed bool `json:"compressed,omitempty"` // открытое содержимое сжато
+	Chunked    bool `json:"chunked,omitempty"`    // открытое содержимое — манифест фрагментов
+}
+
+// encrypted проверяет, что содержимое r зашифровано хранилищем. Файл без сигнатуры
+// считается открытым, даже если в метаданных записано шифрование: метаданные записываются
+// до замены файла, и сбой между этими шагами оставляет прежнее открытое содержимое.
+func (e blobEncoding) encrypted(r io.ReaderAt) bool {
+	return e.Encrypted && encryption.IsEncrypted(r)
+}
+
+// isZero проверяет, что метаданные пусты и хранить их не нужно.
+func (m *blobMeta) isZero() bool {
+	return m.Expires.IsZero() && len(m.Pins) == 0 && len(m.Holds) == 0 && len(m.Namespaces) == 0 &&
+		!m.Chunk && m.blobEncoding == blobEncoding{}
+}
+
+// protected проверяет, что файл закреплён или находится на удержании.
+func (m *blobMeta) protected() bool {
+	return len(m.Pins) > 0 || len(m.Holds) > 0
+}
+
+// expired проверяет, истёк ли срок хранения файла к моменту now.
+// Срок хранения защищённых файлов не истекает.
+func (m *blobMeta) expired(now time.Time) bool {
+	return !m.Expires.IsZero() && now.After(m.Expires) && !m.protected()
+}
+
+type createOptions struct {
+	expires   time.Time
+	namespace string
+}
+
+type CreateOption func(*createOptions)
+
+// WithTTL задаёт время жизни сохраняемого файла независимо от обращений к нему.
+func WithTTL(d time.Duration) CreateOption {
+	return func(o *createOptions) {
+		o.expires = time.Now().Add(d)
+	}
+}
+
+// WithExpiresAt задаёт момент, после которого сохраняемый файл будет удалён.
+func WithExpiresAt(t time.Time) CreateOption {
+	return func(o *createOptions) {
+		o.expires = t
+	}
+}
+
+// newCreateOptions применяет опции сохранения файла.
+func newCreateOptions(opts []CreateOption) *createOptions {
+	o := &createOptions{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// SetExpiry задаёт момент, после которого файл name будет удалён.
+// Нулевое значение t делает файл постоянным.
+func (s *LocalStorage) SetExpiry(name string, t time.Time) error {
+	mu := s.getMutex(name)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		s.releaseMutex(name)
+	}()
+
+	if _, err := s.statBlob(name); err != nil {
+		return err
+	}
+
+	m, err := s.readMeta(name)
+	if err != nil {
+		return err
+	}
+	m.Expires = t
+	return s.writeMeta(name, m)
+}
+
+// Expiry возвращает момент, после которого файл name будет удалён.
+// Для постоянных файлов возвращается нулевое время.
+func (s *LocalStorage) Expiry(name string) (time.Time, error) {
+	if _, err := s.statBlob(name); err != nil {
+		return time.Time{}, err
+	}
+
+	m, err := s.readMeta(name)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return m.Expires, nil
+}
+
+// extendExpiry применяет срок хранения к повторно сохраняемому файлу. Файл, который уже
+// сохранён кем-то другим, не может стать короче живущим: постоянный файл остаётся постоянным,
+// а из двух сроков выбирается более поздний. Сохранение без срока делает файл постоянным.
+func (s *LocalStorage) extendExpiry(name string, expires time.Time, existed bool) error {
+	mu := s.getMutex(name)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		s.releaseMutex(name)
+	}()
+
+	m, err := s.readMeta(name)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case expires.IsZero():
+		if m.Expires.IsZero() {
+			return nil
+		}
+		m.Expires = time.Time{}
+	case !existed, expires.After(m.Expires) && !m.Expires.IsZero():
+		m.Expires = expires
+	default:
+		// Постоянный файл или файл с более поздним сроком
+		return nil
+	}
+	return s.writeMeta(name, m)
+}
+
+// setEncoding записывает способ кодирования содержимого файла. Запись выполняется до помещения
+// файла на место, поэтому хранимое содержимое никогда не читается без неё.
+// Вызывающий должен удерживать мьютекс имени файла.
+func (s *LocalStorage) setEncoding(name string, enc blobEncoding) error {
+	m, err := s.readMeta(name)
+	if err != nil {
+		return err
+	}
+	if m.blobEncoding == enc {
+		return nil
+	}
+	m.blobEncoding = enc
+	return s.writeMeta(name, m)
+}
+
+// isExpired проверяет, истёк ли срок хранения файла.
+func (s *LocalStorage) isExpired(name string) bool {
+	m, err := s.readMeta(name)
+	if err != nil {
+		return false
+	}
+	return m.expired(time.Now())
+}
+
+// statBlob возвращает информацию о хранимом файле. Для файлов с истёкшим сроком
+// хранения возвращается ошибка os.ErrNotExist.
+func (s *LocalStorage) statBlob(name string) (os.FileInfo, error) {
+	fullPath, err := s.GetFullPath(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, s.wrapPathError(err, name)
+	}
+	if s.isExpired(name) {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return info, nil
+}
+
+// walkMeta обходит метаданные всех файлов хранилища. Повреждённые метаданные пропускаются.
+func (s *LocalStorage) walkMeta(ctx context.Context, fn func(name string, m *blobMeta) error) error {
+	root := filepath.Join(s.rootDir, metaDir)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil // игнорируем ошибки доступа к файлу
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		name := strings.ReplaceAll(rel, string(os.PathSeparator), "")
+		m, err := s.readMeta(name)
+		if err != nil {
+			return nil
+		}
+		return fn(name, m)
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// metaPath возвращает путь к файлу метаданных.
+func (s *LocalStorage) metaPath(name string) (string, error) {
+	relPath := s.GetRelativePath(name)
+	if relPath == "" {
+		return "", fmt.Errorf("%w: %s", ErrInvalidName, name)
+	}
+	return s.safePath(filepath.Join(metaDir, relPath))
+}
+
+// readMeta читает метаданные файла. Если метаданных нет (в том числе у файлов
+// с недопустимыми именами), возвращает пустые.
+func (s *LocalStorage) readMeta(name string) (*blobMeta, error) {
+	m := &blobMeta{}
+	path, err := s.metaPath(name)
+	if errors.Is(err, ErrInvalidName) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// writeMeta сохраняет метаданные файла. Пустые метаданные удаляются.
+// Вызывающий должен удерживать мьютекс имени файла.
+func (s *LocalStorage) writeMeta(name string, m *blobMeta) error {
+	if m.isZero() {
+		return s.removeMeta(name)
+	}
+
+	path, err := s.metaPath(name)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), s.perm); err != nil {
+		return err
+	}
+	tmpPath, err := s.writeTemp(data)
+	if err != nil {
+		return err
+	}
+	if err := s.rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// removeMeta удаляет метаданные файла.
+func (s *LocalStorage) removeMeta(name string) error {
+	path, err := s.metaPath(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	s.removeEmptyParents(path)
+	return s.syncRemoved(path)
+}
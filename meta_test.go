@@ -0,0 +1,97 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExpiry(t *testing.T) {
+	s := newTestStorage(t)
+	now := time.Now()
+	hour, day := now.Add(time.Hour).Truncate(time.Second), now.Add(24*time.Hour).Truncate(time.Second)
+
+	cases := []struct {
+		name   string
+		first  []CreateOption
+		second []CreateOption
+		want   time.Time
+	}{
+		{name: "TTL", first: []CreateOption{WithExpiresAt(hour)}, want: hour},
+		{name: "Later wins", first: []CreateOption{WithExpiresAt(hour)}, second: []CreateOption{WithExpiresAt(day)}, want: day},
+		{name: "Earlier ignored", first: []CreateOption{WithExpiresAt(day)}, second: []CreateOption{WithExpiresAt(hour)}, want: day},
+		{name: "Permanent wins", first: []CreateOption{WithExpiresAt(hour)}, second: []CreateOption{}},
+		{name: "Permanent stays", first: []CreateOption{}, second: []CreateOption{WithTTL(time.Hour)}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := []byte("expiry " + tc.name)
+			fi := createBlob(t, s, data, tc.first...)
+			if tc.second != nil {
+				createBlob(t, s, data, tc.second...)
+			}
+			exp, err := s.Expiry(fi.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !exp.Equal(tc.want) {
+				t.Fatalf("expected expiry %v, got %v", tc.want, exp)
+			}
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	data := []byte("short-lived")
+	fi := createBlob(t, s, data, WithExpiresAt(time.Now().Add(-time.Second)))
+
+	// Файл с истёкшим сроком недоступен ещё до очистки
+	if _, err := s.Open(fi.Name); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+	if ok, _ := s.IsExists(fi.Name); ok {
+		t.Fatal("expired file exists")
+	}
+	if _, err := s.Expiry(fi.Name); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+
+	// Повторное сохранение без срока делает файл постоянным
+	createBlob(t, s, data)
+	if exp, err := s.Expiry(fi.Name); err != nil || !exp.IsZero() {
+		t.Fatalf("expected permanent file, got %v, %v", exp, err)
+	}
+
+	// Очистка удаляет файл и его метаданные независимо от времени обращения
+	if err := s.SetExpiry(fi.Name, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Clean(ctx, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{filepath.Join(s.rootDir, fi.Path), metaPath(t, s, fi.Name)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s is kept: %v", path, err)
+		}
+	}
+	if err := s.SetExpiry(fi.Name, time.Time{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+// metaPath возвращает путь к метаданным файла name.
+func metaPath(t *testing.T, s *LocalStorage, name string) string {
+	t.Helper()
+
+	path, err := s.metaPath(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
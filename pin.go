@@ -0,0 +1,165 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrPinned возвращается при попытке удалить закреплённый файл (см. WithRemoveProtection).
+	ErrPinned = errors.New("file is pinned")
+
+	// ErrOnHold возвращается при попытке удалить файл, находящийся на удержании.
+	ErrOnHold = errors.New("file is on hold")
+)
+
+// WithRemoveProtection запрещает удалять закреплённые файлы методом Remove.
+// Файлы на удержании защищены от удаления независимо от этой опции.
+func WithRemoveProtection() LocalStorageOption {
+	return func(s *LocalStorage) {
+		s.protectPinned = true
+	}
+}
+
+// Pin описывает закрепление файла или удержание.
+type Pin struct {
+	Name    string    `json:"name"`           // имя файла
+	Reason  string    `json:"reason"`         // причина закрепления или идентификатор удержания
+	Created time.Time `json:"created"`        // момент закрепления
+	Hold    bool      `json:"hold,omitempty"` // удержание, а не закрепление
+}
+
+// Pin закрепляет файл name по причине reason. Закреплённый файл не удаляется методами Clean
+// и EvictLRU, и срок его хранения не истекает. Файл может быть закреплён по нескольким причинам
+// и остаётся закреплённым, пока не снята последняя из них.
+func (s *LocalStorage) Pin(name, reason string) error {
+	return s.updateMeta(name, func(m *blobMeta) bool {
+		if _, ok := m.Pins[reason]; ok {
+			return false
+		}
+		if m.Pins == nil {
+			m.Pins = make(map[string]time.Time)
+		}
+		m.Pins[reason] = time.Now().UTC()
+		return true
+	})
+}
+
+// Unpin снимает закрепление файла name по причине reason.
+func (s *LocalStorage) Unpin(name, reason string) error {
+	return s.updateMeta(name, func(m *blobMeta) bool {
+		if _, ok := m.Pins[reason]; !ok {
+			return false
+		}
+		delete(m.Pins, reason)
+		return true
+	})
+}
+
+// PlaceHold помещает файл name на удержание с идентификатором id. В отличие от закрепления,
+// удержание запрещает любое удаление файла, в том числе методом Remove, и снимается только
+// методом ReleaseHold.
+func (s *LocalStorage) PlaceHold(name, id string) error {
+	return s.updateMeta(name, func(m *blobMeta) bool {
+		if _, ok := m.Holds[id]; ok {
+			return false
+		}
+		if m.Holds == nil {
+			m.Holds = make(map[string]time.Time)
+		}
+		m.Holds[id] = time.Now().UTC()
+		return true
+	})
+}
+
+// ReleaseHold снимает удержание id с файла name.
+func (s *LocalStorage) ReleaseHold(name, id string) error {
+	return s.updateMeta(name, func(m *blobMeta) bool {
+		if _, ok := m.Holds[id]; !ok {
+			return false
+		}
+		delete(m.Holds, id)
+		return true
+	})
+}
+
+// ListPins возвращает все закрепления и удержания файлов хранилища, упорядоченные
+// по имени файла и причине.
+func (s *LocalStorage) ListPins(ctx context.Context) ([]Pin, error) {
+	var pins []Pin
+	err := s.walkMeta(ctx, func(name string, m *blobMeta) error {
+		for reason, created := range m.Pins {
+			pins = append(pins, Pin{Name: name, Reason: reason, Created: created})
+		}
+		for id, created := range m.Holds {
+			pins = append(pins, Pin{Name: name, Reason: id, Created: created, Hold: true})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(pins, func(i, j int) bool {
+		if pins[i].Name != pins[j].Name {
+			return pins[i].Name < pins[j].Name
+		}
+		if pins[i].Hold != pins[j].Hold {
+			return !pins[i].Hold
+		}
+		return pins[i].Reason < pins[j].Reason
+	})
+	return pins, nil
+}
+
+// updateMeta изменяет метаданные существующего файла под блокировкой его имени.
+// Метаданные сохраняются, только если fn сообщает об изменении.
+func (s *LocalStorage) updateMeta(name string, fn func(m *blobMeta) bool) error {
+	mu := s.getMutex(name)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		s.releaseMutex(name)
+	}()
+
+	if _, err := s.statBlob(name); err != nil {
+		return err
+	}
+
+	m, err := s.readMeta(name)
+	if err != nil {
+		return err
+	}
+	if !fn(m) {
+		return nil
+	}
+	return s.writeMeta(name, m)
+}
+
+// isProtected проверяет, закреплён ли файл или находится ли он на удержании.
+func (s *LocalStorage) isProtected(name string) bool {
+	m, err := s.readMeta(name)
+	if err != nil {
+		// Метаданные не прочитать — безопаснее файл не удалять
+		return true
+	}
+	return m.protected()
+}
+
+// checkRemove проверяет, что файл можно удалить методом Remove.
+func (s *LocalStorage) checkRemove(name string) error {
+	m, err := s.readMeta(name)
+	if err != nil {
+		return err
+	}
+	if len(m.Holds) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: ErrOnHold}
+	}
+	if s.protectPinned && len(m.Pins) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: ErrPinned}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package filestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPin(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, WithRemoveProtection())
+
+	pinned := createBlob(t, s, []byte("pinned"), WithExpiresAt(time.Now().Add(-time.Second)))
+	held := createBlob(t, s, []byte("held"))
+	plain := createBlob(t, s, []byte("plain"))
+
+	// Закрепить можно только существующий файл
+	if err := s.Pin(pinned.Name, "build-1"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist for expired file, got %v", err)
+	}
+	if err := s.SetExpiry(pinned.Name, time.Now().Add(time.Hour)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+	createBlob(t, s, []byte("pinned"), WithExpiresAt(time.Now().Add(20*time.Millisecond)))
+
+	for _, reason := range []string{"build-1", "build-2", "build-1"} {
+		if err := s.Pin(pinned.Name, reason); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.PlaceHold(held.Name, "case-7"); err != nil {
+		t.Fatal(err)
+	}
+
+	pins, err := s.ListPins(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 3 || pins[0].Name != pins[1].Name || pins[0].Reason > pins[1].Reason {
+		t.Fatalf("unexpected pins %+v", pins)
+	}
+	for _, p := range pins {
+		if p.Hold != (p.Name == held.Name) || p.Created.IsZero() {
+			t.Fatalf("unexpected pin %+v", p)
+		}
+	}
+
+	// Срок хранения закреплённого файла не истекает
+	time.Sleep(30 * time.Millisecond)
+	if ok, _ := s.IsExists(pinned.Name); !ok {
+		t.Fatal("pinned file is expired")
+	}
+
+	if err := s.Remove(pinned.Name); !errors.Is(err, ErrPinned) {
+		t.Fatalf("expected ErrPinned, got %v", err)
+	}
+	if err := s.Remove(held.Name); !errors.Is(err, ErrOnHold) {
+		t.Fatalf("expected ErrOnHold, got %v", err)
+	}
+	if err := s.Clean(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err := s.EvictLRU(ctx, 0); err != nil || len(removed) != 0 {
+		t.Fatalf("protected files are evicted: %v, %v", removed, err)
+	}
+	for _, fi := range []*FileInfo{pinned, held} {
+		if ok, _ := s.IsExists(fi.Name); !ok {
+			t.Fatalf("protected file %s is removed", fi.Name)
+		}
+	}
+	if ok, _ := s.IsExists(plain.Name); ok {
+		t.Fatal("unprotected file is kept")
+	}
+
+	// После снятия последнего закрепления срок хранения снова действует
+	s.Unpin(pinned.Name, "build-1")
+	if ok, _ := s.IsExists(pinned.Name); !ok {
+		t.Fatal("file with remaining pin is expired")
+	}
+	s.Unpin(pinned.Name, "build-2")
+	if ok, _ := s.IsExists(pinned.Name); ok {
+		t.Fatal("unpinned file is not expired")
+	}
+
+	if err := s.ReleaseHold(held.Name, "case-7"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(held.Name); err != nil {
+		t.Fatal(err)
+	}
+	if pins, err := s.ListPins(ctx); err != nil || len(pins) != 0 {
+		t.Fatalf("unexpected pins %+v, %v", pins, err)
+	}
+}
+
+// Без WithRemoveProtection закреплённый файл удаляется методом Remove, а файл на удержании — нет.
+func TestPinWithoutProtection(t *testing.T) {
+	s := newTestStorage(t)
+	pinned := createBlob(t, s, []byte("pinned"))
+	held := createBlob(t, s, []byte("held"))
+	s.Pin(pinned.Name, "reason")
+	s.PlaceHold(held.Name, "hold")
+
+	if err := s.Remove(pinned.Name); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove(held.Name); !errors.Is(err, ErrOnHold) {
+		t.Fatalf("expected ErrOnHold, got %v", err)
+	}
+}
+
+// Ошибка чтения метаданных не выдаётся за удержание.
+func TestRemoveCorruptMeta(t *testing.T) {
+	s := newTestStorage(t)
+	fi := createBlob(t, s, []byte("corrupt meta"))
+	s.Pin(fi.Name, "reason")
+	if err := os.WriteFile(metaPath(t, s, fi.Name), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fullPath, err := s.GetFullPath(fi.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var syntaxErr *json.SyntaxError
+	if err := s.removeBlob(fi.Name, fullPath); errors.Is(err, ErrOnHold) || !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected metadata error, got %v", err)
+	}
+	if err := s.Remove(fi.Name); errors.Is(err, ErrOnHold) || !errors.As(err, &syntaxErr) {
+		t.Fatalf("expected metadata error, got %v", err)
+	}
+	if ok, _ := s.IsExists(fi.Name); !ok {
+		t.Fatal("file with unreadable metadata is removed")
+	}
+}
+
+// Одновременные изменения метаданных одного файла не теряются.
+func TestPinConcurrent(t *testing.T) {
+	s := newTestStorage(t)
+	fi := createBlob(t, s, []byte("popular"))
+
+	const pinners = 50
+	var wg sync.WaitGroup
+	for i := range pinners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Pin(fi.Name, fmt.Sprintf("reason-%d", i)); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	pins, err := s.ListPins(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != pinners {
+		t.Fatalf("expected %d pins, got %d", pinners, len(pins))
+	}
+	if len(s.fileMutex) != 0 {
+		t.Fatalf("name mutexes are leaked: %d", len(s.fileMutex))
+	}
+}
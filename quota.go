@@ -0,0 +1,362 @@
+package filestore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// quotaFile файл квот и использования пространств имён внутри rootDir
+const quotaFile = "~quota.json"
+
+// ErrQuotaExceeded возвращается, если сохранение файла превысило бы квоту пространства имён.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaExceededError описывает превышение квоты пространства имён.
+type QuotaExceededError struct {
+	Namespace string // пространство имён
+	Resource  string // "bytes" или "objects"
+	Limit     int64  // квота
+	Used      int64  // текущее использование
+	Requested int64  // запрошенный прирост
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("quota exceeded for namespace %q: %s used %d of %d, requested %d",
+		e.Namespace, e.Resource, e.Used, e.Limit, e.Requested)
+}
+
+func (e *QuotaExceededError) Unwrap() error { return ErrQuotaExceeded }
+
+// Quota задаёт ограничения пространства имён. Нулевое значение поля снимает ограничение.
+type Quota struct {
+	Bytes   int64 `json:"bytes,omitempty"`   // суммарный размер файлов
+	Objects int64 `json:"objects,omitempty"` // количество файлов
+}
+
+// QuotaUsage описывает использование пространства имён.
+type QuotaUsage struct {
+	Bytes   int64 `json:"bytes"`
+	Objects int64 `json:"objects"`
+}
+
+// quotaState хранит квоты и использование всех пространств имён.
+type quotaState struct {
+	Limits map[string]Quota      `json:"limits,omitempty"`
+	Usage  map[string]QuotaUsage `json:"usage,omitempty"`
+}
+
+// WithNamespace сохраняет файл от имени пространства имён (например, арендатора) ns
+// с учётом его квот. Файл, уже сохранённый в этом пространстве имён, повторно не учитывается;
+// файл, общий для нескольких пространств имён, учитывается в каждом из них.
+func WithNamespace(ns string) CreateOption {
+	return func(o *createOptions) {
+		o.namespace = ns
+	}
+}
+
+// SetQuota задаёт квоту пространства имён ns. Уже сохранённые файлы не удаляются,
+// даже если использование превышает новую квоту.
+func (s *LocalStorage) SetQuota(ns string, q Quota) error {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	st, err := s.loadQuota()
+	if err != nil {
+		return err
+	}
+	prev, had := st.Limits[ns]
+	if q == (Quota{}) {
+		delete(st.Limits, ns)
+	} else {
+		st.Limits[ns] = q
+	}
+	if err := s.saveQuota(st); err != nil {
+		if had {
+			st.Limits[ns] = prev
+		} else {
+			delete(st.Limits, ns)
+		}
+		return err
+	}
+	return nil
+}
+
+// Quota возвращает квоту пространства имён ns.
+func (s *LocalStorage) Quota(ns string) (Quota, error) {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	st, err := s.loadQuota()
+	if err != nil {
+		return Quota{}, err
+	}
+	return st.Limits[ns], nil
+}
+
+// Usage возвращает использование пространства имён ns.
+func (s *LocalStorage) Usage(ns string) (QuotaUsage, error) {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	st, err := s.loadQuota()
+	if err != nil {
+		return QuotaUsage{}, err
+	}
+	return st.Usage[ns], nil
+}
+
+// Release исключает файл name из пространства имён ns и освобождает его квоту.
+// Сам файл остаётся в хранилище. Принадлежность пространствам имён не защищает файл
+// от очистки: Clean удаляет его по общим правилам (время обращения, срок хранения,
+// закрепления) и при этом освобождает квоты всех пространств имён, которые на него ссылаются.
+func (s *LocalStorage) Release(ns, name string) error {
+	return s.release(ns, name, nil)
+}
+
+// release исключает файл name из пространства имён ns. Если remove не nil и файл больше
+// не принадлежит ни одному пространству имён, он удаляется функцией remove под блокировкой
+// имени, чтобы другое пространство имён не успело на него сослаться. Защищённые от удаления
+// файлы и фрагменты, на которые ссылаются манифесты, остаются в хранилище.
+func (s *LocalStorage) release(ns, name string, remove func(name, fullPath string) error) error {
+	mu := s.getMutex(name)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		s.releaseMutex(name)
+	}()
+
+	m, err := s.readMeta(name)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.Namespaces[ns]; !ok {
+		return &os.PathError{Op: "release", Path: name, Err: os.ErrNotExist}
+	}
+	if err := s.uncharge(name, m, ns); err != nil {
+		return err
+	}
+	if remove == nil || len(m.Namespaces) > 0 || s.checkRemove(name) != nil {
+		return nil
+	}
+
+	fullPath, err := s.GetFullPath(name)
+	if err != nil {
+		return err
+	}
+	if err := remove(name, fullPath); err != nil && !errors.Is(err, ErrInUse) {
+		return err
+	}
+	return nil
+}
+
+// checkQuota проверяет, что пространство имён ns может принять ещё один файл размера size.
+func (s *LocalStorage) checkQuota(ns string, size int64) error {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	st, err := s.loadQuota()
+	if err != nil {
+		return err
+	}
+	return st.check(ns, size)
+}
+
+// charge учитывает файл в квоте пространства имён ns. Возвращает false, если файл
+// уже учтён в этом пространстве имён.
+func (s *LocalStorage) charge(ns string, fi *FileInfo) (bool, error) {
+	mu := s.getMutex(fi.Name)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		s.releaseMutex(fi.Name)
+	}()
+
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	m, err := s.readMeta(fi.Name)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := m.Namespaces[ns]; ok {
+		return false, nil
+	}
+
+	st, err := s.loadQuota()
+	if err != nil {
+		return false, err
+	}
+	if err := st.check(ns, fi.Size); err != nil {
+		return false, err
+	}
+
+	// Использование сохраняем раньше метаданных: при сбое квота окажется завышенной,
+	// а не заниженной, и будет пересчитана методом Recover
+	st.add(ns, fi.Size, 1)
+	if err := s.saveQuota(st); err != nil {
+		st.add(ns, -fi.Size, -1)
+		return false, err
+	}
+
+	if m.Namespaces == nil {
+		m.Namespaces = make(map[string]int64)
+	}
+	m.Namespaces[ns] = fi.Size
+	if err := s.writeMeta(fi.Name, m); err != nil {
+		st.add(ns, -fi.Size, -1)
+		s.saveQuota(st)
+		return false, err
+	}
+	return true, nil
+}
+
+// uncharge исключает файл name с метаданными m из пространств имён nss.
+// Вызывающий должен удерживать мьютекс имени файла.
+func (s *LocalStorage) uncharge(name string, m *blobMeta, nss ...string) error {
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	st, err := s.loadQuota()
+	if err != nil {
+		return err
+	}
+
+	// Метаданные сохраняем раньше использования, чтобы при сбое квота оказалась завышенной
+	released := make(map[string]int64)
+	for _, ns := range nss {
+		if size, ok := m.Namespaces[ns]; ok {
+			released[ns] = size
+			delete(m.Namespaces, ns)
+		}
+	}
+	if err := s.writeMeta(name, m); err != nil {
+		for ns, size := range released {
+			m.Namespaces[ns] = size
+		}
+		return err
+	}
+
+	for ns, size := range released {
+		st.add(ns, -size, -1)
+	}
+	return s.saveQuota(st)
+}
+
+// dropQuota освобождает квоты всех пространств имён удалённого файла.
+// Вызывающий должен удерживать мьютекс имени файла.
+func (s *LocalStorage) dropQuota(m *blobMeta) error {
+	if len(m.Namespaces) == 0 {
+		return nil
+	}
+
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	st, err := s.loadQuota()
+	if err != nil {
+		return err
+	}
+	for ns, size := range m.Namespaces {
+		st.add(ns, -size, -1)
+	}
+	return s.saveQuota(st)
+}
+
+// recountQuota пересчитывает использование пространств имён по метаданным файлов.
+func (s *LocalStorage) recountQuota(ctx context.Context) error {
+	usage := make(map[string]QuotaUsage)
+	err := s.walkMeta(ctx, func(name string, m *blobMeta) error {
+		for ns, size := range m.Namespaces {
+			u := usage[ns]
+			u.Bytes += size
+			u.Objects++
+			usage[ns] = u
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.quotaMu.Lock()
+	defer s.quotaMu.Unlock()
+
+	st, err := s.loadQuota()
+	if err != nil {
+		return err
+	}
+	st.Usage = usage
+	return s.saveQuota(st)
+}
+
+// loadQuota возвращает состояние квот, при первом обращении читая его с диска.
+// Вызывающий должен удерживать s.quotaMu.
+func (s *LocalStorage) loadQuota() (*quotaState, error) {
+	if s.quota != nil {
+		return s.quota, nil
+	}
+
+	st := &quotaState{}
+	data, err := os.ReadFile(filepath.Join(s.rootDir, quotaFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, st); err != nil {
+			return nil, fmt.Errorf("invalid quota file: %w", err)
+		}
+	}
+	if st.Limits == nil {
+		st.Limits = make(map[string]Quota)
+	}
+	if st.Usage == nil {
+		st.Usage = make(map[string]QuotaUsage)
+	}
+	s.quota = st
+	return st, nil
+}
+
+// saveQuota атомарно сохраняет состояние квот. Вызывающий должен удерживать s.quotaMu.
+func (s *LocalStorage) saveQuota(st *quotaState) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmpPath, err := s.writeTemp(data)
+	if err != nil {
+		return err
+	}
+	if err := s.rename(tmpPath, filepath.Join(s.rootDir, quotaFile)); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// check проверяет, что пространство имён ns может принять ещё один файл размера size.
+func (st *quotaState) check(ns string, size int64) error {
+	q, u := st.Limits[ns], st.Usage[ns]
+	if q.Bytes > 0 && u.Bytes+size > q.Bytes {
+		return &QuotaExceededError{Namespace: ns, Resource: "bytes", Limit: q.Bytes, Used: u.Bytes, Requested: size}
+	}
+	if q.Objects > 0 && u.Objects+1 > q.Objects {
+		return &QuotaExceededError{Namespace: ns, Resource: "objects", Limit: q.Objects, Used: u.Objects, Requested: 1}
+	}
+	return nil
+}
+
+// add изменяет использование пространства имён ns.
+func (st *quotaState) add(ns string, bytes, objects int64) {
+	u := st.Usage[ns]
+	u.Bytes += bytes
+	u.Objects += objects
+	if u == (QuotaUsage{}) {
+		delete(st.Usage, ns)
+	} else {
+		st.Usage[ns] = u
+	}
+}
@@ -0,0 +1,187 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if err := s.SetQuota("t1", Quota{Bytes: 20, Objects: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if q, err := s.Quota("t1"); err != nil || q != (Quota{Bytes: 20, Objects: 2}) {
+		t.Fatalf("unexpected quota %+v, %v", q, err)
+	}
+
+	a := createBlob(t, s, []byte("abc"), WithNamespace("t1"))
+	createBlob(t, s, []byte("abc"), WithNamespace("t1")) // повторно не учитывается
+	createBlob(t, s, []byte("abc"), WithNamespace("t2")) // учитывается в каждом пространстве имён
+	if u, _ := s.Usage("t1"); u != (QuotaUsage{Bytes: 3, Objects: 1}) {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+	if u, _ := s.Usage("t2"); u != (QuotaUsage{Bytes: 3, Objects: 1}) {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+
+	cases := []struct {
+		data     string
+		resource string
+	}{
+		{data: "123456789012345678", resource: "bytes"},
+		{data: "1234567", resource: ""},
+		{data: "1", resource: "objects"},
+	}
+	for _, tc := range cases {
+		_, err := s.Create(ctx, bytes.NewReader([]byte(tc.data)), WithNamespace("t1"))
+		if tc.resource == "" {
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		var qe *QuotaExceededError
+		if !errors.As(err, &qe) || !errors.Is(err, ErrQuotaExceeded) || qe.Resource != tc.resource || qe.Namespace != "t1" {
+			t.Fatalf("%q: expected %s quota error, got %v", tc.data, tc.resource, err)
+		}
+		// Файл сверх квоты не сохраняется
+		if ok, _ := s.IsExists(createBlob(t, newTestStorage(t), []byte(tc.data)).Name); ok {
+			t.Fatalf("%q is stored despite quota", tc.data)
+		}
+	}
+
+	// Загрузка известного размера проверяет квоту заранее
+	if _, err := s.BeginUpload(WithUploadNamespace("t1"), WithUploadSize(1)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+
+	if err := s.Release("t1", a.Name); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Release("t1", a.Name); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+	if u, _ := s.Usage("t1"); u != (QuotaUsage{Bytes: 7, Objects: 1}) {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+
+	// Удаление файла освобождает квоты всех пространств имён
+	if err := s.Remove(a.Name); err != nil {
+		t.Fatal(err)
+	}
+	if u, _ := s.Usage("t2"); u != (QuotaUsage{}) {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+	s.Close()
+
+	// Расхождение использования с метаданными исправляется при восстановлении
+	if err := os.WriteFile(filepath.Join(dir, quotaFile), []byte(`{"limits":{"t1":{"bytes":20,"objects":2}},"usage":{"t1":{"bytes":100,"objects":9}}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err = NewLocalStorage(dir, WithRecovery(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if u, _ := s.Usage("t1"); u != (QuotaUsage{Bytes: 7, Objects: 1}) {
+		t.Fatalf("usage is not recounted: %+v", u)
+	}
+	if q, _ := s.Quota("t1"); q != (Quota{Bytes: 20, Objects: 2}) {
+		t.Fatalf("quota is not persisted: %+v", q)
+	}
+}
+
+// Release оставляет файл в хранилище, а Clean удаляет его вместе с квотами остальных пространств имён.
+func TestReleaseClean(t *testing.T) {
+	s := newTestStorage(t)
+	fi := createBlob(t, s, []byte("shared"), WithNamespace("t1"))
+	createBlob(t, s, []byte("shared"), WithNamespace("t2"))
+
+	if err := s.Release("t1", fi.Name); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.IsExists(fi.Name); !ok {
+		t.Fatal("released file is removed")
+	}
+	if u, _ := s.Usage("t1"); u != (QuotaUsage{}) {
+		t.Fatalf("unexpected usage %+v", u)
+	}
+
+	if err := s.Clean(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.IsExists(fi.Name); ok {
+		t.Fatal("file is kept by namespace charges")
+	}
+	if u, _ := s.Usage("t2"); u != (QuotaUsage{}) {
+		t.Fatalf("quota is not released by Clean: %+v", u)
+	}
+}
+
+func TestHandlerNamespace(t *testing.T) {
+	h, fsys := newTestHandler(t, WithNamespaceFunc(func(r *http.Request) string {
+		return r.Header.Get("X-Tenant")
+	}))
+	s := fsys.LocalStorage()
+	t1, t2 := map[string]string{"X-Tenant": "t1"}, map[string]string{"X-Tenant": "t2"}
+
+	if err := s.SetQuota("small", Quota{Bytes: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetQuota("full", Quota{Objects: 1}); err != nil {
+		t.Fatal(err)
+	}
+	do(h, http.MethodPost, "/blobs", []byte("x"), map[string]string{"X-Tenant": "full"})
+	assertError(t, do(h, http.MethodPost, "/blobs", []byte("too large"), map[string]string{"X-Tenant": "small"}), http.StatusRequestEntityTooLarge)
+	assertError(t, do(h, http.MethodPost, "/blobs", []byte("no room"), map[string]string{"X-Tenant": "full"}), http.StatusInsufficientStorage)
+
+	data := []byte("shared by tenants")
+	var fi FileInfo
+	decodeJSON(t, do(h, http.MethodPost, "/blobs", data, t1), &fi)
+	do(h, http.MethodPost, "/blobs", data, t2)
+	target := "/blobs/" + fi.Name
+
+	// Пространство имён, которому файл не принадлежит, удалить его не может
+	assertError(t, do(h, http.MethodDelete, target, nil, map[string]string{"X-Tenant": "t3"}), http.StatusNotFound)
+
+	if w := do(h, http.MethodDelete, target, nil, t1); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	assertError(t, do(h, http.MethodDelete, target, nil, t1), http.StatusNotFound)
+	if ok, _ := s.IsExists(fi.Name); !ok {
+		t.Fatal("file referenced by another namespace is removed")
+	}
+	if u, _ := s.Usage("t1"); u != (QuotaUsage{}) {
+		t.Fatalf("quota is not released: %+v", u)
+	}
+
+	if w := do(h, http.MethodDelete, target, nil, t2); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if ok, _ := s.IsExists(fi.Name); ok {
+		t.Fatal("unreferenced file is kept")
+	}
+
+	// Защищённый файл остаётся после освобождения последним пространством имён
+	decodeJSON(t, do(h, http.MethodPost, "/blobs", data, t1), &fi)
+	if err := s.PlaceHold(fi.Name, "legal"); err != nil {
+		t.Fatal(err)
+	}
+	if w := do(h, http.MethodDelete, target, nil, t1); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if ok, _ := s.IsExists(fi.Name); !ok {
+		t.Fatal("file on hold is removed")
+	}
+}
@@ -0,0 +1,138 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/tenrok/filestore/encryption"
+)
+
+// WithRecovery включает проверку хранилища при открытии (см. Recover).
+// Если verifyHash равно true, проверяются хеш-суммы всех файлов, что требует их полного чтения.
+func WithRecovery(verifyHash bool) LocalStorageOption {
+	return func(s *LocalStorage) {
+		s.recovery = &verifyHash
+	}
+}
+
+// Recover ищет и удаляет повреждённые файлы хранилища, например оставшиеся после сбоя питания.
+// Повреждёнными считаются пустые файлы с именем непустого содержимого, файлы с нарушенной
+// структурой (сжатые, зашифрованные, манифесты) и манифесты, ссылающиеся на отсутствующие
+// фрагменты. Если verifyHash равно true, дополнительно проверяется, что содержимое файлов
+// соответствует их именам. Файлы, которые нельзя расшифровать из-за отсутствия ключа,
+// не удаляются. Использование квот пространств имён пересчитывается по метаданным файлов.
+// Возвращает имена удалённых файлов.
+func (s *LocalStorage) Recover(ctx context.Context, verifyHash bool) ([]string, error) {
+	var removed []string
+
+	// Сначала удаляем повреждённые файлы и фрагменты, затем манифесты,
+	// которые ссылаются на удалённые фрагменты
+	err := s.walkBlobs(ctx, func(name, path string, info fs.FileInfo) error {
+		if s.verifyBlob(ctx, name, info, verifyHash) == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if s.discardBlob(name, path) == nil {
+			removed = append(removed, name)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return removed, err
+	}
+
+	err = s.walkBlobs(ctx, func(name, path string, info fs.FileInfo) error {
+		chunks, err := s.manifestChunks(name, path)
+		if err != nil {
+			return nil
+		}
+		for _, c := range chunks {
+			if !s.hasChunk(c.name) {
+				if s.discardBlob(name, path) == nil {
+					removed = append(removed, name)
+				}
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return removed, err
+	}
+
+	// Использование квот могло разойтись с метаданными файлов при сбое
+	if err := s.recountQuota(ctx); err != nil {
+		return removed, err
+	}
+
+	return removed, nil
+}
+
+// verifyBlob проверяет целостность файла хранилища. Возвращает nil, если файл цел
+// или его нельзя проверить из-за отсутствия ключа шифрования.
+func (s *LocalStorage) verifyBlob(ctx context.Context, name string, info fs.FileInfo, verifyHash bool) error {
+	if info.Size() == 0 && name != newHasher().name() {
+		return errors.New("empty file")
+	}
+
+	fullPath, err := s.GetFullPath(name)
+	if err != nil {
+		return err
+	}
+	m, err := s.readMeta(name)
+	if err != nil {
+		return nil // без метаданных неизвестно, как закодировано содержимое
+	}
+	file, err := os.Open(fullPath)
+	if err != nil {
+		return err
+	}
+
+	f, err := s.decode(file, info, m.blobEncoding)
+	if err != nil {
+		file.Close()
+		if errors.Is(err, ErrNoKeyProvider) || errors.Is(err, encryption.ErrUnknownKey) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	if !verifyHash {
+		return nil
+	}
+
+	h := newHasher()
+	if _, err := copyHashed(ctx, io.Discard, f, h); err != nil {
+		return err
+	}
+	if h.name() != name {
+		return ErrDigestMismatch
+	}
+	return nil
+}
+
+// discardBlob удаляет повреждённый файл хранилища. Фрагменты, на которые ещё ссылаются
+// манифесты, удаляются без изменения счётчиков: ссылки освобождаются при удалении манифестов.
+func (s *LocalStorage) discardBlob(name, fullPath string) error {
+	mu := s.getMutex(name)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		s.releaseMutex(name)
+	}()
+
+	if refs, err := s.refs(name); err == nil && refs > 0 {
+		if err := os.Remove(fullPath); err != nil {
+			return err
+		}
+		s.removeEmptyParents(fullPath)
+		return s.syncRemoved(fullPath)
+	}
+	return s.removeBlob(name, fullPath)
+}
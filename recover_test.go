@@ -0,0 +1,155 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// corruptBlob заменяет хранимое содержимое файла name результатом fn.
+func corruptBlob(t *testing.T, s *LocalStorage, name string, fn func([]byte) []byte) {
+	t.Helper()
+
+	fullPath, err := s.GetFullPath(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fullPath, fn(readStored(t, s, name)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Пользовательские файлы, начинающиеся с сигнатур хранилища, не считаются повреждёнными.
+func TestRecoverKeepsUserFiles(t *testing.T) {
+	s := newTestStorage(t, WithCompression(CompressionPolicy{}), WithChunking(testChunkingPolicy))
+
+	var files []*FileInfo
+	for _, magic := range [][]byte{encryptedMagic, compressedMagic, manifestMagic[:]} {
+		data := append(bytes.Clone(magic), 0xff, 0x00, 0x13, 0x37)
+		files = append(files, createBlob(t, s, data))
+	}
+
+	for _, verifyHash := range []bool{false, true} {
+		removed, err := s.Recover(context.Background(), verifyHash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(removed) != 0 {
+			t.Fatalf("Recover(%v) removed user files %v", verifyHash, removed)
+		}
+	}
+	for _, fi := range files {
+		if got := readBlob(t, s, fi.Name); int64(len(got)) != fi.Size {
+			t.Fatalf("unexpected content %q", got)
+		}
+	}
+}
+
+func TestRecoverCorrupt(t *testing.T) {
+	cases := []struct {
+		name  string
+		opts  []LocalStorageOption
+		quick bool // повреждение содержимого обнаруживается без проверки хеш-сумм
+	}{
+		{name: "Plain", opts: nil},
+		{name: "Compressed", opts: []LocalStorageOption{WithCompression(CompressionPolicy{})}, quick: true},
+		{name: "Encrypted", opts: []LocalStorageOption{WithEncryption(newTestKeyring(t, "k1"))}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestStorage(t, tc.opts...)
+
+			text := func(s string) []byte { return []byte(strings.Repeat(s, 5000)) }
+			good := createBlob(t, s, text("good "))
+			empty := createBlob(t, s, text("interrupted "))
+			truncated := createBlob(t, s, text("truncated "))
+			flipped := createBlob(t, s, text("flipped "))
+			emptyFile := createBlob(t, s, nil)
+
+			corruptBlob(t, s, empty.Name, func(b []byte) []byte { return nil })
+			corruptBlob(t, s, truncated.Name, func(b []byte) []byte { return b[:len(b)/2] })
+			corruptBlob(t, s, flipped.Name, func(b []byte) []byte {
+				b[len(b)/2] ^= 0xff
+				return b
+			})
+
+			removed, err := s.Recover(context.Background(), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Contains(removed, empty.Name) {
+				t.Fatalf("empty file is not removed: %v", removed)
+			}
+			if tc.quick && !slices.Contains(removed, truncated.Name) {
+				t.Fatalf("truncated file is not removed: %v", removed)
+			}
+
+			more, err := s.Recover(context.Background(), true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			removed = append(removed, more...)
+			slices.Sort(removed)
+			want := []string{empty.Name, truncated.Name, flipped.Name}
+			slices.Sort(want)
+			if !slices.Equal(removed, want) {
+				t.Fatalf("expected %v to be removed, got %v", want, removed)
+			}
+
+			for _, fi := range []*FileInfo{good, emptyFile} {
+				if got := readBlob(t, s, fi.Name); int64(len(got)) != fi.Size {
+					t.Fatalf("intact file is damaged: %d bytes", len(got))
+				}
+			}
+			if _, err := s.Open(truncated.Name); !os.IsNotExist(err) {
+				t.Fatalf("expected os.ErrNotExist, got %v", err)
+			}
+		})
+	}
+}
+
+// Манифест, ссылающийся на отсутствующий фрагмент, удаляется.
+func TestRecoverChunked(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStorage(dir, WithChunking(testChunkingPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 100<<10)
+	rand.Read(data)
+	broken := createBlob(t, s, data)
+	rand.Read(data)
+	intact := createBlob(t, s, data)
+
+	chunks := chunkNames(t, s, broken.Name)
+	fullPath, err := s.GetFullPath(chunks[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(fullPath); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// Проверка выполняется при открытии хранилища
+	s, err = NewLocalStorage(dir, WithChunking(testChunkingPolicy), WithRecovery(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.Open(broken.Name); !os.IsNotExist(err) {
+		t.Fatalf("expected broken manifest to be removed, got %v", err)
+	}
+	if !bytes.Equal(readBlob(t, s, intact.Name), data) {
+		t.Fatal("intact file is damaged")
+	}
+	if removed, err := s.Recover(context.Background(), true); err != nil || len(removed) != 0 {
+		t.Fatalf("unexpected second Recover: %v, %v", removed, err)
+	}
+}
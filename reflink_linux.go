@@ -0,0 +1,15 @@
+//go:build linux
+
+package filestore
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// reflink создаёт копию файла src в dst, разделяющую с ним блоки данных (ioctl FICLONE).
+// Поддерживается файловыми системами с копированием при записи (Btrfs, XFS и т.п.).
+func reflink(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package filestore
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink на этой платформе не поддерживается.
+func reflink(dst, src *os.File) error {
+	return errors.ErrUnsupported
+}
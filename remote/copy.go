@@ -0,0 +1,88 @@
+package remote
+
+import (
+	"context"
+	"io"
+)
+
+// Copier реализуется хранилищами, которые умеют копировать и перемещать файлы
+// на стороне сервера, не передавая содержимое через клиента.
+//
+// Метаданные и тип содержимого исходного файла сохраняются. WithMetadata заменяет
+// метаданные копии, WithContentType — её тип содержимого.
+type Copier interface {
+	// Copy копирует файл src в dst. Существующий файл dst перезаписывается.
+	Copy(ctx context.Context, src, dst string, opts ...Option) error
+
+	// Move перемещает файл src в dst.
+	Move(ctx context.Context, src, dst string, opts ...Option) error
+}
+
+// Copy копирует файл srcName хранилища src в файл dstName хранилища dst. Если это одно
+// и то же хранилище и оно реализует Copier, копирование выполняется на стороне сервера,
+// иначе содержимое передаётся потоком через Open и Create.
+func Copy(ctx context.Context, dst Storage, dstName string, src Storage, srcName string, opts ...Option) error {
+	if c, ok := src.(Copier); ok && src == dst {
+		return c.Copy(ctx, srcName, dstName, opts...)
+	}
+	return streamCopy(ctx, dst, dstName, src, srcName, opts...)
+}
+
+// Move перемещает файл srcName хранилища src в файл dstName хранилища dst.
+// Исходный файл удаляется только после успешного копирования.
+func Move(ctx context.Context, dst Storage, dstName string, src Storage, srcName string, opts ...Option) error {
+	if c, ok := src.(Copier); ok && src == dst {
+		return c.Move(ctx, srcName, dstName, opts...)
+	}
+	if err := streamCopy(ctx, dst, dstName, src, srcName, opts...); err != nil {
+		return err
+	}
+	return src.Remove(srcName)
+}
+
+// streamCopy копирует файл через клиента, сохраняя метаданные и тип содержимого,
+// если они не заменены в opts. Ключ WithCustomerKey передаётся в dst.Create; исходный файл
+// читается через src как есть, поэтому WithSourceCustomerKey здесь не применяется.
+func streamCopy(ctx context.Context, dst Storage, dstName string, src Storage, srcName string, opts ...Option) error {
+	info, err := src.Stat(srcName)
+	if err != nil {
+		return err
+	}
+	o := &Options{Metadata: info.Metadata(), ContentType: info.ContentType()}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	f, err := src.Open(srcName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := dst.Create(dstName, WithMetadata(o.Metadata), WithContentType(o.ContentType), WithCustomerKey(o.CustomerKey))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, &contextReader{ctx: ctx, r: f}); err != nil {
+		w.Close()
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// contextReader прерывает чтение после отмены контекста.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,254 @@
+// Package encryptedstorage реализует обёртку над remote.Storage, которая шифрует объекты
+// на стороне клиента до отправки в удалённое хранилище.
+package encryptedstorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sync"
+
+	"github.com/tenrok/filestore/encryption"
+	"github.com/tenrok/filestore/remote"
+)
+
+// MetadataKeyID имя метаданных объекта, в которых сохраняется идентификатор мастер-ключа.
+const MetadataKeyID = "Encryption-Key-Id"
+
+// Убеждаемся в том, что мы всегда реализуем интерфейсы remote.Storage, remote.Uploader и remote.Lister.
+var (
+	_ remote.Storage  = (*EncryptedStorage)(nil)
+	_ remote.Uploader = (*EncryptedStorage)(nil)
+	_ remote.Lister   = (*EncryptedStorage)(nil)
+)
+
+// EncryptedStorage шифрует объекты AES-256-GCM блоками, сохраняя возможность чтения произвольных диапазонов.
+type EncryptedStorage struct {
+	storage remote.Storage
+	keys    encryption.KeyProvider
+}
+
+// New оборачивает хранилище storage. Ключи данных шифруются с помощью keys.
+func New(storage remote.Storage, keys encryption.KeyProvider) *EncryptedStorage {
+	return &EncryptedStorage{storage: storage, keys: keys}
+}
+
+// NewStorage не поддерживается: обёртка создаётся функцией New поверх существующего хранилища.
+func (s *EncryptedStorage) NewStorage(ctx context.Context, connString string) (remote.Storage, error) {
+	return nil, errors.New("encryptedstorage: use New to wrap an existing storage")
+}
+
+// Create создаёт зашифрованный файл. Идентификатор мастер-ключа записывается в метаданные объекта.
+func (s *EncryptedStorage) Create(name string, opts ...remote.Option) (io.WriteCloser, error) {
+	o := &remote.Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	key, err := encryption.GenerateDataKey(s.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := make(remote.Metadata, len(o.Metadata)+1)
+	for k, v := range o.Metadata {
+		metadata[k] = v
+	}
+	metadata[MetadataKeyID] = key.KeyID
+
+	w, err := s.storage.Create(name, remote.WithContentType(o.ContentType), remote.WithMetadata(metadata), remote.WithCustomerKey(o.CustomerKey))
+	if err != nil {
+		return nil, err
+	}
+
+	ew, err := encryption.NewWriter(w, key)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	return &writer{Writer: ew, w: w}, nil
+}
+
+// Open открывает файл и возвращает http.File, который расшифровывает данные при чтении.
+func (s *EncryptedStorage) Open(name string) (http.File, error) {
+	f, err := s.storage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.stat(name, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	r, err := encryption.NewReader(newReaderAt(f), info.Size(), s.keys)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &file{
+		SectionReader: io.NewSectionReader(r, 0, r.Size()),
+		file:          f,
+		info:          &fileInfo{FileInfo: info, size: r.Size()},
+	}, nil
+}
+
+// Remove удаляет файл.
+func (s *EncryptedStorage) Remove(name string) error {
+	return s.storage.Remove(name)
+}
+
+// Stat возвращает информацию о файле с размером расшифрованных данных.
+func (s *EncryptedStorage) Stat(name string) (remote.FileInfo, error) {
+	f, err := s.storage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := s.stat(name, f)
+	if err != nil {
+		return nil, err
+	}
+
+	_, size, err := encryption.Info(newReaderAt(f), info.Size())
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileInfo{FileInfo: info, size: size}, nil
+}
+
+// stat возвращает сведения об открытом файле f. Если файл не предоставляет remote.FileInfo,
+// они запрашиваются у исходного хранилища.
+func (s *EncryptedStorage) stat(name string, f http.File) (remote.FileInfo, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if ri, ok := info.(remote.FileInfo); ok {
+		return ri, nil
+	}
+	return s.storage.Stat(name)
+}
+
+// IsExists определяет, существует ли файл.
+func (s *EncryptedStorage) IsExists(name string) (bool, error) {
+	return s.storage.IsExists(name)
+}
+
+// List реализует метод remote.Lister, если его реализует исходное хранилище;
+// иначе возвращает errors.ErrUnsupported. Размеры файлов указываются для расшифрованных данных.
+func (s *EncryptedStorage) List(dir string) ([]remote.FileInfo, error) {
+	lister, ok := s.storage.(remote.Lister)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	infos, err := lister.List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, info := range infos {
+		if info.IsDir() {
+			continue
+		}
+		decrypted, err := s.Stat(path.Join(dir, path.Base(info.Name())))
+		if err != nil {
+			return nil, err
+		}
+		infos[i] = decrypted
+	}
+	return infos, nil
+}
+
+func (s *EncryptedStorage) Uploader() remote.Uploader { return s }
+
+func (s *EncryptedStorage) Upload(path string, reader io.Reader, opts ...remote.Option) error {
+	file, err := s.Create(path, opts...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// writer дописывает последний зашифрованный блок и закрывает нижележащий поток.
+type writer struct {
+	*encryption.Writer
+	w io.WriteCloser
+}
+
+func (w *writer) Close() error {
+	if err := w.Writer.Close(); err != nil {
+		w.w.Close()
+		return err
+	}
+	return w.w.Close()
+}
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс http.File.
+var _ http.File = (*file)(nil)
+
+// file реализует http.File поверх расшифровывающего потока.
+type file struct {
+	*io.SectionReader
+	file http.File
+	info fs.FileInfo
+}
+
+func (f *file) Close() error { return f.file.Close() }
+
+// Readdir требуется для http.File. Для файлов возвращает ошибку.
+func (f *file) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, fs.ErrInvalid
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// fileInfo подменяет размер зашифрованного объекта размером открытого текста.
+type fileInfo struct {
+	remote.FileInfo
+	size int64
+}
+
+func (fi *fileInfo) Size() int64 { return fi.size }
+
+// newReaderAt возвращает io.ReaderAt для файла. Если файл не поддерживает ReadAt,
+// чтение выполняется через Seek и Read под мьютексом.
+func newReaderAt(f http.File) io.ReaderAt {
+	if ra, ok := f.(io.ReaderAt); ok {
+		return ra
+	}
+	return &seekReaderAt{rs: f}
+}
+
+type seekReaderAt struct {
+	mu sync.Mutex
+	rs io.ReadSeeker
+}
+
+func (r *seekReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(r.rs, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
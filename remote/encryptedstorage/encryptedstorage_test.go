@@ -0,0 +1,221 @@
+package encryptedstorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/tenrok/filestore/encryption"
+	"github.com/tenrok/filestore/remote"
+	_ "github.com/tenrok/filestore/remote/memstorage"
+)
+
+func newTestStorage(t *testing.T) (*EncryptedStorage, remote.Storage) {
+	t.Helper()
+
+	keyring := encryption.NewKeyring()
+	if err := keyring.GenerateKey("k1"); err != nil {
+		t.Fatal(err)
+	}
+	storage, err := remote.NewStorage(context.Background(), "mem://"+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(storage, keyring), storage
+}
+
+func TestRoundtrip(t *testing.T) {
+	s, storage := newTestStorage(t)
+
+	// Несколько блоков шифрования и неполный последний блок
+	plain := make([]byte, 3*encryption.DefaultChunkSize+100)
+	rand.Read(plain)
+
+	if err := s.Upload("dir/a.bin", bytes.NewReader(plain), remote.WithContentType("application/x-test")); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := storage.Open("dir/a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := io.ReadAll(raw)
+	raw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, plain[:64]) {
+		t.Fatal("plaintext stored in the underlying storage")
+	}
+
+	f, err := s.Open("dir/a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Fatal("decrypted data mismatch")
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != int64(len(plain)) {
+		t.Fatalf("expected size %d, got %d", len(plain), info.Size())
+	}
+	ri, ok := info.(remote.FileInfo)
+	if !ok {
+		t.Fatalf("expected remote.FileInfo, got %T", info)
+	}
+	if ri.ContentType() != "application/x-test" {
+		t.Fatalf("unexpected content type %q", ri.ContentType())
+	}
+	if ri.Metadata()[MetadataKeyID] != "k1" {
+		t.Fatalf("unexpected metadata %v", ri.Metadata())
+	}
+}
+
+func TestRangedRead(t *testing.T) {
+	s, _ := newTestStorage(t)
+
+	plain := make([]byte, 2*encryption.DefaultChunkSize+1000)
+	rand.Read(plain)
+	if err := s.Upload("a.bin", bytes.NewReader(plain)); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := s.Open("a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cases := []struct {
+		name   string
+		offset int64
+		size   int
+	}{
+		{name: "Start", offset: 0, size: 10},
+		{name: "Inside chunk", offset: 100, size: 1000},
+		{name: "Across chunks", offset: encryption.DefaultChunkSize - 10, size: 20},
+		{name: "Tail", offset: int64(len(plain)) - 7, size: 7},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := f.Seek(tc.offset, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			got := make([]byte, tc.size)
+			if _, err := io.ReadFull(f, got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, plain[tc.offset:tc.offset+int64(tc.size)]) {
+				t.Fatal("data mismatch")
+			}
+		})
+	}
+
+	// Чтение за концом файла
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Read(make([]byte, 1)); n != 0 || err != io.EOF {
+		t.Fatalf("expected io.EOF, got %d, %v", n, err)
+	}
+}
+
+func TestStatAndList(t *testing.T) {
+	s, storage := newTestStorage(t)
+
+	files := map[string]int{
+		"dir/empty":   0,
+		"dir/small":   10,
+		"dir/big":     encryption.DefaultChunkSize + 1,
+		"dir/sub/x":   5,
+		"outside.bin": 3,
+	}
+	for name, size := range files {
+		if err := s.Upload(name, bytes.NewReader(make([]byte, size))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, size := range files {
+		info, err := s.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != int64(size) {
+			t.Errorf("Stat(%q): expected size %d, got %d", name, size, info.Size())
+		}
+		raw, err := storage.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if raw.Size() <= info.Size() {
+			t.Errorf("Stat(%q): encrypted size %d is not larger than plaintext size %d", name, raw.Size(), info.Size())
+		}
+	}
+
+	infos, err := s.List("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for _, info := range infos {
+		name := strings.TrimSuffix(info.Name(), "/")
+		seen[name] = true
+		if info.IsDir() {
+			continue
+		}
+		if size := files[name]; info.Size() != int64(size) {
+			t.Errorf("List: %q expected size %d, got %d", info.Name(), size, info.Size())
+		}
+	}
+	for _, name := range []string{"dir/empty", "dir/small", "dir/big", "dir/sub"} {
+		if !seen[name] {
+			t.Errorf("List: %q is missing in %v", name, seen)
+		}
+	}
+	if len(infos) != 4 {
+		t.Errorf("List: expected 4 entries, got %d", len(infos))
+	}
+}
+
+// keyRecorder запоминает ключ SSE-C, переданный в Create.
+type keyRecorder struct {
+	remote.Storage
+	key []byte
+}
+
+func (s *keyRecorder) Create(name string, opts ...remote.Option) (io.WriteCloser, error) {
+	o := &remote.Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	s.key = o.CustomerKey
+	return s.Storage.Create(name, opts...)
+}
+
+func TestCustomerKey(t *testing.T) {
+	es, storage := newTestStorage(t)
+	rec := &keyRecorder{Storage: storage}
+	s := New(rec, es.keys)
+
+	key := bytes.Repeat([]byte{1}, 32)
+	if err := s.Upload("a", strings.NewReader("data"), remote.WithCustomerKey(key)); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rec.key, key) {
+		t.Fatalf("customer key is not passed to the underlying storage: %x", rec.key)
+	}
+}
@@ -0,0 +1,115 @@
+package filestorage
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+
+	"github.com/tenrok/filestore/remote"
+)
+
+// Убеждаемся в том, что мы всегда реализуем интерфейсы http.File и remote.VersionWriter.
+var (
+	_ http.File            = (*file)(nil)
+	_ http.File            = (*dirFile)(nil)
+	_ remote.VersionWriter = (*fileWriter)(nil)
+)
+
+// file описывает открытую версию файла.
+type file struct {
+	*os.File
+	info fs.FileInfo
+}
+
+// Readdir требуется для http.File. Для файлов возвращает ошибку.
+func (f *file) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, fs.ErrInvalid
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// dirFile описывает открытый каталог.
+type dirFile struct {
+	info    fs.FileInfo
+	entries []remote.FileInfo
+	offset  int
+}
+
+func (d *dirFile) Close() error               { return nil }
+func (d *dirFile) Read([]byte) (int, error)   { return 0, fs.ErrInvalid }
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *dirFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		d.offset = 0
+		return 0, nil
+	}
+	return 0, fs.ErrInvalid
+}
+
+func (d *dirFile) Readdir(count int) ([]fs.FileInfo, error) {
+	rest := d.entries[d.offset:]
+	if count > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count <= 0 || count > len(rest) {
+		count = len(rest)
+	}
+	infos := make([]fs.FileInfo, count)
+	for i := range infos {
+		infos[i] = rest[i]
+	}
+	d.offset += count
+	return infos, nil
+}
+
+// fileWriter записывает содержимое во временный файл и при закрытии делает его текущей версией.
+type fileWriter struct {
+	s         *FileStorage
+	name      string
+	f         *os.File
+	versionID string
+}
+
+func (w *fileWriter) Write(p []byte) (int, error) {
+	if err := w.ctxErr(); err != nil {
+		return 0, err
+	}
+	return w.f.Write(p)
+}
+
+func (w *fileWriter) Close() error {
+	if err := w.ctxErr(); err != nil {
+		w.abort()
+		return err
+	}
+	if err := w.f.Close(); err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+	id, err := w.s.commit(w.name, w.f.Name())
+	if err != nil {
+		os.Remove(w.f.Name())
+		return &fs.PathError{Op: "create", Path: w.name, Err: err}
+	}
+	w.versionID = id
+	return nil
+}
+
+// VersionID реализует метод remote.VersionWriter.
+func (w *fileWriter) VersionID() string { return w.versionID }
+
+// abort удаляет незавершённую загрузку.
+func (w *fileWriter) abort() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+func (w *fileWriter) ctxErr() error {
+	if w.s.ctx == nil {
+		return nil
+	}
+	return context.Cause(w.s.ctx)
+}
@@ -0,0 +1,70 @@
+package filestorage
+
+import (
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"time"
+
+	"github.com/tenrok/filestore/remote"
+)
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс remote.FileInfo.
+var _ remote.FileInfo = (*fileInfo)(nil)
+
+// fileInfo реализует remote.FileInfo.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func newFileInfo(name string, info fs.FileInfo) *fileInfo {
+	return &fileInfo{name: name, size: info.Size(), modTime: info.ModTime()}
+}
+
+func newDirInfo(name string) *fileInfo {
+	return &fileInfo{name: name + "/", dir: true}
+}
+
+func (f *fileInfo) Name() string { return f.name }
+
+func (f *fileInfo) Size() int64 { return f.size }
+
+func (f *fileInfo) Mode() os.FileMode {
+	if f.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (f *fileInfo) ModTime() time.Time { return f.modTime }
+
+func (f *fileInfo) IsDir() bool { return f.dir }
+
+func (f *fileInfo) Sys() interface{} { return nil }
+
+// ContentType возвращает тип содержимого, определённый по расширению имени файла.
+func (f *fileInfo) ContentType() string {
+	if f.dir {
+		return ""
+	}
+	return mime.TypeByExtension(path.Ext(f.name))
+}
+
+// ETag строится из времени изменения и размера файла.
+func (f *fileInfo) ETag() string {
+	if f.dir {
+		return ""
+	}
+	return fmt.Sprintf("%x-%x", f.modTime.UnixNano(), f.size)
+}
+
+// Metadata возвращает nil: хранилище не сохраняет пользовательские метаданные.
+func (f *fileInfo) Metadata() remote.Metadata { return nil }
+
+// Tags возвращает nil: хранилище не сохраняет теги.
+func (f *fileInfo) Tags() remote.Tags { return nil }
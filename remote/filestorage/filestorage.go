@@ -0,0 +1,579 @@
+// Package filestorage реализует удалённое хранилище в каталоге локальной файловой системы.
+// Оно регистрируется под схемой "file":
+//
+//	remote.NewStorage(ctx, "file:///var/lib/files?versions=10")
+//
+// При перезаписи и удалении файлов их предыдущие версии сохраняются в скрытом каталоге
+// .versions в корне хранилища; параметр versions ограничивает количество хранимых предыдущих
+// версий каждого файла (по умолчанию DefaultVersions, 0 отключает хранение).
+// Пользовательские метаданные, теги и тип содержимого не сохраняются.
+package filestorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tenrok/filestore/remote"
+)
+
+// DefaultVersions количество хранимых предыдущих версий файла по умолчанию.
+const DefaultVersions = 10
+
+// versionsDir скрытый каталог в корне хранилища. В подкаталоге files лежат все версии файлов,
+// включая текущие (жёсткие ссылки на них находятся под своими именами в корне хранилища),
+// в подкаталоге tmp — незавершённые загрузки.
+const versionsDir = ".versions"
+
+// Убеждаемся в том, что мы всегда реализуем интерфейсы remote.Storage, remote.Lister
+// и remote.Versioner.
+var (
+	_ remote.Storage   = (*FileStorage)(nil)
+	_ remote.Lister    = (*FileStorage)(nil)
+	_ remote.Versioner = (*FileStorage)(nil)
+)
+
+func init() {
+	remote.Register("file", &FileStorage{})
+}
+
+var (
+	locksMu sync.Mutex
+	locks   = make(map[string]*sync.Mutex)
+)
+
+type FileStorage struct {
+	ctx      context.Context
+	root     string
+	mu       *sync.Mutex // общий для подключений к одному каталогу
+	versions int         // количество хранимых предыдущих версий
+}
+
+func (s *FileStorage) NewStorage(ctx context.Context, connString string) (remote.Storage, error) {
+	u, err := url.Parse(connString)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := DefaultVersions
+	if v := u.Query().Get("versions"); v != "" {
+		if versions, err = strconv.Atoi(v); err != nil || versions < 0 {
+			return nil, fmt.Errorf("invalid versions value: %q", v)
+		}
+	}
+
+	root := u.Host + u.Path
+	if root == "" {
+		return nil, errors.New("empty root directory")
+	}
+	if root, err = filepath.Abs(filepath.FromSlash(root)); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Join(root, versionsDir, "tmp"), 0755); err != nil {
+		return nil, err
+	}
+
+	locksMu.Lock()
+	defer locksMu.Unlock()
+
+	mu, ok := locks[root]
+	if !ok {
+		mu = &sync.Mutex{}
+		locks[root] = mu
+	}
+	return &FileStorage{ctx: ctx, root: root, mu: mu, versions: versions}, nil
+}
+
+func (s *FileStorage) Create(name string, opts ...remote.Option) (io.WriteCloser, error) {
+	name, err := resolve("create", name)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+
+	f, err := os.CreateTemp(s.tmpDir(), "upload-*")
+	if err != nil {
+		return nil, err
+	}
+	return &fileWriter{s: s, name: name, f: f}, nil
+}
+
+func (s *FileStorage) Open(name string) (http.File, error) {
+	name, err := resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(s.path(name))
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	if info.IsDir() {
+		entries, err := s.List(name)
+		if err != nil {
+			return nil, err
+		}
+		return &dirFile{info: newDirInfo(name), entries: entries}, nil
+	}
+
+	f, err := os.Open(s.path(name))
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &file{File: f, info: newFileInfo(name, info)}, nil
+}
+
+func (s *FileStorage) Remove(name string) error {
+	name, err := resolve("remove", name)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if info, err := os.Stat(s.path(name)); err != nil || !info.Mode().IsRegular() {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	ids, err := s.keepCurrent(name)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	if err := os.Remove(s.path(name)); err != nil {
+		return pathError("remove", name, err)
+	}
+	s.removeEmptyDirs(filepath.Dir(s.path(name)), s.root)
+	s.trim(name, ids, s.versions)
+	return nil
+}
+
+func (s *FileStorage) Stat(name string) (remote.FileInfo, error) {
+	name, err := resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(s.path(name))
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	if info.IsDir() {
+		return newDirInfo(name), nil
+	}
+	return newFileInfo(name, info), nil
+}
+
+func (s *FileStorage) IsExists(name string) (bool, error) {
+	name, err := resolve("stat", name)
+	if err != nil {
+		return false, nil
+	}
+
+	info, err := os.Stat(s.path(name))
+	if err != nil {
+		if err = pathError("stat", name, err); errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	return info.Mode().IsRegular(), nil
+}
+
+// List реализует метод remote.Lister.
+func (s *FileStorage) List(dir string) ([]remote.FileInfo, error) {
+	dir, err := resolve("list", dir)
+	if err != nil {
+		return nil, nil
+	}
+	prefix := dir
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	entries, err := os.ReadDir(s.path(dir))
+	if err != nil {
+		// Как и в объектных хранилищах, отсутствующий каталог просто пуст
+		if info, serr := os.Stat(s.path(dir)); errors.Is(serr, fs.ErrNotExist) || serr == nil && !info.IsDir() {
+			return nil, nil
+		}
+		return nil, pathError("list", dir, err)
+	}
+
+	var infos []remote.FileInfo
+	for _, e := range entries {
+		if dir == "" && e.Name() == versionsDir {
+			continue
+		}
+		if e.IsDir() {
+			infos = append(infos, newDirInfo(prefix+e.Name()))
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, pathError("list", dir, err)
+		}
+		if info.Mode().IsRegular() {
+			infos = append(infos, newFileInfo(prefix+e.Name(), info))
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (s *FileStorage) Uploader() remote.Uploader { return s }
+
+func (s *FileStorage) Upload(path string, reader io.Reader, opts ...remote.Option) error {
+	file, err := s.Create(path, opts...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, reader); err != nil {
+		file.(*fileWriter).abort()
+		return err
+	}
+
+	return file.Close()
+}
+
+// OpenVersion реализует метод remote.Versioner.
+func (s *FileStorage) OpenVersion(name, versionID string) (http.File, error) {
+	name, err := resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, info, err := s.findVersion(name, versionID)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &file{File: f, info: newFileInfo(name, info)}, nil
+}
+
+// StatVersion реализует метод remote.Versioner.
+func (s *FileStorage) StatVersion(name, versionID string) (remote.FileInfo, error) {
+	name, err := resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, info, err := s.findVersion(name, versionID)
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+	return newFileInfo(name, info), nil
+}
+
+// ListVersions реализует метод remote.Versioner. Файл, помещённый в каталог хранилища
+// в обход него, до первой перезаписи или удаления имеет версию с пустым идентификатором.
+func (s *FileStorage) ListVersions(name string) ([]remote.Version, error) {
+	name, err := resolve("listversions", name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids, err := s.listIDs(name)
+	if err != nil {
+		return nil, pathError("listversions", name, err)
+	}
+	current := s.current(name)
+
+	var versions []remote.Version
+	for _, id := range ids {
+		info, err := os.Stat(s.versionPath(name, id))
+		if err != nil {
+			return nil, pathError("listversions", name, err)
+		}
+		latest := current != nil && os.SameFile(current, info)
+		if latest {
+			current = nil
+		}
+		versions = append(versions, remote.Version{ID: id, Size: info.Size(), ModTime: info.ModTime(), IsLatest: latest})
+	}
+	if current != nil {
+		versions = append([]remote.Version{{Size: current.Size(), ModTime: current.ModTime(), IsLatest: true}}, versions...)
+	}
+	if len(versions) == 0 {
+		return nil, &fs.PathError{Op: "listversions", Path: name, Err: fs.ErrNotExist}
+	}
+	return versions, nil
+}
+
+// RemoveVersion реализует метод remote.Versioner. При удалении текущей версии
+// текущей становится самая новая из предыдущих.
+func (s *FileStorage) RemoveVersion(name, versionID string) error {
+	name, err := resolve("removeversion", name)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !validID(versionID) {
+		return &fs.PathError{Op: "removeversion", Path: name, Err: fs.ErrNotExist}
+	}
+	p := s.versionPath(name, versionID)
+	info, err := os.Stat(p)
+	if err != nil {
+		return pathError("removeversion", name, err)
+	}
+
+	if current := s.current(name); current != nil && os.SameFile(current, info) {
+		if err := os.Remove(s.path(name)); err != nil {
+			return pathError("removeversion", name, err)
+		}
+		ids, err := s.listIDs(name)
+		if err != nil {
+			return pathError("removeversion", name, err)
+		}
+		for _, id := range ids {
+			if id != versionID {
+				if err := s.link(s.versionPath(name, id), s.path(name)); err != nil {
+					return pathError("removeversion", name, err)
+				}
+				break
+			}
+		}
+	}
+
+	if err := os.Remove(p); err != nil {
+		return pathError("removeversion", name, err)
+	}
+	s.removeEmptyDirs(filepath.Dir(p), filepath.Join(s.root, versionsDir, "files"))
+	s.removeEmptyDirs(filepath.Dir(s.path(name)), s.root)
+	return nil
+}
+
+// commit сохраняет загруженный файл tmp как текущую версию файла name и возвращает
+// её идентификатор.
+func (s *FileStorage) commit(name, tmp string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(s.versionsPath(name), 0755); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path(name)), 0755); err != nil {
+		return "", err
+	}
+	ids, err := s.keepCurrent(name)
+	if err != nil {
+		return "", err
+	}
+
+	id := nextID(ids)
+	if err := os.Rename(tmp, s.versionPath(name, id)); err != nil {
+		return "", err
+	}
+	if err := s.link(s.versionPath(name, id), s.path(name)); err != nil {
+		os.Remove(s.versionPath(name, id))
+		return "", err
+	}
+	s.trim(name, append([]string{id}, ids...), s.versions+1)
+	return id, nil
+}
+
+// keepCurrent сохраняет в скрытом каталоге текущую версию файла name, если её там нет,
+// и возвращает идентификаторы версий, начиная с самой новой. Вызывающий должен удерживать мьютекс.
+func (s *FileStorage) keepCurrent(name string) ([]string, error) {
+	ids, err := s.listIDs(name)
+	if err != nil {
+		return nil, err
+	}
+	current := s.current(name)
+	if current == nil {
+		return ids, nil
+	}
+	for _, id := range ids {
+		if info, err := os.Stat(s.versionPath(name, id)); err == nil && os.SameFile(current, info) {
+			return ids, nil
+		}
+	}
+
+	if err := os.MkdirAll(s.versionsPath(name), 0755); err != nil {
+		return nil, err
+	}
+	id := nextID(ids)
+	if err := os.Link(s.path(name), s.versionPath(name, id)); err != nil {
+		return nil, err
+	}
+	return append([]string{id}, ids...), nil
+}
+
+// trim удаляет версии файла name сверх первых keep из ids. Вызывающий должен удерживать мьютекс.
+func (s *FileStorage) trim(name string, ids []string, keep int) {
+	if len(ids) <= keep {
+		return
+	}
+	for _, id := range ids[keep:] {
+		os.Remove(s.versionPath(name, id))
+	}
+	s.removeEmptyDirs(s.versionsPath(name), filepath.Join(s.root, versionsDir, "files"))
+}
+
+// listIDs возвращает идентификаторы сохранённых версий файла name, начиная с самой новой.
+func (s *FileStorage) listIDs(name string) ([]string, error) {
+	entries, err := os.ReadDir(s.versionsPath(name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var ids []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && validID(e.Name()) {
+			ids = append(ids, e.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids, nil
+}
+
+// findVersion возвращает путь и сведения о версии файла. Пустой versionID означает текущую версию.
+func (s *FileStorage) findVersion(name, versionID string) (string, fs.FileInfo, error) {
+	p := s.path(name)
+	if versionID != "" {
+		if !validID(versionID) {
+			return "", nil, fs.ErrNotExist
+		}
+		p = s.versionPath(name, versionID)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return "", nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return "", nil, fs.ErrNotExist
+	}
+	return p, info, nil
+}
+
+// current возвращает сведения о текущей версии файла name или nil, если файла нет.
+func (s *FileStorage) current(name string) fs.FileInfo {
+	info, err := os.Stat(s.path(name))
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+	return info
+}
+
+// link атомарно заменяет файл dst жёсткой ссылкой на src.
+func (s *FileStorage) link(src, dst string) error {
+	tmp := filepath.Join(s.tmpDir(), "link-"+filepath.Base(src))
+	os.Remove(tmp)
+	if err := os.Link(src, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// removeEmptyDirs удаляет пустые каталоги, начиная с dir и поднимаясь до stop (не включая его).
+func (s *FileStorage) removeEmptyDirs(dir, stop string) {
+	for dir != stop && strings.HasPrefix(dir, stop) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// path возвращает путь к текущей версии файла name.
+func (s *FileStorage) path(name string) string {
+	return filepath.Join(s.root, filepath.FromSlash(name))
+}
+
+// versionsPath возвращает путь к каталогу версий файла name.
+func (s *FileStorage) versionsPath(name string) string {
+	return filepath.Join(s.root, versionsDir, "files", filepath.FromSlash(name))
+}
+
+// versionPath возвращает путь к версии versionID файла name.
+func (s *FileStorage) versionPath(name, versionID string) string {
+	return filepath.Join(s.versionsPath(name), versionID)
+}
+
+func (s *FileStorage) tmpDir() string {
+	return filepath.Join(s.root, versionsDir, "tmp")
+}
+
+// nextID возвращает идентификатор новой версии, больший идентификаторов ids.
+func nextID(ids []string) string {
+	n := uint64(time.Now().UnixNano())
+	if len(ids) > 0 {
+		if last, err := strconv.ParseUint(ids[0], 16, 64); err == nil && n <= last {
+			n = last + 1
+		}
+	}
+	return fmt.Sprintf("%016x", n)
+}
+
+// validID проверяет, что id является идентификатором версии.
+func validID(id string) bool {
+	if len(id) != 16 {
+		return false
+	}
+	_, err := strconv.ParseUint(id, 16, 64)
+	return err == nil
+}
+
+// resolve приводит имя файла к виду "a/b" без начальной косой черты.
+// Скрытый каталог версий через хранилище недоступен.
+func resolve(op, name string) (string, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == versionsDir || strings.HasPrefix(name, versionsDir+"/") {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return name, nil
+}
+
+// pathError оборачивает ошибку файловой системы в *fs.PathError с именем файла хранилища
+// вместо пути в локальной файловой системе.
+func pathError(op, name string, err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		err = pe.Err
+	}
+	// Путь, проходящий через файл, не существует
+	if errors.Is(err, syscall.ENOTDIR) {
+		err = fs.ErrNotExist
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
@@ -0,0 +1,206 @@
+package filestorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/tenrok/filestore/remote"
+)
+
+func newTestStorage(t *testing.T, query string, files map[string]string) (remote.Storage, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	s, err := remote.NewStorage(context.Background(), "file://"+filepath.ToSlash(root)+query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := s.Uploader().Upload(name, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s, root
+}
+
+// write сохраняет data в файл name и возвращает идентификатор версии.
+func write(t *testing.T, s remote.Storage, name, data string) string {
+	t.Helper()
+
+	w, err := s.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return remote.VersionID(w)
+}
+
+func TestFS(t *testing.T) {
+	s, _ := newTestStorage(t, "", map[string]string{
+		"a.txt":          "a",
+		"dir/b.txt":      "bb",
+		"dir/sub/c.txt":  "ccc",
+		"other/d.bin":    "",
+		"dir/sub/e.json": "{}",
+	})
+	write(t, s, "a.txt", "overwritten")
+
+	if err := fstest.TestFS(remote.FS(s), "a.txt", "dir/b.txt", "dir/sub/c.txt", "other/d.bin", "dir/sub/e.json"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFSNotExist(t *testing.T) {
+	s, _ := newTestStorage(t, "", map[string]string{"dir/a.txt": "a"})
+	fsys := remote.FS(s)
+
+	for _, name := range []string{"missing", "dir/missing", "dir/a.txt/x", versionsDir} {
+		if _, err := fs.Stat(fsys, name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(%q): expected fs.ErrNotExist, got %v", name, err)
+		}
+	}
+	if _, err := s.Create(versionsDir + "/tmp/x"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Create in hidden directory: expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	s, root := newTestStorage(t, "?versions=0", map[string]string{"dir/a": "a"})
+
+	if err := s.Remove("dir/a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove("dir/a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+	if ok, err := s.IsExists("dir/a"); ok || err != nil {
+		t.Fatalf("IsExists: %v, %v", ok, err)
+	}
+
+	// Без хранения версий от файла ничего не остаётся
+	for _, dir := range []string{filepath.Join(root, "dir"), filepath.Join(root, versionsDir, "files", "dir")} {
+		if _, err := os.Stat(dir); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected %s to be removed, got %v", dir, err)
+		}
+	}
+}
+
+func TestVersions(t *testing.T) {
+	s, root := newTestStorage(t, "?versions=2", nil)
+	v := s.(remote.Versioner)
+
+	var ids []string
+	for _, data := range []string{"v1", "v2", "v3", "v4"} {
+		ids = append(ids, write(t, s, "a", data))
+	}
+
+	versions, err := v.ListVersions("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || versions[0].ID != ids[3] || !versions[0].IsLatest || versions[1].IsLatest || versions[2].ID != ids[1] {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+	if _, err := v.StatVersion("a", ids[0]); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected trimmed version to be gone, got %v", err)
+	}
+
+	f, err := v.OpenVersion("a", ids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "v3" {
+		t.Fatalf("expected v3, got %q", data)
+	}
+
+	// Удаление текущей версии восстанавливает предыдущую.
+	if err := v.RemoveVersion("a", ids[3]); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(filepath.Join(root, "a")); err != nil || string(data) != "v3" {
+		t.Fatalf("unexpected current version %q, %v", data, err)
+	}
+	if versions, _ := v.ListVersions("a"); len(versions) != 2 || versions[0].ID != ids[2] || !versions[0].IsLatest {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+
+	// Удалённый файл остаётся доступен в истории.
+	if err := s.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.StatVersion("a", ids[2]); err != nil {
+		t.Fatal(err)
+	}
+	if versions, _ := v.ListVersions("a"); len(versions) != 2 || versions[0].IsLatest {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+	if err := v.RemoveVersion("a", "../../a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+// Файл, помещённый в каталог хранилища напрямую, сохраняется в истории при перезаписи.
+func TestVersionsForeignFile(t *testing.T) {
+	s, root := newTestStorage(t, "", nil)
+	v := s.(remote.Versioner)
+
+	if err := os.WriteFile(filepath.Join(root, "a"), []byte("foreign"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := v.ListVersions("a")
+	if err != nil || len(versions) != 1 || versions[0].ID != "" || !versions[0].IsLatest {
+		t.Fatalf("unexpected versions: %+v, %v", versions, err)
+	}
+
+	id := write(t, s, "a", "new")
+	versions, err = v.ListVersions("a")
+	if err != nil || len(versions) != 2 || versions[0].ID != id || versions[1].ID == "" {
+		t.Fatalf("unexpected versions: %+v, %v", versions, err)
+	}
+	f, err := v.OpenVersion("a", versions[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "foreign" {
+		t.Fatalf("expected foreign, got %q", data)
+	}
+}
+
+func TestCreateCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	root := t.TempDir()
+	s, err := remote.NewStorage(ctx, "file://"+filepath.ToSlash(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := s.Create("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(w, "partial")
+	cancel()
+	if err := w.Close(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if ok, _ := s.IsExists("a"); ok {
+		t.Fatal("canceled upload is stored")
+	}
+	if entries, _ := os.ReadDir(filepath.Join(root, versionsDir, "tmp")); len(entries) != 0 {
+		t.Fatalf("temporary files are left: %v", entries)
+	}
+}
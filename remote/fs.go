@@ -0,0 +1,201 @@
+package remote
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Убеждаемся в том, что мы всегда реализуем интерфейсы fs.FS.
+var (
+	_ fs.FS          = (*storageFS)(nil)
+	_ fs.StatFS      = (*storageFS)(nil)
+	_ fs.ReadDirFS   = (*storageFS)(nil)
+	_ fs.ReadFileFS  = (*storageFS)(nil)
+	_ fs.ReadDirFile = (*dirFile)(nil)
+)
+
+// FS возвращает представление удалённого хранилища s в виде fs.FS. Каталоги читаются,
+// только если хранилище реализует Lister; иначе чтение каталогов возвращает errors.ErrUnsupported.
+func FS(s Storage) fs.FS {
+	return &storageFS{s: s}
+}
+
+// storageFS реализует fs.FS поверх Storage.
+type storageFS struct {
+	s Storage
+}
+
+// Open реализует метод fs.FS.
+func (f *storageFS) Open(name string) (fs.File, error) {
+	info, err := f.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		entries, err := f.readDir("open", name)
+		if err != nil {
+			return nil, err
+		}
+		return &dirFile{info: info, entries: entries}, nil
+	}
+
+	file, err := f.s.Open(name)
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return &storageFile{File: file, info: info}, nil
+}
+
+// Stat реализует метод fs.StatFS.
+func (f *storageFS) Stat(name string) (fs.FileInfo, error) {
+	return f.stat("stat", name)
+}
+
+// ReadDir реализует метод fs.ReadDirFS.
+func (f *storageFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, err := f.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	return f.readDir("readdir", name)
+}
+
+// ReadFile реализует метод fs.ReadFileFS.
+func (f *storageFS) ReadFile(name string) ([]byte, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// stat возвращает сведения о файле или каталоге name. Каталогом считается корень
+// и любой путь, в котором есть файлы.
+func (f *storageFS) stat(op, name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return dirInfo("."), nil
+	}
+
+	info, err := f.s.Stat(name)
+	if err == nil && !info.IsDir() {
+		return fileInfo{info, path.Base(name)}, nil
+	}
+
+	// Каталоги в объектных хранилищах существуют лишь как общие префиксы имён
+	if lister, ok := f.s.(Lister); ok {
+		if entries, lerr := lister.List(name); lerr == nil && len(entries) > 0 {
+			return dirInfo(path.Base(name)), nil
+		}
+	}
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		err = fs.ErrNotExist
+	}
+	return nil, pathError(op, name, err)
+}
+
+// readDir читает содержимое каталога name.
+func (f *storageFS) readDir(op, name string) ([]fs.DirEntry, error) {
+	lister, ok := f.s.(Lister)
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: errors.ErrUnsupported}
+	}
+	dir := name
+	if dir == "." {
+		dir = ""
+	}
+	infos, err := lister.List(dir)
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		base := path.Base(strings.TrimSuffix(info.Name(), "/"))
+		if info.IsDir() {
+			entries = append(entries, fs.FileInfoToDirEntry(dirInfo(base)))
+		} else {
+			entries = append(entries, fs.FileInfoToDirEntry(fileInfo{info, base}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// pathError оборачивает ошибку хранилища в *fs.PathError.
+func pathError(op, name string, err error) error {
+	var pe *fs.PathError
+	if errors.As(err, &pe) {
+		return &fs.PathError{Op: op, Path: name, Err: pe.Err}
+	}
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// storageFile описывает открытый файл удалённого хранилища.
+type storageFile struct {
+	http.File
+	info fs.FileInfo
+}
+
+func (f *storageFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// fileInfo подменяет имя файла его последним элементом пути.
+type fileInfo struct {
+	FileInfo
+	name string
+}
+
+func (fi fileInfo) Name() string { return fi.name }
+
+// dirInfo описывает каталог, который существует лишь как общий префикс имён файлов.
+type dirInfo string
+
+func (d dirInfo) Name() string       { return string(d) }
+func (d dirInfo) Size() int64        { return 0 }
+func (d dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0555 }
+func (d dirInfo) ModTime() time.Time { return time.Time{} }
+func (d dirInfo) IsDir() bool        { return true }
+func (d dirInfo) Sys() any           { return nil }
+
+// dirFile описывает открытый каталог. Содержимое каталога фиксируется при открытии.
+type dirFile struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dirFile) Close() error               { return nil }
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: fs.ErrInvalid}
+}
+
+// ReadDir реализует метод fs.ReadDirFile.
+func (d *dirFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	d.offset += count
+	return rest[:count], nil
+}
@@ -0,0 +1,108 @@
+package memstorage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/tenrok/filestore/remote"
+)
+
+// Убеждаемся в том, что мы всегда реализуем интерфейсы http.File и remote.VersionWriter.
+var (
+	_ http.File            = (*memFile)(nil)
+	_ http.File            = (*memDir)(nil)
+	_ remote.VersionWriter = (*memWriter)(nil)
+)
+
+// memFile описывает открытый объект.
+type memFile struct {
+	*bytes.Reader
+	info fs.FileInfo
+}
+
+func (f *memFile) Close() error { return nil }
+
+// Readdir требуется для http.File. Для файлов возвращает ошибку.
+func (f *memFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, fs.ErrInvalid
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+// memDir описывает открытый каталог.
+type memDir struct {
+	info    fs.FileInfo
+	entries []remote.FileInfo
+	offset  int
+}
+
+func (d *memDir) Close() error               { return nil }
+func (d *memDir) Read([]byte) (int, error)   { return 0, fs.ErrInvalid }
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *memDir) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekStart {
+		d.offset = 0
+		return 0, nil
+	}
+	return 0, fs.ErrInvalid
+}
+
+func (d *memDir) Readdir(count int) ([]fs.FileInfo, error) {
+	rest := d.entries[d.offset:]
+	if count > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count <= 0 || count > len(rest) {
+		count = len(rest)
+	}
+	infos := make([]fs.FileInfo, count)
+	for i := range infos {
+		infos[i] = rest[i]
+	}
+	d.offset += count
+	return infos, nil
+}
+
+// memWriter накапливает содержимое объекта и сохраняет его при закрытии.
+type memWriter struct {
+	s         *MemStorage
+	name      string
+	opts      *remote.Options
+	buffer    bytes.Buffer
+	versionID string
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	if err := w.ctxErr(); err != nil {
+		return 0, err
+	}
+	return w.buffer.Write(p)
+}
+
+func (w *memWriter) Close() error {
+	if err := w.ctxErr(); err != nil {
+		return err
+	}
+	w.versionID = w.s.put(w.name, &object{
+		data:        bytes.Clone(w.buffer.Bytes()),
+		modTime:     time.Now(),
+		contentType: w.opts.ContentType,
+		metadata:    w.opts.Metadata,
+	})
+	return nil
+}
+
+// VersionID реализует метод remote.VersionWriter.
+func (w *memWriter) VersionID() string { return w.versionID }
+
+func (w *memWriter) ctxErr() error {
+	if w.s.ctx == nil {
+		return nil
+	}
+	return context.Cause(w.s.ctx)
+}
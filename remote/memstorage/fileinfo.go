@@ -0,0 +1,79 @@
+package memstorage
+
+import (
+	"io/fs"
+	"maps"
+	"os"
+	"time"
+
+	"github.com/tenrok/filestore/remote"
+)
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс remote.FileInfo.
+var _ remote.FileInfo = (*memFileInfo)(nil)
+
+// memFileInfo реализует remote.FileInfo.
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	obj     *object
+}
+
+func newFileInfo(name string, obj *object) *memFileInfo {
+	return &memFileInfo{name: name, size: int64(len(obj.data)), modTime: obj.modTime, obj: obj}
+}
+
+func newDirInfo(name string) *memFileInfo {
+	return &memFileInfo{name: name + "/", dir: true}
+}
+
+func (f *memFileInfo) Name() string { return f.name }
+
+func (f *memFileInfo) Size() int64 { return f.size }
+
+func (f *memFileInfo) Mode() os.FileMode {
+	if f.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (f *memFileInfo) ModTime() time.Time { return f.modTime }
+
+func (f *memFileInfo) IsDir() bool { return f.dir }
+
+func (f *memFileInfo) Sys() interface{} { return nil }
+
+// ContentType возвращает тип содержимого объекта.
+func (f *memFileInfo) ContentType() string {
+	if f.obj == nil {
+		return ""
+	}
+	return f.obj.contentType
+}
+
+// ETag возвращает шестнадцатеричный MD5 содержимого объекта.
+func (f *memFileInfo) ETag() string {
+	if f.obj == nil {
+		return ""
+	}
+	return f.obj.etag
+}
+
+// Metadata возвращает копию пользовательских метаданных объекта.
+func (f *memFileInfo) Metadata() remote.Metadata {
+	if f.obj == nil {
+		return nil
+	}
+	return maps.Clone(f.obj.metadata)
+}
+
+// Tags возвращает копию тегов объекта.
+func (f *memFileInfo) Tags() remote.Tags {
+	if f.obj == nil {
+		return nil
+	}
+	return maps.Clone(f.obj.tags)
+}
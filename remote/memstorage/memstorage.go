@@ -0,0 +1,483 @@
+// Package memstorage реализует удалённое хранилище в памяти процесса.
+// Оно предназначено для тестов и разработки и регистрируется под схемой "mem":
+//
+//	remote.NewStorage(ctx, "mem://name?versions=10")
+//
+// Подключения с одинаковым именем в пределах процесса разделяют содержимое.
+// При перезаписи и удалении файлов их предыдущие версии сохраняются отдельно от текущих;
+// параметр versions ограничивает количество хранимых предыдущих версий каждого файла
+// (по умолчанию DefaultVersions, 0 отключает хранение).
+package memstorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tenrok/filestore/remote"
+)
+
+// DefaultVersions количество хранимых предыдущих версий файла по умолчанию.
+const DefaultVersions = 10
+
+// Убеждаемся в том, что мы всегда реализуем интерфейсы remote.Storage, remote.Lister,
+// remote.Versioner, remote.MetadataStore и remote.Copier.
+var (
+	_ remote.Storage       = (*MemStorage)(nil)
+	_ remote.Lister        = (*MemStorage)(nil)
+	_ remote.Versioner     = (*MemStorage)(nil)
+	_ remote.MetadataStore = (*MemStorage)(nil)
+	_ remote.Copier        = (*MemStorage)(nil)
+)
+
+func init() {
+	remote.Register("mem", &MemStorage{})
+}
+
+var (
+	bucketsMu sync.Mutex
+	buckets   = make(map[string]*bucket)
+)
+
+// bucket хранит объекты одного именованного хранилища.
+type bucket struct {
+	mu      sync.RWMutex
+	objects map[string]*object   // текущие версии
+	history map[string][]*object // предыдущие версии, начиная с самой новой
+	seq     uint64               // счётчик идентификаторов версий
+}
+
+// object описывает сохранённую версию объекта.
+type object struct {
+	versionID   string
+	data        []byte
+	etag        string
+	modTime     time.Time
+	contentType string
+	metadata    remote.Metadata
+	tags        remote.Tags
+}
+
+type MemStorage struct {
+	ctx      context.Context
+	b        *bucket
+	versions int // количество хранимых предыдущих версий
+}
+
+func (s *MemStorage) NewStorage(ctx context.Context, connString string) (remote.Storage, error) {
+	u, err := url.Parse(connString)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := DefaultVersions
+	if v := u.Query().Get("versions"); v != "" {
+		if versions, err = strconv.Atoi(v); err != nil || versions < 0 {
+			return nil, fmt.Errorf("invalid versions value: %q", v)
+		}
+	}
+
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+
+	b, ok := buckets[u.Host]
+	if !ok {
+		b = &bucket{objects: make(map[string]*object), history: make(map[string][]*object)}
+		buckets[u.Host] = b
+	}
+	return &MemStorage{ctx: ctx, b: b, versions: versions}, nil
+}
+
+func (s *MemStorage) Create(name string, opts ...remote.Option) (io.WriteCloser, error) {
+	o := &remote.Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &memWriter{s: s, name: cleanName(name), opts: o}, nil
+}
+
+func (s *MemStorage) Open(name string) (http.File, error) {
+	name = cleanName(name)
+
+	s.b.mu.RLock()
+	obj, ok := s.b.objects[name]
+	s.b.mu.RUnlock()
+
+	if ok {
+		return &memFile{Reader: bytes.NewReader(obj.data), info: newFileInfo(name, obj)}, nil
+	}
+
+	infos, err := s.List(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 && name != "" {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memDir{info: newDirInfo(name), entries: infos}, nil
+}
+
+func (s *MemStorage) Remove(name string) error {
+	name = cleanName(name)
+
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	obj, ok := s.b.objects[name]
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(s.b.objects, name)
+	s.keepVersion(name, obj)
+	return nil
+}
+
+func (s *MemStorage) Stat(name string) (remote.FileInfo, error) {
+	name = cleanName(name)
+
+	s.b.mu.RLock()
+	obj, ok := s.b.objects[name]
+	s.b.mu.RUnlock()
+
+	if ok {
+		return newFileInfo(name, obj), nil
+	}
+
+	infos, err := s.List(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(infos) == 0 && name != "" {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return newDirInfo(name), nil
+}
+
+func (s *MemStorage) IsExists(name string) (bool, error) {
+	name = cleanName(name)
+
+	s.b.mu.RLock()
+	defer s.b.mu.RUnlock()
+
+	_, ok := s.b.objects[name]
+	return ok, nil
+}
+
+// List реализует метод remote.Lister.
+func (s *MemStorage) List(dir string) ([]remote.FileInfo, error) {
+	prefix := cleanName(dir)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	s.b.mu.RLock()
+	defer s.b.mu.RUnlock()
+
+	var infos []remote.FileInfo
+	dirs := make(map[string]bool)
+	for name, obj := range s.b.objects {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		if sub, _, nested := strings.Cut(rest, "/"); nested {
+			if !dirs[sub] {
+				dirs[sub] = true
+				infos = append(infos, newDirInfo(prefix+sub))
+			}
+			continue
+		}
+		infos = append(infos, newFileInfo(name, obj))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (s *MemStorage) Uploader() remote.Uploader { return s }
+
+func (s *MemStorage) Upload(path string, reader io.Reader, opts ...remote.Option) error {
+	file, err := s.Create(path, opts...)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, reader); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// OpenVersion реализует метод remote.Versioner.
+func (s *MemStorage) OpenVersion(name, versionID string) (http.File, error) {
+	name = cleanName(name)
+
+	s.b.mu.RLock()
+	obj := s.findVersion(name, versionID)
+	s.b.mu.RUnlock()
+
+	if obj == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memFile{Reader: bytes.NewReader(obj.data), info: newFileInfo(name, obj)}, nil
+}
+
+// StatVersion реализует метод remote.Versioner.
+func (s *MemStorage) StatVersion(name, versionID string) (remote.FileInfo, error) {
+	name = cleanName(name)
+
+	s.b.mu.RLock()
+	obj := s.findVersion(name, versionID)
+	s.b.mu.RUnlock()
+
+	if obj == nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return newFileInfo(name, obj), nil
+}
+
+// ListVersions реализует метод remote.Versioner.
+func (s *MemStorage) ListVersions(name string) ([]remote.Version, error) {
+	name = cleanName(name)
+
+	s.b.mu.RLock()
+	defer s.b.mu.RUnlock()
+
+	var versions []remote.Version
+	if obj, ok := s.b.objects[name]; ok {
+		versions = append(versions, newVersion(obj, true))
+	}
+	for _, obj := range s.b.history[name] {
+		versions = append(versions, newVersion(obj, false))
+	}
+	if len(versions) == 0 {
+		return nil, &fs.PathError{Op: "listversions", Path: name, Err: fs.ErrNotExist}
+	}
+	return versions, nil
+}
+
+// RemoveVersion реализует метод remote.Versioner. При удалении текущей версии
+// текущей становится самая новая из предыдущих.
+func (s *MemStorage) RemoveVersion(name, versionID string) error {
+	name = cleanName(name)
+
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	history := s.b.history[name]
+	if obj, ok := s.b.objects[name]; ok && obj.versionID == versionID {
+		if len(history) == 0 {
+			delete(s.b.objects, name)
+			return nil
+		}
+		s.b.objects[name] = history[0]
+		s.setHistory(name, history[1:])
+		return nil
+	}
+
+	for i, obj := range history {
+		if obj.versionID == versionID {
+			s.setHistory(name, append(history[:i:i], history[i+1:]...))
+			return nil
+		}
+	}
+	return &fs.PathError{Op: "removeversion", Path: name, Err: fs.ErrNotExist}
+}
+
+// GetMetadata реализует метод remote.MetadataStore.
+func (s *MemStorage) GetMetadata(name string) (remote.Metadata, error) {
+	name = cleanName(name)
+
+	s.b.mu.RLock()
+	defer s.b.mu.RUnlock()
+
+	obj, ok := s.b.objects[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "getmetadata", Path: name, Err: fs.ErrNotExist}
+	}
+	return maps.Clone(obj.metadata), nil
+}
+
+// SetMetadata реализует метод remote.MetadataStore. Как и при копировании объекта в S3,
+// изменённые метаданные сохраняются в новой версии файла.
+func (s *MemStorage) SetMetadata(name string, metadata remote.Metadata) error {
+	name = cleanName(name)
+
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	obj, ok := s.b.objects[name]
+	if !ok {
+		return &fs.PathError{Op: "setmetadata", Path: name, Err: fs.ErrNotExist}
+	}
+	updated := *obj
+	updated.modTime = time.Now()
+	updated.metadata = maps.Clone(metadata)
+	s.store(name, &updated)
+	return nil
+}
+
+// GetTags реализует метод remote.MetadataStore.
+func (s *MemStorage) GetTags(name string) (remote.Tags, error) {
+	name = cleanName(name)
+
+	s.b.mu.RLock()
+	defer s.b.mu.RUnlock()
+
+	obj, ok := s.b.objects[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "gettags", Path: name, Err: fs.ErrNotExist}
+	}
+	return maps.Clone(obj.tags), nil
+}
+
+// SetTags реализует метод remote.MetadataStore. Теги изменяются только у текущей версии.
+func (s *MemStorage) SetTags(name string, tags remote.Tags) error {
+	name = cleanName(name)
+
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	obj, ok := s.b.objects[name]
+	if !ok {
+		return &fs.PathError{Op: "settags", Path: name, Err: fs.ErrNotExist}
+	}
+	// Объекты неизменяемы после сохранения, поэтому заменяем текущую версию её копией.
+	updated := *obj
+	updated.tags = nil
+	if len(tags) > 0 {
+		updated.tags = maps.Clone(tags)
+	}
+	s.b.objects[name] = &updated
+	return nil
+}
+
+// Copy реализует метод remote.Copier. Копия разделяет содержимое с исходным объектом.
+func (s *MemStorage) Copy(ctx context.Context, src, dst string, opts ...remote.Option) error {
+	return s.copy(ctx, "copy", src, dst, false, opts...)
+}
+
+// Move реализует метод remote.Copier.
+func (s *MemStorage) Move(ctx context.Context, src, dst string, opts ...remote.Option) error {
+	return s.copy(ctx, "move", src, dst, true, opts...)
+}
+
+func (s *MemStorage) copy(ctx context.Context, op, src, dst string, move bool, opts ...remote.Option) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	src, dst = cleanName(src), cleanName(dst)
+
+	o := &remote.Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	obj, ok := s.b.objects[src]
+	if !ok {
+		return &fs.PathError{Op: op, Path: src, Err: fs.ErrNotExist}
+	}
+	if move && src == dst {
+		return nil
+	}
+
+	cp := *obj
+	cp.modTime = time.Now()
+	if o.Metadata != nil {
+		cp.metadata = maps.Clone(o.Metadata)
+	}
+	if o.ContentType != "" {
+		cp.contentType = o.ContentType
+	}
+	s.store(dst, &cp)
+
+	if move {
+		delete(s.b.objects, src)
+		s.keepVersion(src, obj)
+	}
+	return nil
+}
+
+// put сохраняет объект как текущую версию и возвращает её идентификатор.
+func (s *MemStorage) put(name string, obj *object) string {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+
+	sum := md5.Sum(obj.data)
+	obj.etag = hex.EncodeToString(sum[:])
+	return s.store(name, obj)
+}
+
+// store сохраняет объект как текущую версию. Вызывающий должен удерживать мьютекс.
+func (s *MemStorage) store(name string, obj *object) string {
+	s.b.seq++
+	obj.versionID = fmt.Sprintf("%016x", s.b.seq)
+	if prev, ok := s.b.objects[name]; ok {
+		s.keepVersion(name, prev)
+	}
+	s.b.objects[name] = obj
+	return obj.versionID
+}
+
+// keepVersion сохраняет предыдущую версию объекта с учётом ограничения их количества.
+// Вызывающий должен удерживать мьютекс.
+func (s *MemStorage) keepVersion(name string, obj *object) {
+	history := append([]*object{obj}, s.b.history[name]...)
+	if len(history) > s.versions {
+		history = history[:s.versions]
+	}
+	s.setHistory(name, history)
+}
+
+// setHistory заменяет предыдущие версии объекта. Вызывающий должен удерживать мьютекс.
+func (s *MemStorage) setHistory(name string, history []*object) {
+	if len(history) == 0 {
+		delete(s.b.history, name)
+		return
+	}
+	s.b.history[name] = history
+}
+
+// findVersion ищет версию объекта. Пустой versionID означает текущую версию.
+// Вызывающий должен удерживать мьютекс.
+func (s *MemStorage) findVersion(name, versionID string) *object {
+	obj, ok := s.b.objects[name]
+	if ok && (versionID == "" || obj.versionID == versionID) {
+		return obj
+	}
+	if versionID == "" {
+		return nil
+	}
+	for _, obj := range s.b.history[name] {
+		if obj.versionID == versionID {
+			return obj
+		}
+	}
+	return nil
+}
+
+func newVersion(obj *object, latest bool) remote.Version {
+	return remote.Version{ID: obj.versionID, Size: int64(len(obj.data)), ModTime: obj.modTime, IsLatest: latest}
+}
+
+// cleanName приводит имя объекта к виду "a/b" без начальной косой черты.
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
@@ -0,0 +1,248 @@
+package memstorage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/tenrok/filestore/remote"
+)
+
+func newTestStorage(t *testing.T, files map[string]string) remote.Storage {
+	t.Helper()
+
+	s, err := remote.NewStorage(context.Background(), "mem://"+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if err := s.Uploader().Upload(name, strings.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestFS(t *testing.T) {
+	s := newTestStorage(t, map[string]string{
+		"a.txt":          "a",
+		"dir/b.txt":      "bb",
+		"dir/sub/c.txt":  "ccc",
+		"other/d.bin":    "",
+		"dir/sub/e.json": "{}",
+	})
+
+	if err := fstest.TestFS(remote.FS(s), "a.txt", "dir/b.txt", "dir/sub/c.txt", "other/d.bin", "dir/sub/e.json"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFSNotExist(t *testing.T) {
+	fsys := remote.FS(newTestStorage(t, map[string]string{"dir/a.txt": "a"}))
+
+	for _, name := range []string{"missing", "dir/missing", "dir/a.txt/x"} {
+		if _, err := fs.Stat(fsys, name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Stat(%q): expected fs.ErrNotExist, got %v", name, err)
+		}
+	}
+	for _, name := range []string{"/dir", "dir/../a", "dir/"} {
+		if _, err := fsys.Open(name); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("Open(%q): expected fs.ErrInvalid, got %v", name, err)
+		}
+	}
+	if _, err := fs.ReadDir(fsys, "dir/a.txt"); err == nil {
+		t.Error("ReadDir of a file: expected error")
+	}
+}
+
+func TestRemove(t *testing.T) {
+	s := newTestStorage(t, map[string]string{"a": "a"})
+
+	if err := s.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Remove("a"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+	if ok, err := s.IsExists("a"); ok || err != nil {
+		t.Fatalf("IsExists: %v, %v", ok, err)
+	}
+}
+
+func TestVersions(t *testing.T) {
+	s, err := remote.NewStorage(context.Background(), "mem://"+t.Name()+"?versions=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := s.(remote.Versioner)
+
+	var ids []string
+	for _, data := range []string{"v1", "v2", "v3", "v4"} {
+		w, err := s.Create("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, data)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, remote.VersionID(w))
+	}
+
+	versions, err := v.ListVersions("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || versions[0].ID != ids[3] || !versions[0].IsLatest || versions[2].ID != ids[1] {
+		t.Fatalf("unexpected versions: %+v", versions)
+	}
+	if _, err := v.StatVersion("a", ids[0]); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected trimmed version to be gone, got %v", err)
+	}
+
+	f, err := v.OpenVersion("a", ids[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "v3" {
+		t.Fatalf("expected v3, got %q", data)
+	}
+
+	// Удаление текущей версии восстанавливает предыдущую.
+	if err := v.RemoveVersion("a", ids[3]); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := s.Stat("a"); err != nil || info.Size() != 2 {
+		t.Fatalf("Stat: %v, %v", info, err)
+	}
+
+	// Удалённый файл остаётся доступен в истории.
+	if err := s.Remove("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.StatVersion("a", ids[2]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	s := newTestStorage(t, nil)
+	if err := s.Uploader().Upload("a", strings.NewReader("a"), remote.WithContentType("text/plain"), remote.WithMetadata(remote.Metadata{"k": "v1"})); err != nil {
+		t.Fatal(err)
+	}
+	m := s.(remote.MetadataStore)
+
+	if err := m.SetMetadata("a", remote.Metadata{"k": "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetTags("a", remote.Tags{"tenant": "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := s.Stat("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ContentType() != "text/plain" || info.Metadata()["k"] != "v2" || info.Tags()["tenant"] != "x" || info.ETag() == "" {
+		t.Fatalf("unexpected info: %q %v %v %q", info.ContentType(), info.Metadata(), info.Tags(), info.ETag())
+	}
+
+	if err := m.SetTags("a", nil); err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := m.GetTags("a"); err != nil || len(tags) != 0 {
+		t.Fatalf("GetTags: %v, %v", tags, err)
+	}
+	if _, err := m.GetMetadata("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, nil)
+	if err := s.Uploader().Upload("a", strings.NewReader("data"), remote.WithContentType("text/plain"), remote.WithMetadata(remote.Metadata{"k": "v"})); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := remote.Copy(ctx, s, "b", s, "a", remote.WithMetadata(remote.Metadata{"k": "w"})); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Move(ctx, s, "c", s, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.IsExists("b"); ok {
+		t.Fatal("expected moved file to be removed")
+	}
+	info, err := s.Stat("c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 4 || info.ContentType() != "text/plain" || info.Metadata()["k"] != "w" {
+		t.Fatalf("unexpected copy: %d %q %v", info.Size(), info.ContentType(), info.Metadata())
+	}
+
+	// Копирование между разными хранилищами выполняется потоком.
+	other, err := remote.NewStorage(ctx, "mem://"+t.Name()+"-other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Move(ctx, other, "d", s, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := other.Stat("d"); err != nil || info.ContentType() != "text/plain" || info.Metadata()["k"] != "v" {
+		t.Fatalf("Stat: %v, %v", info, err)
+	}
+	if ok, _ := s.IsExists("a"); ok {
+		t.Fatal("expected moved file to be removed")
+	}
+}
+
+func TestRemoveMany(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t, map[string]string{
+		"a":         "a",
+		"b":         "b",
+		"t1/x":      "x",
+		"t1/sub/y":  "y",
+		"t10/z":     "z",
+		"t2/keep":   "k",
+		"t1-backup": "c",
+	})
+
+	if errs := remote.RemoveMany(ctx, s, []string{"a", "b", "missing"}); len(errs) != 0 {
+		t.Fatalf("RemoveMany: %v", errs)
+	}
+	errs, err := remote.RemovePrefix(ctx, s, "t1/")
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("RemovePrefix: %v, %v", errs, err)
+	}
+
+	infos, err := remote.FS(s).(fs.ReadDirFS).ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	if got := strings.Join(names, ","); got != "t1-backup,t10,t2" {
+		t.Fatalf("unexpected files left: %s", got)
+	}
+
+	if _, err := remote.RemovePrefix(ctx, s, "t1"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.IsExists("t2/keep"); !ok {
+		t.Fatal("expected t2/keep to be kept")
+	}
+	if ok, _ := s.IsExists("t10/z"); ok {
+		t.Fatal("expected t10/z to be removed")
+	}
+}
@@ -1,12 +1,19 @@
 package miniostorage
 
 import (
+	"encoding/base64"
+	"fmt"
 	"net/url"
+	"os"
 	"path"
 	"strconv"
 	"strings"
 )
 
+// CustomerKeyEnv переменная окружения с ключом SSE-C в base64. NewConfig читает ключ из неё,
+// если в строке подключения нет параметра sse_c_key.
+const CustomerKeyEnv = "MINIO_SSE_C_KEY"
+
 type Config struct {
 	Endpoint    string
 	AccessKeyID string
@@ -16,6 +23,18 @@ type Config struct {
 	Prefix      string
 	Region      string
 	Secure      bool
+	Versioning  bool // включить версионирование бакета при подключении
+
+	// Источники учётных данных, опрашиваемые по порядку: "env", "file" или "iam".
+	// Ключи из строки подключения, если они заданы, проверяются первыми.
+	Creds     []string
+	Profile   string // профиль в файле учётных данных
+	CredsFile string // путь к файлу учётных данных; по умолчанию ~/.aws/credentials
+
+	// Шифрование на стороне сервера: "s3" (SSE-S3), "kms" (SSE-KMS) или "c" (SSE-C).
+	SSE         string
+	KMSKeyID    string // ключ SSE-KMS; пустой означает ключ бакета по умолчанию
+	CustomerKey []byte // ключ SSE-C, 32 байта; ConnString его не включает, см. CustomerKeyEnv
 }
 
 // NewConfig парсирует строку подключения
@@ -47,12 +66,58 @@ func NewConfig(connString string) (*Config, error) {
 		}
 		cfg.Secure = secure
 	}
+	if queries.Has("versioning") {
+		versioning, err := strconv.ParseBool(queries.Get("versioning"))
+		if err != nil {
+			return nil, err
+		}
+		cfg.Versioning = versioning
+	}
+	if queries.Has("creds") {
+		for _, provider := range strings.Split(queries.Get("creds"), ",") {
+			switch provider {
+			case "env", "file", "iam":
+				cfg.Creds = append(cfg.Creds, provider)
+			default:
+				return nil, fmt.Errorf("unknown credentials provider: %q", provider)
+			}
+		}
+		cfg.Profile = queries.Get("profile")
+		cfg.CredsFile = queries.Get("creds_file")
+	}
 	if queries.Has("region") {
 		cfg.Region = queries.Get("region")
 	} else {
 		cfg.Region = "us-east-1"
 	}
 
+	if queries.Has("sse") {
+		cfg.SSE = queries.Get("sse")
+		switch cfg.SSE {
+		case "s3":
+		case "kms":
+			cfg.KMSKeyID = queries.Get("sse_kms_key_id")
+		case "c":
+			encoded := queries.Get("sse_c_key")
+			if !queries.Has("sse_c_key") {
+				encoded = os.Getenv(CustomerKeyEnv)
+			}
+			if encoded == "" {
+				return nil, fmt.Errorf("missing sse_c_key: set it in the connection string or %s", CustomerKeyEnv)
+			}
+			key, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sse_c_key: %w", err)
+			}
+			if len(key) != 32 {
+				return nil, fmt.Errorf("invalid sse_c_key: must be 32 bytes, got %d", len(key))
+			}
+			cfg.CustomerKey = key
+		default:
+			return nil, fmt.Errorf("unknown sse type: %q", cfg.SSE)
+		}
+	}
+
 	parts := strings.SplitN(strings.Trim(u.Path, "/"), "/", 2)
 	cfg.BucketName = parts[0]
 	if len(parts) > 1 {
@@ -62,6 +127,9 @@ func NewConfig(connString string) (*Config, error) {
 	return cfg, nil
 }
 
+// ConnString формирует строку подключения. Если заданы источники учётных данных,
+// ключи доступа в неё не включаются. Ключ SSE-C не включается никогда: строка подключения
+// попадает в конфигурации и журналы, а ключ передаётся через переменную CustomerKeyEnv.
 func ConnString(cfg Config) string {
 	params := url.Values{}
 	if cfg.Region != "" {
@@ -70,12 +138,32 @@ func ConnString(cfg Config) string {
 	if cfg.Secure {
 		params.Add("secure", "1")
 	}
+	if cfg.Versioning {
+		params.Add("versioning", "1")
+	}
+	if cfg.SSE != "" {
+		params.Add("sse", cfg.SSE)
+	}
+	if cfg.KMSKeyID != "" {
+		params.Add("sse_kms_key_id", cfg.KMSKeyID)
+	}
+	if len(cfg.Creds) > 0 {
+		params.Add("creds", strings.Join(cfg.Creds, ","))
+	}
+	if cfg.Profile != "" {
+		params.Add("profile", cfg.Profile)
+	}
+	if cfg.CredsFile != "" {
+		params.Add("creds_file", cfg.CredsFile)
+	}
 	u := url.URL{
 		Scheme:   "minio",
 		Host:     cfg.Endpoint,
-		User:     url.UserPassword(cfg.AccessKeyID, cfg.SecretKey),
 		Path:     path.Join("/", cfg.BucketName, cfg.Prefix),
 		RawQuery: params.Encode(),
 	}
+	if len(cfg.Creds) == 0 {
+		u.User = url.UserPassword(cfg.AccessKeyID, cfg.SecretKey)
+	}
 	return u.String()
 }
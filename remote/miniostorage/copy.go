@@ -0,0 +1,94 @@
+package miniostorage
+
+import (
+	"context"
+	"path"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/tenrok/filestore/remote"
+)
+
+// maxCopySize наибольший размер объекта, который S3 копирует одним запросом CopyObject (5 ГиБ).
+// Объекты большего размера копируются по частям через ComposeObject.
+const maxCopySize = 5 << 30
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс remote.Copier.
+var _ remote.Copier = (*MinioStorage)(nil)
+
+// Copy реализует метод remote.Copier.
+func (s *MinioStorage) Copy(ctx context.Context, src, dst string, opts ...remote.Option) error {
+	src = path.Join(s.cfg.Prefix, src)
+	dst = path.Join(s.cfg.Prefix, dst)
+
+	return s.copy(ctx, "copy", src, dst, opts...)
+}
+
+// Move реализует метод remote.Copier. S3 не поддерживает переименование, поэтому объект
+// копируется на стороне сервера, после чего исходный объект удаляется.
+func (s *MinioStorage) Move(ctx context.Context, src, dst string, opts ...remote.Option) error {
+	src = path.Join(s.cfg.Prefix, src)
+	dst = path.Join(s.cfg.Prefix, dst)
+	if src == dst {
+		srcSSE, err := s.sourceSSE(opts...)
+		if err != nil {
+			return err
+		}
+		_, err = s.client.StatObject(ctx, s.cfg.BucketName, src, minio.StatObjectOptions{ServerSideEncryption: srcSSE})
+		return mapError("move", src, err)
+	}
+
+	if err := s.copy(ctx, "move", src, dst, opts...); err != nil {
+		return err
+	}
+	err := s.client.RemoveObject(ctx, s.cfg.BucketName, src, minio.RemoveObjectOptions{})
+	return mapError("move", src, err)
+}
+
+func (s *MinioStorage) copy(ctx context.Context, op, src, dst string, opts ...remote.Option) error {
+	o := &remote.Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	srcSSE, err := s.sourceSSE(opts...)
+	if err != nil {
+		return err
+	}
+	info, err := s.client.StatObject(ctx, s.cfg.BucketName, src, minio.StatObjectOptions{ServerSideEncryption: srcSSE})
+	if err != nil {
+		return mapError(op, src, err)
+	}
+
+	sse, err := s.writeSSE(opts...)
+	if err != nil {
+		return err
+	}
+
+	dstOpts := minio.CopyDestOptions{Bucket: s.cfg.BucketName, Object: dst, Encryption: sse}
+	// Тип содержимого передаётся только вместе с заменой метаданных, поэтому при замене
+	// одного из них второй берётся из исходного объекта.
+	if o.Metadata != nil || o.ContentType != "" {
+		dstOpts.ReplaceMetadata = true
+		dstOpts.UserMetadata = info.UserMetadata
+		if o.Metadata != nil {
+			dstOpts.UserMetadata = userMetadata(o.Metadata)
+		}
+		dstOpts.ContentType = info.ContentType
+		if o.ContentType != "" {
+			dstOpts.ContentType = o.ContentType
+		}
+	}
+	srcOpts := minio.CopySrcOptions{
+		Bucket:     s.cfg.BucketName,
+		Object:     src,
+		VersionID:  info.VersionID,
+		Encryption: srcSSE,
+	}
+
+	if info.Size > maxCopySize {
+		_, err = s.client.ComposeObject(ctx, dstOpts, srcOpts)
+	} else {
+		_, err = s.client.CopyObject(ctx, dstOpts, srcOpts)
+	}
+	return mapError(op, src, err)
+}
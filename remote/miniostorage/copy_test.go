@@ -0,0 +1,90 @@
+package miniostorage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/tenrok/filestore/remote"
+)
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	fake, srv := newFakeS3(t)
+	s := newTestStorage(t, srv, "")
+
+	if err := s.Upload("a", strings.NewReader("data"), remote.WithContentType("text/plain"), remote.WithMetadata(remote.Metadata{"Owner": "x"})); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name        string
+		opts        []remote.Option
+		contentType string
+		owner       string
+	}{
+		{name: "keep", contentType: "text/plain", owner: "x"},
+		{name: "metadata", opts: []remote.Option{remote.WithMetadata(remote.Metadata{"Owner": "y"})}, contentType: "text/plain", owner: "y"},
+		{name: "type", opts: []remote.Option{remote.WithContentType("text/markdown")}, contentType: "text/markdown", owner: "x"},
+	}
+	for _, tc := range cases {
+		if err := remote.Copy(ctx, s, tc.name, s, "a", tc.opts...); err != nil {
+			t.Fatal(err)
+		}
+		// Копирование выполняется на стороне сервера
+		if fake.puts["/bucket/"+tc.name].Get(hdrCopySource) == "" {
+			t.Errorf("%s: expected server-side copy", tc.name)
+		}
+		info, err := s.Stat(tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() != 4 || info.ContentType() != tc.contentType || info.Metadata()["Owner"] != tc.owner {
+			t.Errorf("%s: unexpected copy %d %q %v", tc.name, info.Size(), info.ContentType(), info.Metadata())
+		}
+	}
+
+	if err := s.Copy(ctx, "missing", "b"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+func TestMove(t *testing.T) {
+	ctx := context.Background()
+	_, srv := newFakeS3(t)
+	s := newTestStorage(t, srv, "")
+
+	if err := s.Upload("a", strings.NewReader("data"), remote.WithMetadata(remote.Metadata{"Owner": "x"})); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := remote.Move(ctx, s, "dir/b", s, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.IsExists("a"); ok {
+		t.Fatal("expected moved file to be removed")
+	}
+	if got := readAll(t, s, "dir/b"); got != "data" {
+		t.Fatalf("expected data, got %q", got)
+	}
+	if m, err := s.GetMetadata("dir/b"); err != nil || m["Owner"] != "x" {
+		t.Fatalf("GetMetadata: %v, %v", m, err)
+	}
+
+	// Перемещение в себя не удаляет файл
+	if err := s.Move(ctx, "dir/b", "dir/b"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.IsExists("dir/b"); !ok {
+		t.Fatal("file moved onto itself is removed")
+	}
+
+	if err := s.Move(ctx, "a", "c"); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+	if ok, _ := s.IsExists("c"); ok {
+		t.Fatal("failed move created the destination")
+	}
+}
@@ -0,0 +1,377 @@
+package miniostorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/tenrok/filestore/remote"
+)
+
+// fakeS3 минимальная замена S3 для тестов хранилища: объекты, шифрование на стороне сервера,
+// пользовательские метаданные, теги, перечисление (ListObjectsV2) и пакетное удаление.
+type fakeS3 struct {
+	mu       sync.Mutex
+	objects  map[string]*fakeObject
+	puts     map[string]http.Header // заголовки последней записи каждого объекта
+	locked   map[string]bool        // объекты, которые нельзя удалить
+	maxKeys  int                    // наибольшее количество ключей в ответе ListObjectsV2
+	deletes  int                    // количество запросов пакетного удаления
+	listings int                    // количество запросов ListObjectsV2
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+	metadata    map[string]string // заголовки X-Amz-Meta-*
+	tags        []fakeTag
+	sse         string
+	kmsKeyID    string
+	keyMD5      string
+}
+
+type fakeTag struct {
+	Key   string
+	Value string
+}
+
+// fakeListResult ответ ListObjectsV2.
+type fakeListResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Name                  string
+	Prefix                string
+	KeyCount              int
+	MaxKeys               int
+	IsTruncated           bool
+	NextContinuationToken string `xml:",omitempty"`
+	Contents              []fakeListObject
+	CommonPrefixes        []fakeCommonPrefix
+}
+
+type fakeListObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int
+}
+
+type fakeCommonPrefix struct {
+	Prefix string
+}
+
+// fakeDelete тело запроса пакетного удаления.
+type fakeDelete struct {
+	Quiet   bool
+	Objects []struct{ Key string } `xml:"Object"`
+}
+
+// fakeDeleteResult ответ на запрос пакетного удаления.
+type fakeDeleteResult struct {
+	XMLName xml.Name `xml:"DeleteResult"`
+	Deleted []struct{ Key string }
+	Errors  []fakeDeleteError `xml:"Error"`
+}
+
+type fakeDeleteError struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+// fakeTagging тело запросов и ответов ?tagging.
+type fakeTagging struct {
+	XMLName xml.Name  `xml:"Tagging"`
+	Tags    []fakeTag `xml:"TagSet>Tag"`
+}
+
+const (
+	hdrSSE          = "X-Amz-Server-Side-Encryption"
+	hdrKMSKeyID     = "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"
+	hdrKeyMD5       = "X-Amz-Server-Side-Encryption-Customer-Key-Md5"
+	hdrCopyKeyMD5   = "X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key-Md5"
+	hdrCopySource   = "X-Amz-Copy-Source"
+	hdrDirective    = "X-Amz-Metadata-Directive"
+	hdrMetaPrefix   = "X-Amz-Meta-"
+	fakeLastModTime = "Mon, 02 Jan 2006 15:04:05 GMT"
+)
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{objects: make(map[string]*fakeObject), puts: make(map[string]http.Header), locked: make(map[string]bool), maxKeys: 1000}
+	srv := httptest.NewTLSServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := r.URL.Path
+	switch bucket, name, _ := strings.Cut(strings.TrimPrefix(key, "/"), "/"); {
+	case r.URL.Query().Has("tagging"):
+		f.serveTagging(w, r, key)
+		return
+	case name == "" && r.Method == http.MethodGet && r.URL.Query().Get("list-type") == "2":
+		f.serveList(w, r, bucket)
+		return
+	case name == "" && r.Method == http.MethodPost && r.URL.Query().Has("delete"):
+		f.serveDelete(w, r, bucket)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		obj := &fakeObject{
+			contentType: r.Header.Get("Content-Type"),
+			metadata:    userHeaders(r.Header),
+			sse:         r.Header.Get(hdrSSE),
+			kmsKeyID:    r.Header.Get(hdrKMSKeyID),
+			keyMD5:      r.Header.Get(hdrKeyMD5),
+		}
+		if src := r.Header.Get(hdrCopySource); src != "" {
+			from, ok := f.objects["/"+strings.TrimPrefix(src, "/")]
+			if !ok {
+				fakeError(w, http.StatusNotFound, "NoSuchKey")
+				return
+			}
+			if from.keyMD5 != r.Header.Get(hdrCopyKeyMD5) {
+				fakeError(w, http.StatusBadRequest, "InvalidRequest")
+				return
+			}
+			// Без REPLACE метаданные и тип содержимого копируются из исходного объекта
+			if r.Header.Get(hdrDirective) != "REPLACE" {
+				obj.contentType, obj.metadata = from.contentType, from.metadata
+			}
+			obj.data = from.data
+			obj.tags = from.tags
+			f.objects[key] = obj
+			f.puts[key] = r.Header.Clone()
+			fmt.Fprintf(w, `<CopyObjectResult><ETag>"%x"</ETag><LastModified>2006-01-02T15:04:05.000Z</LastModified></CopyObjectResult>`, md5.Sum(obj.data))
+			return
+		}
+
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			fakeError(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		obj.data = data
+		f.objects[key] = obj
+		f.puts[key] = r.Header.Clone()
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(data)))
+
+	case http.MethodGet, http.MethodHead:
+		obj, ok := f.objects[key]
+		if !ok {
+			fakeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		// Как и S3, отклоняем заголовки SSE-S3/KMS при чтении и требуем ключ SSE-C
+		if r.Header.Get(hdrSSE) != "" || obj.keyMD5 != r.Header.Get(hdrKeyMD5) {
+			fakeError(w, http.StatusBadRequest, "InvalidRequest")
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(obj.data)))
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, md5.Sum(obj.data)))
+		w.Header().Set("Last-Modified", fakeLastModTime)
+		for k, v := range obj.metadata {
+			w.Header().Set(hdrMetaPrefix+k, v)
+		}
+		if obj.sse != "" {
+			w.Header().Set(hdrSSE, obj.sse)
+		}
+		if r.Method == http.MethodGet {
+			http.ServeContent(w, r, key, time.Time{}, bytes.NewReader(obj.data))
+		}
+
+	case http.MethodDelete:
+		if f.locked[key] {
+			fakeError(w, http.StatusForbidden, "AccessDenied")
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		fakeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// serveList перечисляет объекты бакета bucket, как ListObjectsV2.
+func (f *fakeS3) serveList(w http.ResponseWriter, r *http.Request, bucket string) {
+	f.listings++
+	if bucket != "bucket" {
+		fakeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	q := r.URL.Query()
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	after := q.Get("start-after")
+	if token := q.Get("continuation-token"); token != "" {
+		after = token
+	}
+	maxKeys := f.maxKeys
+	if n, err := strconv.Atoi(q.Get("max-keys")); err == nil && n > 0 && n < maxKeys {
+		maxKeys = n
+	}
+
+	var keys []string
+	for key := range f.objects {
+		if name, ok := strings.CutPrefix(key, "/"+bucket+"/"); ok && strings.HasPrefix(name, prefix) && name > after {
+			keys = append(keys, name)
+		}
+	}
+	sort.Strings(keys)
+
+	result := fakeListResult{Name: bucket, Prefix: prefix, MaxKeys: maxKeys}
+	seen := make(map[string]bool)
+	for _, name := range keys {
+		if result.KeyCount == maxKeys {
+			result.IsTruncated = true
+			break
+		}
+		result.KeyCount++
+		result.NextContinuationToken = name
+		if i := strings.Index(name[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			if p := name[:len(prefix)+i+len(delimiter)]; !seen[p] {
+				seen[p] = true
+				result.CommonPrefixes = append(result.CommonPrefixes, fakeCommonPrefix{Prefix: p})
+			}
+			continue
+		}
+		obj := f.objects["/"+bucket+"/"+name]
+		result.Contents = append(result.Contents, fakeListObject{
+			Key:          name,
+			LastModified: "2006-01-02T15:04:05.000Z",
+			ETag:         fmt.Sprintf(`"%x"`, md5.Sum(obj.data)),
+			Size:         len(obj.data),
+		})
+	}
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// serveDelete удаляет объекты бакета bucket, перечисленные в теле запроса.
+func (f *fakeS3) serveDelete(w http.ResponseWriter, r *http.Request, bucket string) {
+	f.deletes++
+	var req fakeDelete
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		fakeError(w, http.StatusBadRequest, "MalformedXML")
+		return
+	}
+
+	var result fakeDeleteResult
+	for _, obj := range req.Objects {
+		key := "/" + bucket + "/" + obj.Key
+		if f.locked[key] {
+			result.Errors = append(result.Errors, fakeDeleteError{Key: obj.Key, Code: "AccessDenied", Message: "Access Denied"})
+			continue
+		}
+		// Как и S3, отсутствующий объект считается удалённым
+		delete(f.objects, key)
+		if !req.Quiet {
+			result.Deleted = append(result.Deleted, struct{ Key string }{obj.Key})
+		}
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
+
+// serveTagging обрабатывает запросы к тегам объекта key.
+func (f *fakeS3) serveTagging(w http.ResponseWriter, r *http.Request, key string) {
+	obj, ok := f.objects[key]
+	if !ok {
+		fakeError(w, http.StatusNotFound, "NoSuchKey")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/xml")
+		xml.NewEncoder(w).Encode(fakeTagging{Tags: obj.tags})
+	case http.MethodPut:
+		var t fakeTagging
+		if err := xml.NewDecoder(r.Body).Decode(&t); err != nil {
+			fakeError(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		obj.tags = t.Tags
+	case http.MethodDelete:
+		obj.tags = nil
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		fakeError(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+// userHeaders возвращает пользовательские метаданные из заголовков X-Amz-Meta-*.
+func userHeaders(h http.Header) map[string]string {
+	m := make(map[string]string)
+	for k := range h {
+		if name, ok := strings.CutPrefix(k, hdrMetaPrefix); ok {
+			m[name] = h.Get(k)
+		}
+	}
+	return m
+}
+
+func fakeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<Error><Code>%s</Code><Message>%s</Message></Error>`, code, code)
+}
+
+// newTestStorage подключается к srv с параметрами connString, доверяя его сертификату.
+func newTestStorage(t *testing.T, srv *httptest.Server, query string) *MinioStorage {
+	t.Helper()
+
+	cfg, err := NewConfig("minio://key:secret@" + strings.TrimPrefix(srv.URL, "https://") + "/bucket?secure=1&" + query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:     newCredentials(cfg),
+		Region:    cfg.Region,
+		Secure:    cfg.Secure,
+		Transport: srv.Client().Transport,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sse, err := newServerSide(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &MinioStorage{ctx: context.Background(), client: client, cfg: cfg, sse: sse}
+}
+
+func readAll(t *testing.T, s remote.Storage, name string) string {
+	t.Helper()
+
+	f, err := s.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
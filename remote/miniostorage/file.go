@@ -25,7 +25,7 @@ func (f *minioFileWrapper) Readdir(count int) ([]fs.FileInfo, error) {
 func (f *minioFileWrapper) Stat() (fs.FileInfo, error) {
 	info, err := f.Object.Stat()
 	if err != nil {
-		return nil, err
+		return nil, mapError("stat", f.name, err)
 	}
 	return &minioFileInfo{info: info}, nil
 }
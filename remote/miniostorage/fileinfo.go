@@ -1,17 +1,17 @@
 package miniostorage
 
 import (
-	"io/fs"
 	"os"
 	"time"
 
 	"github.com/minio/minio-go/v7"
+	"github.com/tenrok/filestore/remote"
 )
 
-// Убеждаемся в том, что мы всегда реализуем интерфейс fs.FileInfo.
-var _ fs.FileInfo = (*minioFileInfo)(nil)
+// Убеждаемся в том, что мы всегда реализуем интерфейс remote.FileInfo.
+var _ remote.FileInfo = (*minioFileInfo)(nil)
 
-// minioFileInfo реализует fs.FileInfo.
+// minioFileInfo реализует remote.FileInfo.
 type minioFileInfo struct {
 	info minio.ObjectInfo
 }
@@ -30,4 +30,26 @@ func (f *minioFileInfo) ModTime() time.Time { return f.info.LastModified.Local()
 
 func (f *minioFileInfo) IsDir() bool { return f.info.Key[len(f.info.Key)-1] == '/' }
 
-func (f *minioFileInfo) Sys() interface{} { return f.info }
+// Sys не раскрывает сведения клиента MinIO: они доступны через типизированные методы.
+func (f *minioFileInfo) Sys() interface{} { return nil }
+
+// ContentType возвращает тип содержимого объекта.
+func (f *minioFileInfo) ContentType() string { return f.info.ContentType }
+
+// ETag возвращает ETag объекта.
+func (f *minioFileInfo) ETag() string { return f.info.ETag }
+
+// Metadata возвращает пользовательские метаданные объекта.
+func (f *minioFileInfo) Metadata() remote.Metadata { return newMetadata(f.info.UserMetadata) }
+
+// Tags возвращает теги объекта, если сервер передал их вместе со сведениями об объекте.
+func (f *minioFileInfo) Tags() remote.Tags {
+	if len(f.info.UserTags) == 0 {
+		return nil
+	}
+	t := make(remote.Tags, len(f.info.UserTags))
+	for k, v := range f.info.UserTags {
+		t[k] = v
+	}
+	return t
+}
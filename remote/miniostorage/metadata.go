@@ -0,0 +1,110 @@
+package miniostorage
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
+	"github.com/tenrok/filestore/remote"
+)
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс remote.MetadataStore.
+var _ remote.MetadataStore = (*MinioStorage)(nil)
+
+// GetMetadata реализует метод remote.MetadataStore.
+func (s *MinioStorage) GetMetadata(name string) (remote.Metadata, error) {
+	name = path.Join(s.cfg.Prefix, name)
+
+	info, err := s.client.StatObject(s.ctx, s.cfg.BucketName, name, minio.StatObjectOptions{ServerSideEncryption: s.sse})
+	if err != nil {
+		return nil, mapError("getmetadata", name, err)
+	}
+	return newMetadata(info.UserMetadata), nil
+}
+
+// SetMetadata реализует метод remote.MetadataStore. Метаданные заменяются копированием
+// объекта в самого себя на стороне сервера.
+func (s *MinioStorage) SetMetadata(name string, metadata remote.Metadata) error {
+	name = path.Join(s.cfg.Prefix, name)
+
+	srcSSE, err := s.sourceSSE()
+	if err != nil {
+		return err
+	}
+	info, err := s.client.StatObject(s.ctx, s.cfg.BucketName, name, minio.StatObjectOptions{ServerSideEncryption: srcSSE})
+	if err != nil {
+		return mapError("setmetadata", name, err)
+	}
+
+	dst := minio.CopyDestOptions{
+		Bucket:          s.cfg.BucketName,
+		Object:          name,
+		UserMetadata:    userMetadata(metadata),
+		ReplaceMetadata: true,
+		ContentType:     info.ContentType,
+		Encryption:      s.sse,
+	}
+	src := minio.CopySrcOptions{
+		Bucket:     s.cfg.BucketName,
+		Object:     name,
+		VersionID:  info.VersionID,
+		Encryption: srcSSE,
+	}
+	if _, err := s.client.CopyObject(s.ctx, dst, src); err != nil {
+		return mapError("setmetadata", name, err)
+	}
+	return nil
+}
+
+// GetTags реализует метод remote.MetadataStore.
+func (s *MinioStorage) GetTags(name string) (remote.Tags, error) {
+	name = path.Join(s.cfg.Prefix, name)
+
+	t, err := s.client.GetObjectTagging(s.ctx, s.cfg.BucketName, name, minio.GetObjectTaggingOptions{})
+	if err != nil {
+		return nil, mapError("gettags", name, err)
+	}
+	return t.ToMap(), nil
+}
+
+// SetTags реализует метод remote.MetadataStore.
+func (s *MinioStorage) SetTags(name string, t remote.Tags) error {
+	name = path.Join(s.cfg.Prefix, name)
+
+	if len(t) == 0 {
+		err := s.client.RemoveObjectTagging(s.ctx, s.cfg.BucketName, name, minio.RemoveObjectTaggingOptions{})
+		return mapError("settags", name, err)
+	}
+
+	otags, err := tags.NewTags(t, true)
+	if err != nil {
+		return err
+	}
+	err = s.client.PutObjectTagging(s.ctx, s.cfg.BucketName, name, otags, minio.PutObjectTaggingOptions{})
+	return mapError("settags", name, err)
+}
+
+// userMetadata преобразует метаданные в строковые заголовки объекта.
+func userMetadata(metadata remote.Metadata) map[string]string {
+	if metadata == nil {
+		return nil
+	}
+	m := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		m[k] = fmt.Sprintf("%v", v)
+	}
+	return m
+}
+
+// newMetadata преобразует пользовательские метаданные объекта в remote.Metadata.
+func newMetadata(m map[string]string) remote.Metadata {
+	if len(m) == 0 {
+		return nil
+	}
+	metadata := make(remote.Metadata, len(m))
+	for k, v := range m {
+		metadata[k] = v
+	}
+	return metadata
+}
@@ -0,0 +1,84 @@
+package miniostorage
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/tenrok/filestore/remote"
+)
+
+func TestMetadata(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	s := newTestStorage(t, srv, "")
+
+	if err := s.Upload("a", strings.NewReader("data"), remote.WithContentType("text/plain"), remote.WithMetadata(remote.Metadata{"Owner": "x", "Rev": 1})); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := s.GetMetadata("a"); err != nil || m["Owner"] != "x" || m["Rev"] != "1" {
+		t.Fatalf("GetMetadata: %v, %v", m, err)
+	}
+
+	// Метаданные заменяются копированием объекта в самого себя, содержимое не передаётся
+	if err := s.SetMetadata("a", remote.Metadata{"Owner": "y"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.puts["/bucket/a"].Get(hdrCopySource); strings.TrimPrefix(got, "/") != "bucket/a" {
+		t.Fatalf("expected server-side copy, got copy source %q", got)
+	}
+	info, err := s.Stat("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := info.Metadata(); len(m) != 1 || m["Owner"] != "y" {
+		t.Fatalf("unexpected metadata %v", m)
+	}
+	if info.ContentType() != "text/plain" || info.ETag() == "" {
+		t.Fatalf("unexpected info: %q %q", info.ContentType(), info.ETag())
+	}
+	if got := readAll(t, s, "a"); got != "data" {
+		t.Fatalf("expected data, got %q", got)
+	}
+
+	if err := s.SetTags("a", remote.Tags{"tenant": "t1"}); err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := s.GetTags("a"); err != nil || len(tags) != 1 || tags["tenant"] != "t1" {
+		t.Fatalf("GetTags: %v, %v", tags, err)
+	}
+	if err := s.SetTags("a", nil); err != nil {
+		t.Fatal(err)
+	}
+	if tags, err := s.GetTags("a"); err != nil || len(tags) != 0 {
+		t.Fatalf("GetTags: %v, %v", tags, err)
+	}
+
+	if err := s.SetMetadata("missing", remote.Metadata{"Owner": "y"}); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist, got %v", err)
+	}
+}
+
+// SetMetadata объекта SSE-C передаёт ключ и для чтения исходного объекта, и для записи.
+func TestSetMetadataCustomerKey(t *testing.T) {
+	key := bytes.Repeat([]byte{4}, 32)
+	_, srv := newFakeS3(t)
+	s, err := newTestStorage(t, srv, "").WithCustomerKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Upload("a", strings.NewReader("data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetMetadata("a", remote.Metadata{"Owner": "y"}); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := s.GetMetadata("a"); err != nil || m["Owner"] != "y" {
+		t.Fatalf("GetMetadata: %v, %v", m, err)
+	}
+	if got := readAll(t, s, "a"); got != "data" {
+		t.Fatalf("expected data, got %q", got)
+	}
+}
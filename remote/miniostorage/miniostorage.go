@@ -2,17 +2,24 @@ package miniostorage
 
 import (
 	"context"
+	"errors"
 	"io"
+	"io/fs"
 	"net/http"
 	"path"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 	"github.com/tenrok/filestore/remote"
 )
 
-// Убеждаемся в том, что мы всегда реализуем интерфейс remote.Storage.
-var _ remote.Storage = (*MinioStorage)(nil)
+// Убеждаемся в том, что мы всегда реализуем интерфейсы remote.Storage, remote.Lister и remote.Versioner.
+var (
+	_ remote.Storage   = (*MinioStorage)(nil)
+	_ remote.Lister    = (*MinioStorage)(nil)
+	_ remote.Versioner = (*MinioStorage)(nil)
+)
 
 func init() {
 	remote.Register("minio", &MinioStorage{})
@@ -22,6 +29,7 @@ type MinioStorage struct {
 	ctx    context.Context
 	client *minio.Client
 	cfg    *Config
+	sse    encrypt.ServerSide // шифрование на стороне сервера, nil — не задано
 }
 
 func (s *MinioStorage) NewStorage(ctx context.Context, connString string) (remote.Storage, error) {
@@ -31,7 +39,7 @@ func (s *MinioStorage) NewStorage(ctx context.Context, connString string) (remot
 	}
 
 	opts := &minio.Options{
-		Creds:  credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretKey, cfg.Token),
+		Creds:  newCredentials(cfg),
 		Region: cfg.Region,
 		Secure: cfg.Secure,
 	}
@@ -41,9 +49,21 @@ func (s *MinioStorage) NewStorage(ctx context.Context, connString string) (remot
 		return nil, err
 	}
 
+	sse, err := newServerSide(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Versioning {
+		if err := client.EnableVersioning(ctx, cfg.BucketName); err != nil {
+			return nil, err
+		}
+	}
+
 	s.ctx = ctx
 	s.client = client
 	s.cfg = cfg
+	s.sse = sse
 
 	return s, nil
 }
@@ -51,13 +71,17 @@ func (s *MinioStorage) NewStorage(ctx context.Context, connString string) (remot
 func (s *MinioStorage) Create(name string, opts ...remote.Option) (io.WriteCloser, error) {
 	name = path.Join(s.cfg.Prefix, name)
 
-	return newMinioWriter(s.ctx, s.client, s.cfg.BucketName, name, opts...), nil
+	sse, err := s.writeSSE(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newMinioWriter(s.ctx, s.client, s.cfg.BucketName, name, sse, opts...), nil
 }
 
 func (s *MinioStorage) Open(name string) (http.File, error) {
 	name = path.Join(s.cfg.Prefix, name)
 
-	obj, err := s.client.GetObject(s.ctx, s.cfg.BucketName, name, minio.GetObjectOptions{})
+	obj, err := s.client.GetObject(s.ctx, s.cfg.BucketName, name, minio.GetObjectOptions{ServerSideEncryption: s.sse})
 	if err != nil {
 		return nil, err
 	}
@@ -73,9 +97,9 @@ func (s *MinioStorage) Remove(name string) error {
 func (s *MinioStorage) Stat(name string) (remote.FileInfo, error) {
 	name = path.Join(s.cfg.Prefix, name)
 
-	info, err := s.client.StatObject(s.ctx, s.cfg.BucketName, name, minio.StatObjectOptions{})
+	info, err := s.client.StatObject(s.ctx, s.cfg.BucketName, name, minio.StatObjectOptions{ServerSideEncryption: s.sse})
 	if err != nil {
-		return nil, err
+		return nil, mapError("stat", name, err)
 	}
 	return newMinioFileInfo(info), nil
 }
@@ -83,10 +107,132 @@ func (s *MinioStorage) Stat(name string) (remote.FileInfo, error) {
 func (s *MinioStorage) IsExists(name string) (bool, error) {
 	name = path.Join(s.cfg.Prefix, name)
 
-	_, err := s.client.StatObject(s.ctx, s.cfg.BucketName, name, minio.StatObjectOptions{})
+	_, err := s.client.StatObject(s.ctx, s.cfg.BucketName, name, minio.StatObjectOptions{ServerSideEncryption: s.sse})
 	if err != nil {
+		if err = mapError("stat", name, err); errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
 		return false, err
 	}
 
 	return true, nil
 }
+
+// List реализует метод remote.Lister. Каталогами считаются общие префиксы имён объектов.
+func (s *MinioStorage) List(dir string) ([]remote.FileInfo, error) {
+	prefix := path.Join(s.cfg.Prefix, dir)
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	var infos []remote.FileInfo
+	for obj := range s.client.ListObjects(s.ctx, s.cfg.BucketName, minio.ListObjectsOptions{Prefix: prefix}) {
+		if obj.Err != nil {
+			return nil, mapError("list", dir, obj.Err)
+		}
+		infos = append(infos, newMinioFileInfo(obj))
+	}
+	return infos, nil
+}
+
+// OpenVersion реализует метод remote.Versioner.
+func (s *MinioStorage) OpenVersion(name, versionID string) (http.File, error) {
+	name = path.Join(s.cfg.Prefix, name)
+
+	obj, err := s.client.GetObject(s.ctx, s.cfg.BucketName, name, minio.GetObjectOptions{VersionID: versionID, ServerSideEncryption: s.sse})
+	if err != nil {
+		return nil, mapError("open", name, err)
+	}
+	return &minioFileWrapper{Object: obj, name: name}, nil
+}
+
+// StatVersion реализует метод remote.Versioner.
+func (s *MinioStorage) StatVersion(name, versionID string) (remote.FileInfo, error) {
+	name = path.Join(s.cfg.Prefix, name)
+
+	info, err := s.client.StatObject(s.ctx, s.cfg.BucketName, name, minio.StatObjectOptions{VersionID: versionID, ServerSideEncryption: s.sse})
+	if err != nil {
+		return nil, mapError("stat", name, err)
+	}
+	return newMinioFileInfo(info), nil
+}
+
+// ListVersions реализует метод remote.Versioner. Если версионирование бакета не включено,
+// возвращается единственная версия с идентификатором "null".
+func (s *MinioStorage) ListVersions(name string) ([]remote.Version, error) {
+	name = path.Join(s.cfg.Prefix, name)
+
+	// Ключи перечисляются по возрастанию, поэтому версии файла идут первыми среди ключей
+	// с префиксом name; остальные ключи не запрашиваем.
+	ctx, cancel := context.WithCancel(s.ctx)
+	defer cancel()
+
+	var versions []remote.Version
+	opts := minio.ListObjectsOptions{Prefix: name, WithVersions: true}
+	for obj := range s.client.ListObjects(ctx, s.cfg.BucketName, opts) {
+		if obj.Err != nil {
+			return nil, mapError("listversions", name, obj.Err)
+		}
+		if obj.Key != name {
+			break
+		}
+		versions = append(versions, remote.Version{
+			ID:           obj.VersionID,
+			Size:         obj.Size,
+			ModTime:      obj.LastModified.Local(),
+			IsLatest:     obj.IsLatest,
+			DeleteMarker: obj.IsDeleteMarker,
+		})
+	}
+	if len(versions) == 0 {
+		return nil, &fs.PathError{Op: "listversions", Path: name, Err: fs.ErrNotExist}
+	}
+	return versions, nil
+}
+
+// RemoveVersion реализует метод remote.Versioner.
+func (s *MinioStorage) RemoveVersion(name, versionID string) error {
+	name = path.Join(s.cfg.Prefix, name)
+
+	err := s.client.RemoveObject(s.ctx, s.cfg.BucketName, name, minio.RemoveObjectOptions{VersionID: versionID})
+	return mapError("removeversion", name, err)
+}
+
+// newCredentials возвращает учётные данные для конфигурации cfg. Если заданы источники
+// учётных данных, они объединяются в цепочку после ключей из строки подключения.
+func newCredentials(cfg *Config) *credentials.Credentials {
+	if len(cfg.Creds) == 0 {
+		return credentials.NewStaticV4(cfg.AccessKeyID, cfg.SecretKey, cfg.Token)
+	}
+
+	var providers []credentials.Provider
+	if cfg.AccessKeyID != "" {
+		providers = append(providers, &credentials.Static{Value: credentials.Value{
+			AccessKeyID:     cfg.AccessKeyID,
+			SecretAccessKey: cfg.SecretKey,
+			SessionToken:    cfg.Token,
+			SignerType:      credentials.SignatureV4,
+		}})
+	}
+	for _, name := range cfg.Creds {
+		switch name {
+		case "env":
+			providers = append(providers, &credentials.EnvAWS{}, &credentials.EnvMinio{})
+		case "file":
+			providers = append(providers, &credentials.FileAWSCredentials{Filename: cfg.CredsFile, Profile: cfg.Profile})
+		case "iam":
+			providers = append(providers, &credentials.IAM{})
+		}
+	}
+	return credentials.NewChainCredentials(providers)
+}
+
+// mapError преобразует ошибку отсутствия объекта в *fs.PathError с fs.ErrNotExist,
+// чтобы её можно было проверить с помощью errors.Is.
+func mapError(op, name string, err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound", "NoSuchBucket":
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return err
+}
@@ -0,0 +1,94 @@
+package miniostorage
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/tenrok/filestore/remote"
+)
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс remote.BatchRemover.
+var _ remote.BatchRemover = (*MinioStorage)(nil)
+
+// RemoveMany реализует метод remote.BatchRemover. Объекты передаются серверу потоком
+// и удаляются запросами DeleteObjects.
+func (s *MinioStorage) RemoveMany(ctx context.Context, names []string) []remote.RemoveError {
+	// Отмена контекста освобождает отправителя, если RemoveObjects завершится, не дочитав канал
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sent := 0
+	done := make(chan struct{})
+	objects := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(done)
+		defer close(objects)
+		for _, name := range names {
+			select {
+			case objects <- minio.ObjectInfo{Key: path.Join(s.cfg.Prefix, name)}:
+				sent++
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	errs := s.removeObjects(ctx, objects)
+	cancel()
+	<-done
+
+	// Объекты, которые не успели передать серверу до отмены контекста, остались неудалёнными
+	for _, name := range names[sent:] {
+		errs = append(errs, remote.RemoveError{Name: name, Err: ctx.Err()})
+	}
+	return errs
+}
+
+// RemovePrefix реализует метод remote.BatchRemover. Список объектов передаётся
+// на удаление по мере его получения.
+func (s *MinioStorage) RemovePrefix(ctx context.Context, prefix string) ([]remote.RemoveError, error) {
+	key := path.Join(s.cfg.Prefix, prefix)
+	if key != "" && (prefix == "" || strings.HasSuffix(prefix, "/")) {
+		key += "/"
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var listErr error
+	done := make(chan struct{})
+	objects := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(done)
+		defer close(objects)
+		for obj := range s.client.ListObjects(ctx, s.cfg.BucketName, minio.ListObjectsOptions{Prefix: key, Recursive: true}) {
+			if obj.Err != nil {
+				listErr = mapError("removeprefix", prefix, obj.Err)
+				return
+			}
+			select {
+			case objects <- obj:
+			case <-ctx.Done():
+				listErr = ctx.Err()
+				return
+			}
+		}
+	}()
+
+	errs := s.removeObjects(ctx, objects)
+	cancel()
+	<-done
+	return errs, listErr
+}
+
+// removeObjects удаляет объекты из objects и возвращает ошибки удаления отдельных объектов.
+func (s *MinioStorage) removeObjects(ctx context.Context, objects <-chan minio.ObjectInfo) []remote.RemoveError {
+	var errs []remote.RemoveError
+	for e := range s.client.RemoveObjects(ctx, s.cfg.BucketName, objects, minio.RemoveObjectsOptions{}) {
+		name := strings.TrimPrefix(strings.TrimPrefix(e.ObjectName, s.cfg.Prefix), "/")
+		errs = append(errs, remote.RemoveError{Name: name, Err: mapError("remove", name, e.Err)})
+	}
+	return errs
+}
@@ -0,0 +1,109 @@
+package miniostorage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/tenrok/filestore/remote"
+)
+
+// upload сохраняет файлы names с произвольным содержимым.
+func upload(t *testing.T, s *MinioStorage, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		if err := s.Upload(name, strings.NewReader(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// remaining возвращает имена оставшихся объектов бакета.
+func remaining(f *fakeS3) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var names []string
+	for key := range f.objects {
+		names = append(names, strings.TrimPrefix(key, "/bucket/"))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestRemoveMany(t *testing.T) {
+	ctx := context.Background()
+	fake, srv := newFakeS3(t)
+	s := newTestStorage(t, srv, "")
+	s.cfg.Prefix = "tenant"
+
+	upload(t, s, "a", "b", "locked", "keep")
+	fake.locked["/bucket/tenant/locked"] = true
+
+	errs := remote.RemoveMany(ctx, s, []string{"a", "b", "missing", "locked"})
+	if len(errs) != 1 || errs[0].Name != "locked" || minio.ToErrorResponse(errs[0].Err).Code != "AccessDenied" {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if got := remaining(fake); got != "tenant/keep,tenant/locked" {
+		t.Fatalf("unexpected objects left: %s", got)
+	}
+	// Все объекты удаляются одним запросом
+	if fake.deletes != 1 {
+		t.Fatalf("expected 1 delete request, got %d", fake.deletes)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	errs = s.RemoveMany(canceled, []string{"keep"})
+	if len(errs) != 1 || errs[0].Name != "keep" || !errors.Is(errs[0].Err, context.Canceled) {
+		t.Fatalf("expected canceled error for keep, got %v", errs)
+	}
+	if ok, _ := s.IsExists("keep"); !ok {
+		t.Fatal("file is removed after cancellation")
+	}
+}
+
+func TestRemovePrefix(t *testing.T) {
+	ctx := context.Background()
+	fake, srv := newFakeS3(t)
+	fake.maxKeys = 2
+	s := newTestStorage(t, srv, "")
+
+	upload(t, s, "t1/x", "t1/sub/y", "t1/sub/z", "t10/z", "t2/keep", "t1-backup")
+	fake.locked["/bucket/t1/sub/z"] = true
+
+	errs, err := remote.RemovePrefix(ctx, s, "t1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Name != "t1/sub/z" {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if got := remaining(fake); got != "t1-backup,t1/sub/z,t10/z,t2/keep" {
+		t.Fatalf("unexpected objects left: %s", got)
+	}
+	// Список запрашивается постранично
+	if fake.listings < 2 {
+		t.Fatalf("expected paginated listing, got %d requests", fake.listings)
+	}
+
+	// Без косой черты префикс захватывает и соседние имена
+	delete(fake.locked, "/bucket/t1/sub/z")
+	if errs, err := s.RemovePrefix(ctx, "t1"); err != nil || len(errs) != 0 {
+		t.Fatalf("RemovePrefix: %v, %v", errs, err)
+	}
+	if got := remaining(fake); got != "t2/keep" {
+		t.Fatalf("unexpected objects left: %s", got)
+	}
+
+	// Ошибка получения списка возвращается отдельно от ошибок удаления
+	s.cfg.BucketName = "missing"
+	if errs, err := s.RemovePrefix(ctx, "t2/"); !errors.Is(err, fs.ErrNotExist) || len(errs) != 0 {
+		t.Fatalf("expected listing error, got %v, %v", errs, err)
+	}
+}
@@ -0,0 +1,62 @@
+package miniostorage
+
+import (
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/tenrok/filestore/remote"
+)
+
+// newServerSide возвращает параметры шифрования на стороне сервера, заданные в конфигурации.
+func newServerSide(cfg *Config) (encrypt.ServerSide, error) {
+	switch cfg.SSE {
+	case "s3":
+		return encrypt.NewSSE(), nil
+	case "kms":
+		return encrypt.NewSSEKMS(cfg.KMSKeyID, nil)
+	case "c":
+		return encrypt.NewSSEC(cfg.CustomerKey)
+	}
+	return nil, nil
+}
+
+// WithCustomerKey возвращает копию хранилища, которая шифрует новые объекты ключом SSE-C key
+// и использует его для чтения, получения сведений и копирования объектов.
+// Ключ не сохраняется на сервере: без него объекты прочитать нельзя.
+func (s *MinioStorage) WithCustomerKey(key []byte) (*MinioStorage, error) {
+	sse, err := encrypt.NewSSEC(key)
+	if err != nil {
+		return nil, err
+	}
+	cp := *s
+	cp.sse = sse
+	return &cp, nil
+}
+
+// writeSSE возвращает параметры шифрования для записи объекта с опциями opts.
+// Ключ remote.WithCustomerKey имеет приоритет над параметрами хранилища.
+func (s *MinioStorage) writeSSE(opts ...remote.Option) (encrypt.ServerSide, error) {
+	o := &remote.Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.CustomerKey != nil {
+		return encrypt.NewSSEC(o.CustomerKey)
+	}
+	return s.sse, nil
+}
+
+// sourceSSE возвращает параметры шифрования исходного объекта при копировании с опциями opts.
+// Серверу их нужно передавать только для SSE-C. Ключ remote.WithSourceCustomerKey имеет
+// приоритет над ключом хранилища.
+func (s *MinioStorage) sourceSSE(opts ...remote.Option) (encrypt.ServerSide, error) {
+	o := &remote.Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.SourceCustomerKey != nil {
+		return encrypt.NewSSEC(o.SourceCustomerKey)
+	}
+	if s.sse != nil && s.sse.Type() == encrypt.SSEC {
+		return s.sse, nil
+	}
+	return nil, nil
+}
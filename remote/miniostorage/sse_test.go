@@ -0,0 +1,176 @@
+package miniostorage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/tenrok/filestore/remote"
+	_ "github.com/tenrok/filestore/remote/memstorage"
+)
+
+func TestSSE(t *testing.T) {
+	customerKey := bytes.Repeat([]byte{1}, 32)
+	keyMD5 := md5.Sum(customerKey)
+
+	cases := []struct {
+		name   string
+		query  string
+		header map[string]string
+	}{
+		{
+			name:   "s3",
+			query:  "sse=s3",
+			header: map[string]string{hdrSSE: "AES256"},
+		},
+		{
+			name:   "kms",
+			query:  "sse=kms&sse_kms_key_id=my-key",
+			header: map[string]string{hdrSSE: "aws:kms", hdrKMSKeyID: "my-key"},
+		},
+		{
+			name:   "c",
+			query:  "sse=c&sse_c_key=" + base64.StdEncoding.EncodeToString(customerKey),
+			header: map[string]string{hdrKeyMD5: base64.StdEncoding.EncodeToString(keyMD5[:])},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, srv := newFakeS3(t)
+			s := newTestStorage(t, srv, tc.query)
+
+			if err := s.Upload("a", strings.NewReader("data")); err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tc.header {
+				if got := fake.puts["/bucket/a"].Get(k); got != v {
+					t.Errorf("%s: expected %q, got %q", k, v, got)
+				}
+			}
+
+			if info, err := s.Stat("a"); err != nil || info.Size() != 4 {
+				t.Fatalf("Stat: %v, %v", info, err)
+			}
+			if got := readAll(t, s, "a"); got != "data" {
+				t.Fatalf("expected data, got %q", got)
+			}
+
+			if err := s.Copy(context.Background(), "a", "b"); err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tc.header {
+				if got := fake.puts["/bucket/b"].Get(k); got != v {
+					t.Errorf("copy %s: expected %q, got %q", k, v, got)
+				}
+			}
+		})
+	}
+}
+
+func TestSSECustomerKeyPerObject(t *testing.T) {
+	key := bytes.Repeat([]byte{2}, 32)
+	_, srv := newFakeS3(t)
+	s := newTestStorage(t, srv, "")
+
+	if err := s.Upload("secret", strings.NewReader("data"), remote.WithCustomerKey(key)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat("secret"); err == nil {
+		t.Fatal("expected Stat without the customer key to fail")
+	}
+
+	withKey, err := s.WithCustomerKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, withKey, "secret"); got != "data" {
+		t.Fatalf("expected data, got %q", got)
+	}
+
+	// Копия шифруется ключом из опций, исходный объект читается ключом хранилища
+	other := bytes.Repeat([]byte{3}, 32)
+	if err := withKey.Copy(context.Background(), "secret", "rotated", remote.WithCustomerKey(other)); err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := s.WithCustomerKey(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, rotated, "rotated"); got != "data" {
+		t.Fatalf("expected data, got %q", got)
+	}
+
+	if _, err := s.WithCustomerKey([]byte("short")); err == nil {
+		t.Fatal("expected error for invalid key")
+	}
+}
+
+// Объект SSE-C копируется и перемещается через хранилище без ключа, если ключ исходного
+// объекта передан в опциях.
+func TestSSESourceCustomerKey(t *testing.T) {
+	ctx := context.Background()
+	key := bytes.Repeat([]byte{5}, 32)
+	keyMD5 := md5.Sum(key)
+	fake, srv := newFakeS3(t)
+	s := newTestStorage(t, srv, "")
+
+	if err := s.Upload("secret", strings.NewReader("data"), remote.WithCustomerKey(key)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Copy(ctx, "secret", "copy"); err == nil {
+		t.Fatal("expected Copy without the source key to fail")
+	}
+
+	if err := s.Copy(ctx, "secret", "copy", remote.WithSourceCustomerKey(key), remote.WithCustomerKey(key)); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.puts["/bucket/copy"].Get(hdrKeyMD5); got != base64.StdEncoding.EncodeToString(keyMD5[:]) {
+		t.Fatalf("expected copy to be encrypted with the customer key, got key MD5 %q", got)
+	}
+	if err := s.Move(ctx, "copy", "moved", remote.WithSourceCustomerKey(key)); err != nil {
+		t.Fatal(err)
+	}
+	// Без WithCustomerKey копия шифруется по параметрам хранилища
+	if got := readAll(t, s, "moved"); got != "data" {
+		t.Fatalf("expected data, got %q", got)
+	}
+	if ok, _ := s.IsExists("copy"); ok {
+		t.Fatal("expected moved file to be removed")
+	}
+	if err := s.Move(ctx, "secret", "secret", remote.WithSourceCustomerKey(key)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// При копировании между хранилищами ключ SSE-C передаётся в Create.
+func TestSSEStreamCopy(t *testing.T) {
+	ctx := context.Background()
+	key := bytes.Repeat([]byte{6}, 32)
+	_, srv := newFakeS3(t)
+	s := newTestStorage(t, srv, "")
+
+	src, err := remote.NewStorage(ctx, "mem://"+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Uploader().Upload("a", strings.NewReader("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := remote.Copy(ctx, s, "a", src, "a", remote.WithCustomerKey(key)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Stat("a"); err == nil {
+		t.Fatal("expected Stat without the customer key to fail")
+	}
+	withKey, err := s.WithCustomerKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readAll(t, withKey, "a"); got != "data" {
+		t.Fatalf("expected data, got %q", got)
+	}
+}
@@ -3,15 +3,14 @@ package miniostorage
 import (
 	"bytes"
 	"context"
-	"fmt"
-	"io"
 
 	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
 	"github.com/tenrok/filestore/remote"
 )
 
-// Убеждаемся в том, что мы всегда реализуем интерфейс io.WriteCloser.
-var _ io.WriteCloser = (*minioWriter)(nil)
+// Убеждаемся в том, что мы всегда реализуем интерфейс remote.VersionWriter.
+var _ remote.VersionWriter = (*minioWriter)(nil)
 
 // minioWriter реализует интерфейс io.WriteCloser.
 type minioWriter struct {
@@ -22,9 +21,11 @@ type minioWriter struct {
 	buffer      *bytes.Buffer
 	metadata    remote.Metadata
 	contentType string
+	sse         encrypt.ServerSide
+	versionID   string
 }
 
-func newMinioWriter(ctx context.Context, client *minio.Client, bucket, path string, opts ...remote.Option) *minioWriter {
+func newMinioWriter(ctx context.Context, client *minio.Client, bucket, path string, sse encrypt.ServerSide, opts ...remote.Option) *minioWriter {
 	o := &remote.Options{}
 	for _, opt := range opts {
 		opt(o)
@@ -36,6 +37,7 @@ func newMinioWriter(ctx context.Context, client *minio.Client, bucket, path stri
 		bucket: bucket,
 		path:   path,
 		buffer: bytes.NewBuffer(nil),
+		sse:    sse,
 	}
 
 	if o.ContentType != "" {
@@ -62,21 +64,17 @@ func (w *minioWriter) Close() error {
 	case <-w.ctx.Done():
 		return w.ctx.Err()
 	default:
-		opts := minio.PutObjectOptions{}
+		opts := minio.PutObjectOptions{ServerSideEncryption: w.sse}
 
 		if w.contentType != "" {
 			opts.ContentType = w.contentType
 		}
 
 		if w.metadata != nil {
-			userMetadata := make(map[string]string)
-			for k, v := range w.metadata {
-				userMetadata[k] = fmt.Sprintf("%v", v)
-			}
-			opts.UserMetadata = userMetadata
+			opts.UserMetadata = userMetadata(w.metadata)
 		}
 
-		_, err := w.client.PutObject(
+		info, err := w.client.PutObject(
 			w.ctx,
 			w.bucket,
 			w.path,
@@ -84,6 +82,14 @@ func (w *minioWriter) Close() error {
 			int64(w.buffer.Len()),
 			opts,
 		)
-		return err
+		if err != nil {
+			return err
+		}
+		w.versionID = info.VersionID
+		return nil
 	}
 }
+
+// VersionID реализует метод remote.VersionWriter. Пустая строка означает,
+// что версионирование бакета не включено.
+func (w *minioWriter) VersionID() string { return w.versionID }
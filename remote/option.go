@@ -3,8 +3,10 @@ package remote
 type Option func(*Options)
 
 type Options struct {
-	Metadata    Metadata
-	ContentType string
+	Metadata          Metadata
+	ContentType       string
+	CustomerKey       []byte
+	SourceCustomerKey []byte
 }
 
 // WithMetadata устанавливает метаданные.
@@ -14,6 +16,26 @@ func WithMetadata(metadata Metadata) Option {
 	}
 }
 
+// WithCustomerKey устанавливает ключ шифрования на стороне сервера, предоставляемый клиентом
+// (SSE-C, 32 байта). Хранилища без поддержки SSE-C игнорируют его.
+//
+// Open и Stat не принимают опций, поэтому такой файл читается только через хранилище,
+// настроенное на этот ключ (например, MinioStorage.WithCustomerKey).
+func WithCustomerKey(key []byte) Option {
+	return func(o *Options) {
+		o.CustomerKey = key
+	}
+}
+
+// WithSourceCustomerKey устанавливает ключ SSE-C, которым зашифрован исходный файл при копировании
+// и перемещении на стороне сервера (Copier). Копия шифруется ключом WithCustomerKey или
+// по параметрам хранилища. Хранилища без поддержки SSE-C игнорируют его.
+func WithSourceCustomerKey(key []byte) Option {
+	return func(o *Options) {
+		o.SourceCustomerKey = key
+	}
+}
+
 // WithContentType устанавливает тип файла.
 func WithContentType(contentType string) Option {
 	return func(o *Options) {
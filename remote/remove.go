@@ -0,0 +1,127 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// removeWorkers количество параллельных запросов Remove при удалении файлов
+// в хранилищах, которые не реализуют BatchRemover.
+const removeWorkers = 16
+
+// RemoveError описывает ошибку удаления одного файла при пакетном удалении.
+type RemoveError struct {
+	Name string
+	Err  error
+}
+
+func (e *RemoveError) Error() string { return "remove " + e.Name + ": " + e.Err.Error() }
+
+func (e *RemoveError) Unwrap() error { return e.Err }
+
+// BatchRemover реализуется хранилищами, которые умеют удалять несколько файлов одним запросом.
+//
+// Отсутствие файла не считается ошибкой. Ошибки удаления отдельных файлов не прерывают
+// удаление остальных и возвращаются списком.
+type BatchRemover interface {
+	// RemoveMany удаляет файлы names.
+	RemoveMany(ctx context.Context, names []string) []RemoveError
+
+	// RemovePrefix удаляет все файлы, имена которых начинаются с prefix. Чтобы удалить
+	// содержимое каталога, prefix должен оканчиваться косой чертой. Ошибка возвращается,
+	// если не удалось получить список файлов.
+	RemovePrefix(ctx context.Context, prefix string) ([]RemoveError, error)
+}
+
+// RemoveMany удаляет файлы names из хранилища s. Если хранилище не реализует BatchRemover,
+// файлы удаляются параллельными вызовами Remove.
+func RemoveMany(ctx context.Context, s Storage, names []string) []RemoveError {
+	if br, ok := s.(BatchRemover); ok {
+		return br.RemoveMany(ctx, names)
+	}
+
+	errs := make([]error, len(names))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(removeWorkers, len(names)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				if err := s.Remove(names[i]); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					errs[i] = err
+				}
+			}
+		}()
+	}
+	for i := range names {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	var result []RemoveError
+	for i, err := range errs {
+		if err != nil {
+			result = append(result, RemoveError{Name: names[i], Err: err})
+		}
+	}
+	return result
+}
+
+// RemovePrefix удаляет из хранилища s все файлы, имена которых начинаются с prefix.
+// Если хранилище не реализует BatchRemover, файлы перечисляются через Lister
+// и удаляются с помощью RemoveMany; без Lister возвращается errors.ErrUnsupported.
+func RemovePrefix(ctx context.Context, s Storage, prefix string) ([]RemoveError, error) {
+	if br, ok := s.(BatchRemover); ok {
+		return br.RemovePrefix(ctx, prefix)
+	}
+
+	lister, ok := s.(Lister)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+
+	var names []string
+	dir, _ := path.Split(prefix)
+	if err := listPrefix(ctx, lister, strings.TrimSuffix(dir, "/"), prefix, &names); err != nil {
+		return nil, err
+	}
+	return RemoveMany(ctx, s, names), nil
+}
+
+// listPrefix рекурсивно собирает файлы каталога dir, имена которых начинаются с prefix.
+func listPrefix(ctx context.Context, lister Lister, dir, prefix string, names *[]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	infos, err := lister.List(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range infos {
+		name := path.Join(dir, path.Base(strings.TrimSuffix(info.Name(), "/")))
+		if !info.IsDir() {
+			if strings.HasPrefix(name, prefix) {
+				*names = append(*names, name)
+			}
+			continue
+		}
+		// Заходим в каталог, если он лежит внутри префикса или префикс продолжается внутри него
+		if name += "/"; strings.HasPrefix(name, prefix) || strings.HasPrefix(prefix, name) {
+			if err := listPrefix(ctx, lister, strings.TrimSuffix(name, "/"), prefix, names); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package remote_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tenrok/filestore/remote"
+	_ "github.com/tenrok/filestore/remote/memstorage"
+)
+
+var errLocked = errors.New("locked")
+
+// plainStorage скрывает все необязательные интерфейсы хранилища, кроме Lister,
+// и запрещает удаление файлов locked.
+type plainStorage struct {
+	remote.Storage
+	locked string
+
+	mu      sync.Mutex
+	removed []string
+}
+
+func (s *plainStorage) Remove(name string) error {
+	if name == s.locked {
+		return errLocked
+	}
+	if err := s.Storage.Remove(name); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removed = append(s.removed, name)
+	return nil
+}
+
+func (s *plainStorage) List(dir string) ([]remote.FileInfo, error) {
+	return s.Storage.(remote.Lister).List(dir)
+}
+
+// noLister скрывает все необязательные интерфейсы хранилища.
+type noLister struct {
+	remote.Storage
+}
+
+func newPlainStorage(t *testing.T, locked string, names ...string) *plainStorage {
+	t.Helper()
+
+	s, err := remote.NewStorage(context.Background(), "mem://"+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err := s.Uploader().Upload(name, strings.NewReader(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &plainStorage{Storage: s, locked: locked}
+}
+
+func TestRemoveManyFallback(t *testing.T) {
+	ctx := context.Background()
+	var names []string
+	for i := range 100 {
+		names = append(names, "f"+strings.Repeat("x", i))
+	}
+	s := newPlainStorage(t, "locked", append(names, "locked")...)
+	if _, ok := any(s).(remote.BatchRemover); ok {
+		t.Fatal("test storage must not implement BatchRemover")
+	}
+
+	errs := remote.RemoveMany(ctx, s, append(names, "locked", "missing"))
+	if len(errs) != 1 || errs[0].Name != "locked" || !errors.Is(&errs[0], errLocked) {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(s.removed) != len(names) {
+		t.Fatalf("expected %d files to be removed, got %d", len(names), len(s.removed))
+	}
+	if ok, _ := s.IsExists("locked"); !ok {
+		t.Fatal("locked file is removed")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	errs = remote.RemoveMany(canceled, s, []string{"locked", "a"})
+	if len(errs) != 2 || !errors.Is(errs[0].Err, context.Canceled) || !errors.Is(errs[1].Err, context.Canceled) {
+		t.Fatalf("expected canceled errors, got %v", errs)
+	}
+}
+
+func TestRemovePrefixFallback(t *testing.T) {
+	ctx := context.Background()
+	s := newPlainStorage(t, "t1/sub/locked", "t1/x", "t1/sub/y", "t1/sub/locked", "t10/z", "t2/keep", "t1-backup")
+
+	errs, err := remote.RemovePrefix(ctx, s, "t1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 1 || errs[0].Name != "t1/sub/locked" {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	for name, want := range map[string]bool{"t1/x": false, "t1/sub/y": false, "t10/z": true, "t1-backup": true, "t2/keep": true} {
+		if ok, _ := s.IsExists(name); ok != want {
+			t.Errorf("%s: expected exists %v", name, want)
+		}
+	}
+
+	if _, err := remote.RemovePrefix(ctx, s, "t1"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{"t10/z": false, "t1-backup": false, "t2/keep": true} {
+		if ok, _ := s.IsExists(name); ok != want {
+			t.Errorf("%s: expected exists %v", name, want)
+		}
+	}
+
+	if _, err := remote.RemovePrefix(ctx, noLister{s}, "t2/"); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected errors.ErrUnsupported, got %v", err)
+	}
+	if _, err := s.Stat("t2/keep"); errors.Is(err, fs.ErrNotExist) {
+		t.Fatal("file is removed without Lister")
+	}
+}
@@ -17,6 +17,31 @@ type Uploader interface {
 	Upload(path string, reader io.Reader, opts ...Option) error
 }
 
+// Lister реализуется хранилищами, которые умеют перечислять содержимое каталогов.
+// Он необходим для чтения каталогов через FS.
+type Lister interface {
+	// List возвращает файлы и каталоги, непосредственно вложенные в каталог dir.
+	// Корневой каталог задаётся пустой строкой.
+	List(dir string) ([]FileInfo, error)
+}
+
+// MetadataStore реализуется хранилищами, которые позволяют изменять метаданные и теги
+// существующих файлов без повторной загрузки содержимого.
+type MetadataStore interface {
+	// GetMetadata возвращает пользовательские метаданные файла.
+	GetMetadata(name string) (Metadata, error)
+
+	// SetMetadata заменяет пользовательские метаданные файла. Тип содержимого сохраняется.
+	// В хранилищах с поддержкой версий изменение метаданных создаёт новую версию.
+	SetMetadata(name string, metadata Metadata) error
+
+	// GetTags возвращает теги файла.
+	GetTags(name string) (Tags, error)
+
+	// SetTags заменяет теги файла. Пустой набор удаляет все теги.
+	SetTags(name string, tags Tags) error
+}
+
 type Storage interface {
 	NewStorage(ctx context.Context, connString string) (Storage, error)
 
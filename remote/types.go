@@ -13,7 +13,23 @@ type FileInfo interface {
 	ModTime() time.Time
 	IsDir() bool
 	Sys() interface{}
+
+	// ContentType возвращает тип содержимого файла.
+	ContentType() string
+
+	// ETag возвращает ETag файла.
+	ETag() string
+
+	// Metadata возвращает пользовательские метаданные файла.
+	Metadata() Metadata
+
+	// Tags возвращает теги файла. Хранилище может не возвращать теги в Stat и List;
+	// в этом случае их можно получить через MetadataStore.
+	Tags() Tags
 }
 
 // Metadata метаданные файла
 type Metadata map[string]any
+
+// Tags теги файла
+type Tags map[string]string
@@ -0,0 +1,49 @@
+package remote
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// Version описывает версию файла.
+type Version struct {
+	ID           string    `json:"id"`
+	Size         int64     `json:"size"`
+	ModTime      time.Time `json:"modTime"`
+	IsLatest     bool      `json:"isLatest,omitempty"`     // текущая версия файла
+	DeleteMarker bool      `json:"deleteMarker,omitempty"` // отметка об удалении файла
+}
+
+// Versioner реализуется хранилищами, которые сохраняют предыдущие версии файлов
+// при их перезаписи и удалении.
+type Versioner interface {
+	// OpenVersion открывает версию versionID файла name.
+	OpenVersion(name, versionID string) (http.File, error)
+
+	// StatVersion получает информацию о версии versionID файла name.
+	StatVersion(name, versionID string) (FileInfo, error)
+
+	// ListVersions возвращает версии файла name, начиная с самой новой.
+	ListVersions(name string) ([]Version, error)
+
+	// RemoveVersion безвозвратно удаляет версию versionID файла name.
+	RemoveVersion(name, versionID string) error
+}
+
+// VersionWriter реализуется файлами, которые возвращает Create хранилищ с поддержкой версий.
+type VersionWriter interface {
+	io.WriteCloser
+
+	// VersionID возвращает идентификатор сохранённой версии. Доступен после успешного Close.
+	VersionID() string
+}
+
+// VersionID возвращает идентификатор версии, сохранённой при закрытии w, или пустую строку,
+// если хранилище не поддерживает версии.
+func VersionID(w io.WriteCloser) string {
+	if vw, ok := w.(VersionWriter); ok {
+		return vw.VersionID()
+	}
+	return ""
+}
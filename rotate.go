@@ -0,0 +1,96 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/tenrok/filestore/encryption"
+)
+
+// RotateKeys перешифровывает все файлы хранилища, зашифрованные не текущим мастер-ключом,
+// а также ещё не зашифрованные файлы. Каждый файл шифруется с новым ключом данных во временный
+// файл и атомарно заменяет исходный, поэтому прерванная ротация не повреждает хранилище
+// и может быть запущена повторно. Возвращает количество перешифрованных файлов.
+func (s *LocalStorage) RotateKeys(ctx context.Context) (int, error) {
+	if s.keys == nil {
+		return 0, ErrNoKeyProvider
+	}
+
+	current := s.keys.CurrentKeyID()
+	rotated := 0
+	err := s.walkBlobs(ctx, func(name, path string, info fs.FileInfo) error {
+		ok, err := s.rotateBlob(name, path, current)
+		if err != nil {
+			return s.wrapPathError(err, name)
+		}
+		if ok {
+			rotated++
+		}
+		return nil
+	})
+	return rotated, err
+}
+
+// rotateBlob перешифровывает один файл, если он зашифрован не ключом current.
+func (s *LocalStorage) rotateBlob(name, path, current string) (bool, error) {
+	mu := s.getMutex(name)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		s.releaseMutex(name)
+	}()
+
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil // файл удалён во время обхода
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	m, err := s.readMeta(name)
+	if err != nil {
+		return false, err
+	}
+
+	var src io.Reader = file
+	if m.encrypted(file) {
+		r, err := encryption.NewReader(file, info.Size(), s.keys)
+		if err != nil {
+			return false, err
+		}
+		if r.KeyID() == current {
+			return false, nil
+		}
+		src = io.NewSectionReader(r, 0, r.Size())
+	}
+
+	tmpPath, err := s.encrypt(src)
+	if err != nil {
+		return false, err
+	}
+
+	enc := m.blobEncoding
+	enc.Encrypted = true
+	if err := s.setEncoding(name, enc); err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+	if err := s.rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+
+	// Сохраняем время изменения, чтобы ротация не влияла на Clean
+	_ = os.Chtimes(path, info.ModTime(), info.ModTime())
+	return true, nil
+}
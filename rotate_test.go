@@ -0,0 +1,110 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tenrok/filestore/encryption"
+)
+
+func TestRotateKeys(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	// Файлы, сохранённые до включения шифрования, включая начинающийся с сигнатуры
+	plain, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	magicData := append(bytes.Clone(encryptedMagic), "user data"...)
+	contents := [][]byte{[]byte("plain before encryption"), magicData}
+	var names []string
+	for _, data := range contents {
+		names = append(names, createBlob(t, plain, data).Name)
+	}
+	plain.Close()
+
+	keyring := newTestKeyring(t, "k1")
+	s, err := NewLocalStorage(dir, WithEncryption(keyring))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	contents = append(contents, []byte("encrypted with k1"))
+	names = append(names, createBlob(t, s, contents[2]).Name)
+
+	// Открытые файлы шифруются текущим ключом, уже зашифрованные им не трогаются
+	n, err := s.RotateKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rotated files, got %d", n)
+	}
+	assertKeys(t, s, names, contents, "k1")
+
+	if err := keyring.GenerateKey("k2"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err = s.RotateKeys(ctx); err != nil || n != 3 {
+		t.Fatalf("expected 3 rotated files, got %d: %v", n, err)
+	}
+	assertKeys(t, s, names, contents, "k2")
+
+	// Повторная ротация ничего не меняет
+	if n, err = s.RotateKeys(ctx); err != nil || n != 0 {
+		t.Fatalf("expected no rotated files, got %d: %v", n, err)
+	}
+
+	if _, err := newTestStorage(t).RotateKeys(ctx); !errors.Is(err, ErrNoKeyProvider) {
+		t.Fatalf("expected ErrNoKeyProvider, got %v", err)
+	}
+}
+
+// assertKeys проверяет, что файлы names зашифрованы ключом keyID и содержат contents.
+func assertKeys(t *testing.T, s *LocalStorage, names []string, contents [][]byte, keyID string) {
+	t.Helper()
+
+	for i, name := range names {
+		stored := readStored(t, s, name)
+		if id, _, err := encryption.Info(bytes.NewReader(stored), int64(len(stored))); err != nil || id != keyID {
+			t.Errorf("%s: expected key %q, got %q: %v", name, keyID, id, err)
+		}
+		if got := readBlob(t, s, name); !bytes.Equal(got, contents[i]) {
+			t.Errorf("%s: expected %q, got %q", name, contents[i], got)
+		}
+	}
+}
+
+// Ротация, прерванная между записью метаданных и заменой файла, оставляет открытое
+// содержимое с отметкой о шифровании. Такой файл должен читаться и шифроваться повторно.
+func TestRotateKeysInterrupted(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("interrupted rotation")
+
+	plain, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fi := createBlob(t, plain, data)
+	plain.Close()
+
+	s, err := NewLocalStorage(dir, WithEncryption(newTestKeyring(t, "k1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.setEncoding(fi.Name, blobEncoding{Encrypted: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readBlob(t, s, fi.Name); !bytes.Equal(got, data) {
+		t.Fatalf("expected %q, got %q", data, got)
+	}
+	if n, err := s.RotateKeys(context.Background()); err != nil || n != 1 {
+		t.Fatalf("expected 1 rotated file, got %d: %v", n, err)
+	}
+	assertKeys(t, s, []string{fi.Name}, [][]byte{data}, "k1")
+}
@@ -3,19 +3,20 @@ package filestore
 import (
 	"bufio"
 	"context"
-	"crypto/md5"
-	"encoding/base32"
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"hash/crc32"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/tenrok/filestore/encryption"
 )
 
 // tmpfileName используется в качестве имени временного файла при генерации ошибок
@@ -24,15 +25,36 @@ const tmpfileName = "<temporary file>"
 // минимальная длина имени файла, необходимая для разбиения на подкаталоги
 const minNameLen = 27
 
+// ErrInvalidName возвращается для имён, которые не могут быть именами файлов хранилища.
+var ErrInvalidName = errors.New("invalid file name")
+
 // LocalStorage описывает хранилище файлов.
 type LocalStorage struct {
 	rootDir string
 	perm    os.FileMode
+	keys    encryption.KeyProvider // ключи шифрования; nil — файлы хранятся открытыми
+
+	compression   *CompressionPolicy // политика сжатия; nil — файлы не сжимаются
+	chunking      *ChunkingPolicy    // политика разбиения на фрагменты; nil — файлы не разбиваются
+	durable       bool               // сбрасывать данные и каталоги на диск
+	recovery      *bool              // проверять хранилище при открытии; значение — проверять ли хеш-суммы
+	access        AccessTracker      // учёт обращений к файлам
+	protectPinned bool               // запрещать Remove для закреплённых файлов
+
+	// квоты пространств имён; загружаются при первом обращении
+	quotaMu sync.Mutex
+	quota   *quotaState
 
 	// защита для map мьютексов
 	mu        sync.Mutex
 	once      sync.Once
-	fileMutex map[string]*sync.Mutex // мьютекс на имя файла
+	fileMutex map[string]*nameMutex // мьютекс на имя файла
+}
+
+// nameMutex мьютекс имени файла со счётчиком использующих его вызовов.
+type nameMutex struct {
+	sync.Mutex
+	refs int
 }
 
 type LocalStorageOption func(*LocalStorage)
@@ -44,14 +66,31 @@ func WithPermissions(perm os.FileMode) LocalStorageOption {
 	}
 }
 
+// WithEncryption включает шифрование сохраняемых файлов. Имена файлов по-прежнему
+// вычисляются по открытому содержимому, поэтому дедупликация продолжает работать.
+func WithEncryption(keys encryption.KeyProvider) LocalStorageOption {
+	return func(s *LocalStorage) {
+		s.keys = keys
+	}
+}
+
+// File описывает открытый файл хранилища.
+type File interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+	Readdir(count int) ([]fs.FileInfo, error)
+	Stat() (fs.FileInfo, error)
+}
+
 // FileInfo описывает информацию о сохраненном файле.
 type FileInfo struct {
-	Path     string // полный путь внутри хранилища
-	Name     string // уникальное имя файла
-	Mimetype string
-	Size     int64
-	CRC32    uint32
-	MD5      string
+	Path     string `json:"path"` // полный путь внутри хранилища
+	Name     string `json:"name"` // уникальное имя файла
+	Mimetype string `json:"mimetype"`
+	Size     int64  `json:"size"`
+	CRC32    uint32 `json:"crc32"`
+	MD5      string `json:"md5"`
+	SHA256   string `json:"sha256"`
 }
 
 // NewLocalStorage открывает и возвращает хранилище файлов.
@@ -59,7 +98,7 @@ func NewLocalStorage(rootDir string, opts ...LocalStorageOption) (*LocalStorage,
 	s := &LocalStorage{}
 	s.rootDir = rootDir
 	s.perm = 0700
-	s.fileMutex = make(map[string]*sync.Mutex)
+	s.fileMutex = make(map[string]*nameMutex)
 
 	for _, opt := range opts {
 		opt(s)
@@ -72,20 +111,42 @@ func NewLocalStorage(rootDir string, opts ...LocalStorageOption) (*LocalStorage,
 	}
 	s.rootDir = absRoot
 
+	// Сжатые файлы должны оставаться читаемыми после перезапуска
+	if s.compression != nil {
+		if err := s.compression.validate(); err != nil {
+			return nil, err
+		}
+	}
+
 	// Создаём каталог, если он ещё не создан
 	if err := os.MkdirAll(s.rootDir, s.perm); err != nil {
 		return nil, err
 	}
 
+	// По умолчанию обращения к файлам учитываются в журнале внутри rootDir
+	if s.access == nil {
+		if s.access, err = NewLogTracker(filepath.Join(s.rootDir, accessLogName)); err != nil {
+			return nil, err
+		}
+	}
+
+	// Удаляем файлы, повреждённые при предыдущем аварийном завершении
+	if s.recovery != nil {
+		if _, err := s.Recover(context.Background(), *s.recovery); err != nil {
+			return nil, err
+		}
+	}
+
 	return s, nil
 }
 
 // getMutex возвращает мьютекс для имени файла, создавая его при необходимости.
-func (s *LocalStorage) getMutex(name string) *sync.Mutex {
+// Каждый вызов getMutex должен завершаться вызовом releaseMutex.
+func (s *LocalStorage) getMutex(name string) *nameMutex {
 	s.once.Do(func() {
 		// инициализация уже выполнена в NewLocalStorage, но оставляем для безопасности
 		if s.fileMutex == nil {
-			s.fileMutex = make(map[string]*sync.Mutex)
+			s.fileMutex = make(map[string]*nameMutex)
 		}
 	})
 
@@ -94,17 +155,26 @@ func (s *LocalStorage) getMutex(name string) *sync.Mutex {
 
 	mu, ok := s.fileMutex[name]
 	if !ok {
-		mu = &sync.Mutex{}
+		mu = &nameMutex{}
 		s.fileMutex[name] = mu
 	}
+	mu.refs++
 	return mu
 }
 
-// releaseMutex удаляет мьютекс из map после использования (вызывать после Unlock).
+// releaseMutex освобождает мьютекс после использования (вызывать после Unlock).
+// Мьютекс удаляется из map, только когда его не удерживает и не ожидает ни один вызов:
+// иначе ожидающие получили бы разные мьютексы для одного имени.
 func (s *LocalStorage) releaseMutex(name string) {
 	s.mu.Lock()
-	delete(s.fileMutex, name)
-	s.mu.Unlock()
+	defer s.mu.Unlock()
+
+	if mu, ok := s.fileMutex[name]; ok {
+		mu.refs--
+		if mu.refs <= 0 {
+			delete(s.fileMutex, name)
+		}
+	}
 }
 
 // safePath проверяет, что путь не выходит за пределы rootDir, и возвращает очищенный путь.
@@ -133,11 +203,24 @@ func (s *LocalStorage) safePath(subPath string) (string, error) {
 }
 
 // Create сохраняет файл в хранилище. В качестве имени файла используется комбинация из двух хешей.
-func (s *LocalStorage) Create(ctx context.Context, r io.Reader) (*FileInfo, error) {
+// Опции WithTTL и WithExpiresAt ограничивают срок хранения файла; повторное сохранение
+// того же содержимого может только продлить срок, а сохранение без срока делает файл постоянным.
+func (s *LocalStorage) Create(ctx context.Context, r io.Reader, opts ...CreateOption) (*FileInfo, error) {
+	return s.CreateVerified(ctx, r, Expect{}, opts...)
+}
+
+// CreateVerified сохраняет файл в хранилище, предварительно проверив его размер и хеш-суммы.
+// Если содержимое не совпадает с ожидаемым, файл не сохраняется и возвращается *DigestMismatchError.
+func (s *LocalStorage) CreateVerified(ctx context.Context, r io.Reader, expect Expect, opts ...CreateOption) (*FileInfo, error) {
 	if r == nil {
 		return nil, errors.New("reader is nil")
 	}
 
+	// Не читаем больше, чем нужно для обнаружения несовпадения размера
+	if expect.Size > 0 {
+		r = io.LimitReader(r, expect.Size+1)
+	}
+
 	// Создаём временный файл в корневом каталоге
 	tmpfile, err := os.CreateTemp(s.rootDir, "~tmp")
 	if err != nil {
@@ -158,9 +241,9 @@ func (s *LocalStorage) Create(ctx context.Context, r io.Reader) (*FileInfo, erro
 	}
 	mimetype := http.DetectContentType(data)
 
-	// Одновременно с сохранением в файл считаем две хеш-суммы
-	hashCRC32, hashMD5 := crc32.NewIEEE(), md5.New()
-	multiWriter := io.MultiWriter(tmpfile, hashCRC32, hashMD5)
+	// Одновременно с сохранением в файл считаем хеш-суммы
+	h := newHasher()
+	multiWriter := io.MultiWriter(tmpfile, h)
 
 	type copyResult struct {
 		size int64
@@ -179,85 +262,250 @@ func (s *LocalStorage) Create(ctx context.Context, r io.Reader) (*FileInfo, erro
 		if res.err != nil {
 			return nil, s.wrapPathError(res.err, tmpfileName)
 		}
-		// Формируем информацию о файле
-		sumMD5 := hashMD5.Sum(nil)
-		name := base32.StdEncoding.EncodeToString(append(hashCRC32.Sum(nil), sumMD5...))
-		fi := &FileInfo{
-			Path:     s.GetRelativePath(name),
-			Name:     name,
-			Mimetype: mimetype,
-			Size:     res.size,
-			CRC32:    hashCRC32.Sum32(),
-			MD5:      hex.EncodeToString(sumMD5),
+		// Проверяем содержимое до помещения в хранилище
+		if expect.Size > 0 && res.size > expect.Size {
+			return nil, &DigestMismatchError{
+				Algorithm: "size",
+				Expected:  strconv.FormatInt(expect.Size, 10),
+				Actual:    "more than " + strconv.FormatInt(expect.Size, 10),
+			}
 		}
+		if err := expect.verify(h, res.size); err != nil {
+			return nil, err
+		}
+
+		// Формируем информацию о файле
+		fi := s.newFileInfo(h, mimetype, res.size)
 
 		// Закрываем временный файл
 		if err := tmpfile.Close(); err != nil {
 			return nil, s.wrapPathError(err, tmpfileName)
 		}
 
-		fullPath, err := s.safePath(fi.Path)
-		if err != nil {
+		if err := s.commit(tmpfile.Name(), fi, newCreateOptions(opts)); err != nil {
 			return nil, err
 		}
+		return fi, nil
+	}
+}
+
+// newFileInfo формирует информацию о файле по хеш-суммам его содержимого.
+func (s *LocalStorage) newFileInfo(h *hasher, mimetype string, size int64) *FileInfo {
+	name := h.name()
+	return &FileInfo{
+		Path:     s.GetRelativePath(name),
+		Name:     name,
+		Mimetype: mimetype,
+		Size:     size,
+		CRC32:    h.crc32.Sum32(),
+		MD5:      hex.EncodeToString(h.md5.Sum(nil)),
+		SHA256:   hex.EncodeToString(h.sha256.Sum(nil)),
+	}
+}
+
+// commit помещает файл с исходным содержимым path в хранилище под именем fi.Name.
+// Если файл с таким именем уже существует, то обновляется только время доступа к нему.
+// В обоих случаях к файлу применяется срок хранения из o, и файл добавляется в индекс хеш-сумм.
+// Исходный файл path после успешного сохранения может быть перемещён.
+func (s *LocalStorage) commit(path string, fi *FileInfo, o *createOptions) (err error) {
+	name := fi.Name
+	fullPath, err := s.safePath(fi.Path)
+	if err != nil {
+		return err
+	}
 
-		// Если файл уже существует, то просто обновляем его время создания
-		now := time.Now()
-		if err := os.Chtimes(fullPath, now, now); err == nil {
-			return fi, nil
-		} else if !os.IsNotExist(err) {
-			// Другая ошибка (например, permission denied) – не можем перезаписать
-			return nil, s.wrapPathError(err, name)
+	// Квоту учитываем до сохранения, чтобы при её превышении файл не создавался
+	if o.namespace != "" {
+		charged, err := s.charge(o.namespace, fi)
+		if err != nil {
+			return err
+		}
+		if charged {
+			defer func() {
+				if err != nil {
+					s.Release(o.namespace, name)
+				}
+			}()
 		}
+	}
 
-		// Если такого файла нет, то создаем для него каталоги
-		if err := os.MkdirAll(filepath.Dir(fullPath), s.perm); err != nil {
-			return nil, s.wrapPathError(err, name)
+	existed := false
+	defer func() {
+		if err != nil {
+			return
+		}
+		s.touch(name)
+		if existed {
+			if err = s.adopt(name); err != nil {
+				return
+			}
+		}
+		if existed || !o.expires.IsZero() {
+			err = s.extendExpiry(name, o.expires, existed)
 		}
+		// Ошибка индексации не критична: файл лишь не будет найден через Lookup
+		_ = s.addIndex(fi)
+	}()
+
+	// Если файл уже существует, то просто отмечаем обращение к нему.
+	// Пустой файл под именем непустого содержимого — след прерванной записи, его перезаписываем.
+	if info, err := os.Stat(fullPath); err == nil && (info.Size() > 0 || fi.Size == 0) {
+		existed = true
+		return nil
+	} else if err != nil && !os.IsNotExist(err) {
+		// Другая ошибка (например, permission denied) – не можем перезаписать
+		return s.wrapPathError(err, name)
+	}
 
-		// Перемещаем временный файл
-		if err := os.Rename(tmpfile.Name(), fullPath); err != nil {
-			return nil, s.wrapPathError(err, name)
+	// Если такого файла нет, то создаем для него каталоги
+	if err := os.MkdirAll(filepath.Dir(fullPath), s.perm); err != nil {
+		return s.wrapPathError(err, name)
+	}
+
+	// Большие файлы в режиме разбиения сохраняются в виде фрагментов и манифеста
+	if s.chunking != nil && fi.Size > int64(s.chunking.MaxSize) {
+		if err := s.storeChunked(path, fi, fullPath); err != nil {
+			return s.wrapPathError(err, name)
 		}
+		return nil
+	}
 
-		return fi, nil
+	// Сжимаем и шифруем содержимое, если это необходимо
+	src, enc, err := s.encode(path, fi)
+	if err != nil {
+		return s.wrapPathError(err, tmpfileName)
+	}
+	if src != path {
+		defer os.Remove(src)
+	}
+
+	// Перемещаем временный файл
+	if err := s.place(name, src, fullPath, enc); err != nil {
+		return s.wrapPathError(err, name)
 	}
+
+	return nil
 }
 
-// Open открывает файл из хранилища.
-func (s *LocalStorage) Open(name string) (*os.File, error) {
+// place записывает способ кодирования enc файла name и перемещает закодированный файл src на место.
+func (s *LocalStorage) place(name, src, fullPath string, enc blobEncoding) error {
+	mu := s.getMutex(name)
+	mu.Lock()
+	defer func() {
+		mu.Unlock()
+		s.releaseMutex(name)
+	}()
+
+	if err := s.setEncoding(name, enc); err != nil {
+		return err
+	}
+	return s.rename(src, fullPath)
+}
+
+// Open открывает файл из хранилища. Сжатые и зашифрованные файлы декодируются при чтении.
+func (s *LocalStorage) Open(name string) (File, error) {
+	file, fi, enc, err := s.openStored(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.decode(file, fi, enc)
+	if err != nil {
+		file.Close()
+		return nil, s.wrapPathError(err, name)
+	}
+	return f, nil
+}
+
+// OpenEncoded открывает сжатое представление файла без распаковки. coding задаёт алгоритм
+// сжатия (например, "gzip"). Если файл хранится несжатым или сжат другим алгоритмом,
+// возвращается ErrNotEncoded.
+func (s *LocalStorage) OpenEncoded(name, coding string) (File, error) {
+	file, fi, enc, err := s.openStored(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.decodeEncoded(file, fi, enc, coding)
+	if err != nil {
+		file.Close()
+		return nil, s.wrapPathError(err, name)
+	}
+	return f, nil
+}
+
+// openStored открывает хранимый файл без декодирования и отмечает обращение к нему.
+// Возвращает также записанный способ кодирования содержимого.
+func (s *LocalStorage) openStored(name string) (*os.File, fs.FileInfo, blobEncoding, error) {
+	file, fi, enc, err := s.openBlob(name)
+	if err != nil {
+		return nil, nil, blobEncoding{}, err
+	}
+	s.touch(name)
+	return file, fi, enc, nil
+}
+
+// statContent возвращает сведения о файле с размером исходного содержимого.
+// В отличие от Open, обращение к файлу не отмечается.
+func (s *LocalStorage) statContent(name string) (fs.FileInfo, error) {
+	file, fi, enc, err := s.openBlob(name)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := s.decode(file, fi, enc)
+	if err != nil {
+		file.Close()
+		return nil, s.wrapPathError(err, name)
+	}
+	defer f.Close()
+	return f.Stat()
+}
+
+// openBlob открывает хранимый файл без декодирования.
+func (s *LocalStorage) openBlob(name string) (*os.File, fs.FileInfo, blobEncoding, error) {
 	// Полное имя для доступа к файлу
 	fullPath, err := s.GetFullPath(name)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return nil, os.ErrNotExist
+			return nil, nil, blobEncoding{}, os.ErrNotExist
 		}
-		return nil, err
+		return nil, nil, blobEncoding{}, err
 	}
 
 	// Открываем файл
 	file, err := os.Open(fullPath)
 	if err != nil {
-		return nil, s.wrapPathError(err, name)
+		return nil, nil, blobEncoding{}, s.wrapPathError(err, name)
 	}
 
 	// Получаем информацию о файле и проверяем, что это не каталог
 	fi, err := file.Stat()
 	if err != nil {
 		file.Close()
-		return nil, s.wrapPathError(err, name)
+		return nil, nil, blobEncoding{}, s.wrapPathError(err, name)
 	}
 
 	// Возвращаем ошибку, если это каталог, а не файл
 	if fi.IsDir() {
 		file.Close()
-		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
+		return nil, nil, blobEncoding{}, &os.PathError{Op: "open", Path: name, Err: os.ErrPermission}
 	}
 
-	// Обновляем время доступа (ошибку игнорируем, это не критично)
-	now := time.Now()
-	_ = os.Chtimes(fullPath, now, now)
-	return file, nil
+	// Без метаданных нельзя ни проверить срок хранения, ни декодировать содержимое
+	m, err := s.readMeta(name)
+	if err != nil {
+		file.Close()
+		return nil, nil, blobEncoding{}, err
+	}
+
+	// Файл с истёкшим сроком хранения считается удалённым ещё до очистки
+	if m.expired(time.Now()) {
+		file.Close()
+		return nil, nil, blobEncoding{}, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	return file, fi, m.blobEncoding, nil
 }
 
 // Remove удаляет файл из хранилища.
@@ -277,12 +525,51 @@ func (s *LocalStorage) Remove(name string) error {
 		return err
 	}
 
+	if err := s.checkRemove(name); err != nil {
+		return err
+	}
+	return s.removeBlob(name, fullPath)
+}
+
+// removeBlob удаляет файл хранилища. Вызывающий должен удерживать мьютекс имени файла.
+// Фрагменты, на которые ссылаются другие файлы, и файлы на удержании не удаляются;
+// для манифестов освобождаются ссылки на их фрагменты.
+func (s *LocalStorage) removeBlob(name, fullPath string) error {
+	m, err := s.readMeta(name)
+	if err != nil {
+		return err
+	}
+	if len(m.Holds) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: ErrOnHold}
+	}
+
+	refs, err := s.refs(name)
+	if err != nil {
+		return err
+	}
+	if refs > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: ErrInUse}
+	}
+
+	// Ошибку чтения манифеста игнорируем: повреждённый файл всё равно должен удаляться
+	chunks, _ := s.manifestChunks(name, fullPath)
+
 	if err := os.Remove(fullPath); err != nil {
 		return s.wrapPathError(err, name)
 	}
+	s.forget(name)
+	s.dropQuota(m)
+	s.removeMeta(name)
 
 	// Удаляем пустые родительские каталоги, но не выше rootDir
 	s.removeEmptyParents(fullPath)
+	if err := s.syncRemoved(fullPath); err != nil {
+		return err
+	}
+
+	for _, c := range chunks {
+		s.releaseChunk(c.name)
+	}
 	return nil
 }
 
@@ -299,68 +586,65 @@ func (s *LocalStorage) removeEmptyParents(path string) {
 	}
 }
 
-// Clean удаляет старые файлы, к которым не обращались больше заданного времени.
-// Если lifetime <= 0, удаляет все файлы.
+// Clean удаляет старые файлы, к которым не обращались больше заданного времени, файлы
+// с истёкшим сроком хранения, а также истёкшие незавершённые загрузки. Если lifetime <= 0,
+// удаляет все файлы. Закреплённые файлы и файлы на удержании не удаляются.
 func (s *LocalStorage) Clean(ctx context.Context, lifetime time.Duration) error {
+	now := time.Now()
+	valid := now.Add(-lifetime)
 	if lifetime <= 0 {
-		// Удаляем всё содержимое rootDir, но не саму директорию
-		entries, err := os.ReadDir(s.rootDir)
-		if err != nil {
-			return err
-		}
-		for _, entry := range entries {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
-			if err := os.RemoveAll(filepath.Join(s.rootDir, entry.Name())); err != nil {
-				// Логируем, но продолжаем (по аналогии с оригиналом)
-				continue
-			}
-		}
-		return nil
+		// Считаем устаревшими все файлы, включая созданные во время очистки
+		valid = now.Add(time.Hour)
 	}
 
-	valid := time.Now().Add(-lifetime)
-	err := filepath.Walk(s.rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // игнорируем ошибки доступа к файлу
-		}
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
-		if info.IsDir() || info.ModTime().After(valid) {
+	err := s.walkBlobs(ctx, func(name, path string, info fs.FileInfo) error {
+		m, err := s.readMeta(name)
+		if err != nil || m.protected() {
 			return nil
 		}
-
-		// Получаем имя файла относительно rootDir
-		rel, err := filepath.Rel(s.rootDir, path)
-		if err != nil {
+		if s.lastAccess(name, info).After(valid) && !m.expired(now) {
 			return nil
 		}
 
-		// Имя файла в нашей терминологии — это путь без rootDir
-		fileName := strings.ReplaceAll(rel, string(os.PathSeparator), "") // упрощённо, но для блокировки нужно исходное имя
-
 		// Блокируем файл на время удаления
-		mu := s.getMutex(fileName)
+		mu := s.getMutex(name)
 		mu.Lock()
-		defer mu.Unlock()
+		defer func() {
+			mu.Unlock()
+			s.releaseMutex(name)
+		}()
 
-		if err := os.Remove(path); err != nil {
-			return nil // игнорируем ошибку удаления
-		}
-		s.removeEmptyParents(path)
+		// Ошибку удаления игнорируем (в том числе для фрагментов, на которые есть ссылки)
+		_ = s.removeBlob(name, path)
 		return nil
 	})
-
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
+
+	// Удаляем записи индекса, ссылающиеся на удалённые файлы
+	if err := s.cleanIndex(ctx); err != nil {
+		return err
+	}
+
+	// Удаляем истёкшие и заброшенные загрузки
+	if err := s.cleanUploads(ctx, lifetime); err != nil {
+		return err
+	}
+
+	// Удаляем забытые временные файлы
+	entries, err := os.ReadDir(s.rootDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "~tmp") || entry.IsDir() {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.ModTime().Before(valid) {
+			os.Remove(filepath.Join(s.rootDir, entry.Name()))
+		}
+	}
 	return nil
 }
 
@@ -387,7 +671,7 @@ func (s *LocalStorage) GetRelativePath(name string) string {
 func (s *LocalStorage) GetFullPath(name string) (string, error) {
 	relPath := s.GetRelativePath(name)
 	if relPath == "" {
-		return "", fmt.Errorf("invalid file name: %s", name)
+		return "", fmt.Errorf("%w: %s", ErrInvalidName, name)
 	}
 	return s.safePath(relPath)
 }
@@ -408,5 +692,9 @@ func (s *LocalStorage) IsExists(name string) (bool, error) {
 		return false, fmt.Errorf("The specified file is a directory")
 	}
 
+	if s.isExpired(name) {
+		return false, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+
 	return true, nil
 }
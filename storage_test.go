@@ -0,0 +1,64 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+)
+
+// newTestStorage открывает хранилище во временном каталоге.
+func newTestStorage(t *testing.T, opts ...LocalStorageOption) *LocalStorage {
+	t.Helper()
+
+	s, err := NewLocalStorage(t.TempDir(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// createBlob сохраняет data в хранилище s.
+func createBlob(t *testing.T, s *LocalStorage, data []byte, opts ...CreateOption) *FileInfo {
+	t.Helper()
+
+	fi, err := s.Create(context.Background(), bytes.NewReader(data), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fi
+}
+
+// readBlob возвращает декодированное содержимое файла name.
+func readBlob(t *testing.T, s *LocalStorage, name string) []byte {
+	t.Helper()
+
+	f, err := s.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// readStored возвращает хранимое (закодированное) содержимое файла name.
+func readStored(t *testing.T, s *LocalStorage, name string) []byte {
+	t.Helper()
+
+	fullPath, err := s.GetFullPath(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,374 @@
+package filestore
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,termination,expiration"
+
+	// тип содержимого запросов PATCH
+	offsetContentType = "application/offset+octet-stream"
+)
+
+// Убеждаемся в том, что мы всегда реализуем интерфейс http.Handler.
+var _ http.Handler = (*TusHandler)(nil)
+
+// TusHandler реализует сервер протокола возобновляемых загрузок tus 1.0 поверх LocalStorage
+// с расширениями creation, creation-with-upload, termination и expiration:
+//
+//	POST   /      создание загрузки (с необязательной передачей первой части данных)
+//	HEAD   /{id}  получение текущего смещения
+//	PATCH  /{id}  передача очередной части данных
+//	DELETE /{id}  удаление загрузки
+//	GET    /{id}  информация о сохранённом файле после завершения загрузки
+//
+// Незавершённые загрузки хранятся в rootDir и удаляются методом Clean после истечения срока.
+type TusHandler struct {
+	storage    *LocalStorage
+	maxSize    int64
+	expiration time.Duration
+	authorize  Authorizer
+	onComplete func(r *http.Request, fi *FileInfo) error
+	namespace  func(r *http.Request) string
+}
+
+type TusOption func(*TusHandler)
+
+// WithTusMaxSize ограничивает размер загружаемого файла.
+func WithTusMaxSize(n int64) TusOption {
+	return func(h *TusHandler) {
+		h.maxSize = n
+	}
+}
+
+// WithTusExpiration задаёт время жизни незавершённой загрузки. Если d <= 0, загрузки не истекают.
+func WithTusExpiration(d time.Duration) TusOption {
+	return func(h *TusHandler) {
+		h.expiration = d
+	}
+}
+
+// WithTusAuthorizer задаёт функцию проверки прав доступа. Для всех запросов передаётся операция OpUpload.
+func WithTusAuthorizer(authorize Authorizer) TusOption {
+	return func(h *TusHandler) {
+		h.authorize = authorize
+	}
+}
+
+// WithTusCompleteHook задаёт функцию, которая вызывается после сохранения файла в хранилище.
+// Ошибка функции возвращается клиенту, но загрузка остаётся завершённой.
+func WithTusCompleteHook(fn func(r *http.Request, fi *FileInfo) error) TusOption {
+	return func(h *TusHandler) {
+		h.onComplete = fn
+	}
+}
+
+// WithTusNamespaceFunc задаёт функцию, определяющую пространство имён, от имени которого
+// сохраняются загружаемые файлы. Квота проверяется при создании загрузки известного размера
+// и при её завершении.
+func WithTusNamespaceFunc(fn func(r *http.Request) string) TusOption {
+	return func(h *TusHandler) {
+		h.namespace = fn
+	}
+}
+
+// NewTusHandler создаёт обработчик протокола tus для хранилища s.
+func NewTusHandler(s *LocalStorage, opts ...TusOption) *TusHandler {
+	h := &TusHandler{
+		storage:    s,
+		expiration: DefaultUploadExpiration,
+	}
+
+	for _, opt := range opts {
+		if opt != nil {
+			opt(h)
+		}
+	}
+
+	return h
+}
+
+// ServeHTTP реализует метод http.Handler.
+func (h *TusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Method == http.MethodOptions {
+		h.options(w)
+		return
+	}
+
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		w.Header().Set("Tus-Version", tusVersion)
+		writeError(w, http.StatusPreconditionFailed, "unsupported tus version")
+		return
+	}
+
+	id := strings.Trim(r.URL.Path, "/")
+	if strings.Contains(id, "/") {
+		id = id[strings.LastIndex(id, "/")+1:]
+	}
+
+	if h.authorize != nil && !h.allow(w, r, id) {
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		h.create(w, r)
+		return
+	}
+	if id == "" {
+		h.methodNotAllowed(w, "OPTIONS, POST")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodHead:
+		h.head(w, id)
+	case http.MethodPatch:
+		h.patch(w, r, id)
+	case http.MethodDelete:
+		h.delete(w, id)
+	case http.MethodGet:
+		h.get(w, id)
+	default:
+		h.methodNotAllowed(w, "OPTIONS, HEAD, PATCH, DELETE, GET")
+	}
+}
+
+// options сообщает о поддерживаемых версиях и расширениях протокола.
+func (h *TusHandler) options(w http.ResponseWriter) {
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	if h.maxSize > 0 {
+		w.Header().Set("Tus-Max-Size", strconv.FormatInt(h.maxSize, 10))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// create создаёт загрузку и, если запрос содержит данные, принимает их.
+func (h *TusHandler) create(w http.ResponseWriter, r *http.Request) {
+	size, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		writeError(w, http.StatusBadRequest, "invalid Upload-Length header")
+		return
+	}
+	if h.maxSize > 0 && size > h.maxSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "upload is too large")
+		return
+	}
+
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var expires time.Time
+	if h.expiration > 0 {
+		expires = time.Now().Add(h.expiration)
+	}
+
+	var namespace string
+	if h.namespace != nil {
+		namespace = h.namespace(r)
+	}
+
+	u, err := h.storage.createUpload(&uploadState{Size: size, Metadata: metadata, Expires: expires, Namespace: namespace})
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	w.Header().Set("Location", h.location(r, u.ID))
+
+	// Пустой файл сохраняем сразу, для остальных принимаем данные из тела запроса
+	if size == 0 || r.Header.Get("Content-Type") == offsetContentType {
+		if u, err = h.append(r, u.ID, 0); err != nil {
+			h.writeUploadError(w, u, err)
+			return
+		}
+		if !h.complete(w, r, u) {
+			return
+		}
+	}
+
+	h.setUploadHeaders(w, u)
+	w.WriteHeader(http.StatusCreated)
+}
+
+// head возвращает текущее смещение загрузки.
+func (h *TusHandler) head(w http.ResponseWriter, id string) {
+	u, err := h.storage.uploadInfo(id)
+	if err != nil {
+		h.writeUploadError(w, nil, err)
+		return
+	}
+
+	h.setUploadHeaders(w, u)
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Size, 10))
+	if len(u.Metadata) > 0 {
+		w.Header().Set("Upload-Metadata", formatUploadMetadata(u.Metadata))
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// patch дописывает данные в загрузку.
+func (h *TusHandler) patch(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("Content-Type") != offsetContentType {
+		writeError(w, http.StatusUnsupportedMediaType, "invalid Content-Type header")
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		writeError(w, http.StatusBadRequest, "invalid Upload-Offset header")
+		return
+	}
+
+	u, err := h.append(r, id, offset)
+	if err != nil {
+		h.writeUploadError(w, u, err)
+		return
+	}
+	if !h.complete(w, r, u) {
+		return
+	}
+
+	h.setUploadHeaders(w, u)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// delete удаляет загрузку.
+func (h *TusHandler) delete(w http.ResponseWriter, id string) {
+	if err := h.storage.removeUpload(id); err != nil {
+		h.writeUploadError(w, nil, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// get возвращает информацию о сохранённом файле.
+func (h *TusHandler) get(w http.ResponseWriter, id string) {
+	u, err := h.storage.uploadInfo(id)
+	if err != nil {
+		h.writeUploadError(w, nil, err)
+		return
+	}
+	if u.Result == nil {
+		writeErr(w, ErrUploadIncomplete)
+		return
+	}
+	writeJSON(w, http.StatusOK, u.Result)
+}
+
+// append дописывает тело запроса в загрузку и, если получены все данные, сохраняет файл в хранилище.
+func (h *TusHandler) append(r *http.Request, id string, offset int64) (*uploadState, error) {
+	u, err := h.storage.appendUpload(r.Context(), id, offset, r.Body)
+	if err != nil || u.Offset != u.Size {
+		return u, err
+	}
+	return h.storage.commitUpload(r.Context(), id)
+}
+
+// complete вызывает обработчик завершения загрузки. При ошибке записывает ответ и возвращает false.
+func (h *TusHandler) complete(w http.ResponseWriter, r *http.Request, u *uploadState) bool {
+	if u.Result == nil || h.onComplete == nil {
+		return true
+	}
+	if err := h.onComplete(r, u.Result); err != nil {
+		writeErr(w, err)
+		return false
+	}
+	return true
+}
+
+// allow проверяет права доступа и при отказе записывает ответ с ошибкой.
+func (h *TusHandler) allow(w http.ResponseWriter, r *http.Request, id string) bool {
+	err := h.authorize(r, OpUpload, id)
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, ErrUnauthorized) {
+		writeError(w, http.StatusUnauthorized, err.Error())
+	} else {
+		writeError(w, http.StatusForbidden, err.Error())
+	}
+	return false
+}
+
+func (h *TusHandler) methodNotAllowed(w http.ResponseWriter, allow string) {
+	w.Header().Set("Allow", allow)
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+// location возвращает абсолютный путь загрузки id. Используется исходный путь запроса,
+// поэтому ссылка остаётся верной и при подключении через http.StripPrefix.
+func (h *TusHandler) location(r *http.Request, id string) string {
+	path := r.URL.Path
+	if u, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		path = u.Path
+	}
+	return strings.TrimSuffix(path, "/") + "/" + id
+}
+
+// setUploadHeaders выставляет заголовки со смещением и сроком действия загрузки.
+func (h *TusHandler) setUploadHeaders(w http.ResponseWriter, u *uploadState) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	if !u.Expires.IsZero() {
+		w.Header().Set("Upload-Expires", u.Expires.UTC().Format(http.TimeFormat))
+	}
+}
+
+// writeUploadError записывает ответ с ошибкой загрузки. Если известно состояние загрузки,
+// клиенту сообщается смещение, с которого её можно продолжить.
+func (h *TusHandler) writeUploadError(w http.ResponseWriter, u *uploadState, err error) {
+	if u != nil {
+		h.setUploadHeaders(w, u)
+	}
+	writeErr(w, err)
+}
+
+// parseUploadMetadata разбирает заголовок Upload-Metadata: пары "ключ значение-в-base64" через запятую.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	if strings.TrimSpace(header) == "" {
+		return nil, nil
+	}
+
+	metadata := make(map[string]string)
+	for pair := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("invalid Upload-Metadata header")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, errors.New("invalid Upload-Metadata header")
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata, nil
+}
+
+// formatUploadMetadata формирует заголовок Upload-Metadata.
+func formatUploadMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for k := range metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(metadata[k])))
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,189 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// tusDo выполняет запрос протокола tus к обработчику h.
+func tusDo(h http.Handler, method, target string, body []byte, header map[string]string) *httptest.ResponseRecorder {
+	hdr := map[string]string{"Tus-Resumable": tusVersion}
+	if body != nil {
+		hdr["Content-Type"] = offsetContentType
+	}
+	for k, v := range header {
+		hdr[k] = v
+	}
+	return do(h, method, target, body, hdr)
+}
+
+func newTestTusHandler(t *testing.T, opts ...TusOption) (http.Handler, *LocalStorage) {
+	t.Helper()
+
+	s := newTestStorage(t)
+	return http.StripPrefix("/files", NewTusHandler(s, opts...)), s
+}
+
+func TestTusUpload(t *testing.T) {
+	var completed *FileInfo
+	h, s := newTestTusHandler(t, WithTusMaxSize(1<<20), WithTusCompleteHook(func(r *http.Request, fi *FileInfo) error {
+		completed = fi
+		return nil
+	}))
+
+	data := make([]byte, 100000)
+	rand.Read(data)
+
+	// Создание загрузки с первой частью данных
+	w := tusDo(h, http.MethodPost, "/files/", data[:1000], map[string]string{
+		"Upload-Length":   strconv.Itoa(len(data)),
+		"Upload-Metadata": "filename dGVzdC50eHQ=,empty ",
+	})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	loc := w.Header().Get("Location")
+	if filepath.Dir(loc) != "/files" {
+		t.Fatalf("unexpected Location %q", loc)
+	}
+	if w.Header().Get("Upload-Offset") != "1000" || w.Header().Get("Upload-Expires") == "" {
+		t.Fatalf("unexpected headers %v", w.Header())
+	}
+
+	w = tusDo(h, http.MethodHead, loc, nil, nil)
+	if w.Code != http.StatusOK || w.Header().Get("Upload-Offset") != "1000" || w.Header().Get("Upload-Length") != strconv.Itoa(len(data)) {
+		t.Fatalf("unexpected HEAD response %d %v", w.Code, w.Header())
+	}
+	if md := w.Header().Get("Upload-Metadata"); md != "empty ,filename dGVzdC50eHQ=" {
+		t.Fatalf("unexpected Upload-Metadata %q", md)
+	}
+	if w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatal("HEAD response must not be cached")
+	}
+
+	// Неверное смещение
+	w = tusDo(h, http.MethodPatch, loc, data[500:], map[string]string{"Upload-Offset": "500"})
+	assertError(t, w, http.StatusConflict)
+	if w.Header().Get("Upload-Offset") != "1000" {
+		t.Fatalf("expected current offset in response, got %v", w.Header())
+	}
+
+	// Файл недоступен до завершения загрузки
+	assertError(t, tusDo(h, http.MethodGet, loc, nil, nil), http.StatusConflict)
+
+	w = tusDo(h, http.MethodPatch, loc, data[1000:], map[string]string{"Upload-Offset": "1000"})
+	if w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != strconv.Itoa(len(data)) {
+		t.Fatalf("unexpected PATCH response %d %v", w.Code, w.Header())
+	}
+	if completed == nil {
+		t.Fatal("complete hook is not called")
+	}
+
+	w = tusDo(h, http.MethodGet, loc, nil, nil)
+	var fi FileInfo
+	decodeJSON(t, w, &fi)
+	if fi.Name != completed.Name || fi.Size != int64(len(data)) {
+		t.Fatalf("unexpected file info %+v", fi)
+	}
+	if !bytes.Equal(readBlob(t, s, fi.Name), data) {
+		t.Fatal("data mismatch")
+	}
+
+	// Запись в завершённую загрузку
+	assertError(t, tusDo(h, http.MethodPatch, loc, []byte("x"), map[string]string{"Upload-Offset": strconv.Itoa(len(data))}), http.StatusConflict)
+
+	if w := tusDo(h, http.MethodDelete, loc, nil, nil); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	assertError(t, tusDo(h, http.MethodHead, loc, nil, nil), http.StatusNotFound)
+}
+
+func TestTusEmptyUpload(t *testing.T) {
+	h, s := newTestTusHandler(t)
+
+	w := tusDo(h, http.MethodPost, "/files", nil, map[string]string{"Upload-Length": "0"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+	w = tusDo(h, http.MethodGet, w.Header().Get("Location"), nil, nil)
+	var fi FileInfo
+	decodeJSON(t, w, &fi)
+	if got := readBlob(t, s, fi.Name); len(got) != 0 {
+		t.Fatalf("expected empty file, got %q", got)
+	}
+}
+
+func TestTusErrors(t *testing.T) {
+	h, _ := newTestTusHandler(t, WithTusMaxSize(100), WithTusAuthorizer(func(r *http.Request, op Operation, id string) error {
+		if r.Header.Get("Authorization") == "" {
+			return ErrUnauthorized
+		}
+		return nil
+	}))
+	auth := map[string]string{"Authorization": "token"}
+
+	w := do(h, http.MethodOptions, "/files", nil, nil)
+	if w.Code != http.StatusNoContent || w.Header().Get("Tus-Version") != tusVersion ||
+		w.Header().Get("Tus-Extension") != tusExtensions || w.Header().Get("Tus-Max-Size") != "100" {
+		t.Fatalf("unexpected OPTIONS response %d %v", w.Code, w.Header())
+	}
+
+	w = do(h, http.MethodPost, "/files", nil, map[string]string{"Upload-Length": "1", "Authorization": "token"})
+	assertError(t, w, http.StatusPreconditionFailed)
+	if w.Header().Get("Tus-Version") != tusVersion {
+		t.Fatal("Tus-Version is missing")
+	}
+
+	assertError(t, tusDo(h, http.MethodPost, "/files", nil, map[string]string{"Upload-Length": "1"}), http.StatusUnauthorized)
+
+	cases := []struct {
+		name   string
+		header map[string]string
+		status int
+	}{
+		{name: "No length", header: map[string]string{}, status: http.StatusBadRequest},
+		{name: "Negative length", header: map[string]string{"Upload-Length": "-1"}, status: http.StatusBadRequest},
+		{name: "Too large", header: map[string]string{"Upload-Length": "101"}, status: http.StatusRequestEntityTooLarge},
+		{name: "Invalid metadata", header: map[string]string{"Upload-Length": "1", "Upload-Metadata": "key !!!"}, status: http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.header["Authorization"] = "token"
+			assertError(t, tusDo(h, http.MethodPost, "/files", nil, tc.header), tc.status)
+		})
+	}
+
+	w = tusDo(h, http.MethodPost, "/files", nil, map[string]string{"Upload-Length": "10", "Authorization": "token"})
+	loc := w.Header().Get("Location")
+	assertError(t, tusDo(h, http.MethodPatch, loc, nil, map[string]string{"Upload-Offset": "0", "Content-Type": "text/plain", "Authorization": "token"}), http.StatusUnsupportedMediaType)
+	assertError(t, tusDo(h, http.MethodPatch, loc, []byte("x"), map[string]string{"Upload-Offset": "x", "Authorization": "token"}), http.StatusBadRequest)
+	assertError(t, tusDo(h, http.MethodPut, loc, nil, auth), http.StatusMethodNotAllowed)
+	assertError(t, tusDo(h, http.MethodHead, "/files/unknown", nil, auth), http.StatusNotFound)
+}
+
+func TestTusExpiration(t *testing.T) {
+	h, s := newTestTusHandler(t, WithTusExpiration(time.Millisecond))
+
+	w := tusDo(h, http.MethodPost, "/files", []byte("part"), map[string]string{"Upload-Length": "10"})
+	loc := w.Header().Get("Location")
+	time.Sleep(5 * time.Millisecond)
+
+	assertError(t, tusDo(h, http.MethodPatch, loc, []byte("rest!!"), map[string]string{"Upload-Offset": "4"}), http.StatusGone)
+
+	// Истёкшие загрузки удаляются при очистке
+	if err := s.Clean(context.Background(), time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.uploadInfo(filepath.Base(loc)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+}
@@ -0,0 +1,550 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// uploadsDir каталог незавершённых загрузок внутри rootDir
+const uploadsDir = "~uploads"
+
+// DefaultUploadExpiration время жизни незавершённой загрузки по умолчанию.
+const DefaultUploadExpiration = 24 * time.Hour
+
+var (
+	// ErrUploadExpired возвращается при обращении к загрузке, срок действия которой истёк.
+	ErrUploadExpired = errors.New("upload expired")
+
+	// ErrOffsetMismatch возвращается, если смещение записи не совпадает с текущим размером загрузки.
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+
+	// ErrUploadIncomplete возвращается при попытке завершить загрузку, получившую не все данные.
+	ErrUploadIncomplete = errors.New("upload is not complete")
+
+	// ErrUploadCommitted возвращается при попытке записи в уже завершённую загрузку.
+	ErrUploadCommitted = errors.New("upload is already committed")
+)
+
+// UploadSession описывает загрузку файла по частям. Состояние сессии хранится в rootDir,
+// поэтому её можно продолжить после перезапуска процесса по идентификатору из ID.
+// Методы сессии безопасны для одновременного вызова из нескольких горутин.
+type UploadSession struct {
+	s  *LocalStorage
+	id string
+}
+
+type uploadOptions struct {
+	size      int64
+	metadata  map[string]string
+	expires   time.Time
+	expect    Expect
+	namespace string
+}
+
+type UploadOption func(*uploadOptions)
+
+// WithUploadSize задаёт ожидаемый размер файла. Запись сверх этого размера не выполняется,
+// а Commit возвращает ErrUploadIncomplete, пока не получены все данные.
+func WithUploadSize(size int64) UploadOption {
+	return func(o *uploadOptions) {
+		o.size = size
+	}
+}
+
+// WithUploadMetadata сохраняет произвольные метаданные вместе с загрузкой.
+func WithUploadMetadata(metadata map[string]string) UploadOption {
+	return func(o *uploadOptions) {
+		o.metadata = metadata
+	}
+}
+
+// WithUploadExpiration задаёт время жизни незавершённой загрузки.
+// По умолчанию загрузка не истекает и удаляется методом Clean по времени последнего изменения.
+func WithUploadExpiration(d time.Duration) UploadOption {
+	return func(o *uploadOptions) {
+		o.expires = time.Now().Add(d)
+	}
+}
+
+// WithExpectedMD5 задаёт ожидаемую хеш-сумму MD5 содержимого в шестнадцатеричном виде.
+// Commit возвращает *DigestMismatchError, если хеш-сумма не совпадает.
+func WithExpectedMD5(sum string) UploadOption {
+	return func(o *uploadOptions) {
+		o.expect.MD5 = sum
+	}
+}
+
+// WithExpected задаёт ожидаемые размер и хеш-суммы содержимого, которые проверяет Commit.
+func WithExpected(expect Expect) UploadOption {
+	return func(o *uploadOptions) {
+		o.expect = expect
+	}
+}
+
+// WithUploadNamespace сохраняет файл от имени пространства имён ns (см. WithNamespace).
+// Если размер файла известен заранее, квота проверяется уже при начале загрузки.
+func WithUploadNamespace(ns string) UploadOption {
+	return func(o *uploadOptions) {
+		o.namespace = ns
+	}
+}
+
+// BeginUpload начинает новую загрузку по частям.
+func (s *LocalStorage) BeginUpload(opts ...UploadOption) (*UploadSession, error) {
+	o := &uploadOptions{size: -1}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	u, err := s.createUpload(&uploadState{
+		Size:      o.size,
+		Metadata:  o.metadata,
+		Expires:   o.expires,
+		Expect:    o.expect,
+		Namespace: o.namespace,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &UploadSession{s: s, id: u.ID}, nil
+}
+
+// ResumeUpload возвращает начатую ранее загрузку по её идентификатору.
+func (s *LocalStorage) ResumeUpload(id string) (*UploadSession, error) {
+	if _, err := s.uploadInfo(id); err != nil {
+		return nil, err
+	}
+	return &UploadSession{s: s, id: id}, nil
+}
+
+// ID возвращает идентификатор загрузки.
+func (u *UploadSession) ID() string { return u.id }
+
+// Offset возвращает количество полученных байт.
+func (u *UploadSession) Offset() (int64, error) {
+	st, err := u.s.uploadInfo(u.id)
+	if err != nil {
+		return 0, err
+	}
+	return st.Offset, nil
+}
+
+// WriteAt записывает p со смещения off, которое должно совпадать с количеством полученных байт.
+// В противном случае возвращается ErrOffsetMismatch.
+func (u *UploadSession) WriteAt(p []byte, off int64) (int, error) {
+	st, err := u.s.appendUpload(context.Background(), u.id, off, bytes.NewReader(p))
+	if err != nil {
+		if st != nil && st.Offset > off {
+			return int(st.Offset - off), err
+		}
+		return 0, err
+	}
+	if n := st.Offset - off; n < int64(len(p)) {
+		return int(n), io.ErrShortWrite
+	}
+	return len(p), nil
+}
+
+// Append дописывает содержимое r в конец загрузки и возвращает количество записанных байт.
+// Данные, полученные до ошибки чтения, сохраняются.
+func (u *UploadSession) Append(ctx context.Context, r io.Reader) (int64, error) {
+	for {
+		st, err := u.s.uploadInfo(u.id)
+		if err != nil {
+			return 0, err
+		}
+
+		st2, err := u.s.appendUpload(ctx, u.id, st.Offset, r)
+		if errors.Is(err, ErrOffsetMismatch) {
+			// Другой писатель успел дописать данные — повторяем с новым смещением
+			continue
+		}
+		if st2 != nil {
+			return st2.Offset - st.Offset, err
+		}
+		return 0, err
+	}
+}
+
+// Commit помещает полученный файл в хранилище и возвращает информацию о нём.
+// Повторный вызов возвращает тот же результат.
+func (u *UploadSession) Commit(ctx context.Context) (*FileInfo, error) {
+	st, err := u.s.commitUpload(ctx, u.id)
+	if err != nil {
+		return nil, err
+	}
+	return st.Result, nil
+}
+
+// Abort отменяет загрузку и удаляет полученные данные.
+func (u *UploadSession) Abort() error {
+	return u.s.removeUpload(u.id)
+}
+
+// uploadState описывает состояние загрузки, которое сохраняется между запросами.
+// Состояние хеш-функций позволяет продолжать подсчёт хеш-сумм без повторного чтения данных.
+type uploadState struct {
+	ID       string            `json:"id"`
+	Size     int64             `json:"size"` // -1, если размер заранее неизвестен
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Created  time.Time         `json:"created"`
+	Expires  time.Time         `json:"expires,omitzero"`
+	Expect   Expect            `json:"expect,omitzero"`
+	Hashes   *hashState        `json:"hashes"`
+
+	Namespace string    `json:"namespace,omitempty"` // пространство имён, в квоте которого учитывается файл
+	Result    *FileInfo `json:"result,omitempty"`    // информация о файле после завершения загрузки
+}
+
+// expired проверяет, истёк ли срок действия загрузки.
+func (u *uploadState) expired(now time.Time) bool {
+	return !u.Expires.IsZero() && now.After(u.Expires)
+}
+
+// uploadPath возвращает путь к каталогу загрузки id.
+func (s *LocalStorage) uploadPath(id string) (string, error) {
+	if len(id) != 32 || strings.Trim(id, "0123456789abcdef") != "" {
+		return "", os.ErrNotExist
+	}
+	return filepath.Join(s.rootDir, uploadsDir, id), nil
+}
+
+// lockUpload блокирует загрузку id и возвращает функцию разблокировки.
+func (s *LocalStorage) lockUpload(id string) func() {
+	key := uploadsDir + "/" + id
+	mu := s.getMutex(key)
+	mu.Lock()
+	return func() {
+		mu.Unlock()
+		s.releaseMutex(key)
+	}
+}
+
+// createUpload создаёт загрузку с параметрами из u и заполняет остальные поля состояния.
+func (s *LocalStorage) createUpload(u *uploadState) (*uploadState, error) {
+	if u.Size < -1 {
+		return nil, errors.New("invalid upload size")
+	}
+	if u.Namespace != "" && u.Size >= 0 {
+		if err := s.checkQuota(u.Namespace, u.Size); err != nil {
+			return nil, err
+		}
+	}
+
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	u.ID = hex.EncodeToString(b[:])
+	u.Created = time.Now()
+
+	dir, err := s.uploadPath(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, s.perm); err != nil {
+		return nil, err
+	}
+
+	if u.Hashes, err = newHasher().state(); err != nil {
+		return nil, err
+	}
+
+	if err := func() error {
+		data, err := os.OpenFile(filepath.Join(dir, "data"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, s.perm&0666)
+		if err != nil {
+			return err
+		}
+		if err := data.Close(); err != nil {
+			return err
+		}
+		return s.saveUpload(u)
+	}(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// uploadInfo возвращает состояние загрузки id.
+func (s *LocalStorage) uploadInfo(id string) (*uploadState, error) {
+	unlock := s.lockUpload(id)
+	defer unlock()
+
+	return s.loadUpload(id)
+}
+
+// appendUpload дописывает содержимое r в загрузку id со смещения offset. Данные, принятые
+// до ошибки чтения, сохраняются, и загрузку можно продолжить с нового смещения.
+func (s *LocalStorage) appendUpload(ctx context.Context, id string, offset int64, r io.Reader) (*uploadState, error) {
+	unlock := s.lockUpload(id)
+	defer unlock()
+
+	u, err := s.loadUpload(id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Result != nil {
+		return u, ErrUploadCommitted
+	}
+	if offset != u.Offset {
+		return u, ErrOffsetMismatch
+	}
+
+	h, err := restoreHasher(u.Hashes)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, _ := s.uploadPath(id)
+	data, err := os.OpenFile(filepath.Join(dir, "data"), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, s.wrapPathError(err, id)
+	}
+
+	// Отбрасываем данные, записанные после последнего сохранения состояния
+	copyErr := data.Truncate(u.Offset)
+	if copyErr == nil {
+		_, copyErr = data.Seek(u.Offset, io.SeekStart)
+	}
+	if copyErr == nil {
+		if u.Size >= 0 {
+			r = io.LimitReader(r, u.Size-u.Offset)
+		}
+		var n int64
+		n, copyErr = copyHashed(ctx, data, r, h)
+		u.Offset += n
+	}
+	// Данные должны оказаться на диске раньше состояния, которое на них ссылается
+	if s.durable && u.Offset > 0 {
+		if err := data.Sync(); err != nil && copyErr == nil {
+			copyErr = err
+		}
+	}
+	if err := data.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+
+	if u.Hashes, err = h.state(); err != nil {
+		return nil, err
+	}
+	if err := s.saveUpload(u); err != nil {
+		return nil, err
+	}
+	return u, copyErr
+}
+
+// commitUpload проверяет полученные данные и помещает файл в хранилище.
+func (s *LocalStorage) commitUpload(ctx context.Context, id string) (*uploadState, error) {
+	unlock := s.lockUpload(id)
+	defer unlock()
+
+	u, err := s.loadUpload(id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Result != nil {
+		return u, nil
+	}
+	if u.Size >= 0 && u.Offset != u.Size {
+		return u, ErrUploadIncomplete
+	}
+	if err := ctx.Err(); err != nil {
+		return u, err
+	}
+
+	h, err := restoreHasher(u.Hashes)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.Expect.verify(h, u.Offset); err != nil {
+		return u, err
+	}
+
+	if err := s.finishUpload(u, h); err != nil {
+		return u, err
+	}
+	return u, nil
+}
+
+// finishUpload помещает полностью загруженный файл в хранилище тем же способом, что и Create.
+func (s *LocalStorage) finishUpload(u *uploadState, h *hasher) error {
+	dir, _ := s.uploadPath(u.ID)
+	dataPath := filepath.Join(dir, "data")
+
+	// Определяем MIME-тип по началу содержимого
+	data, err := os.Open(dataPath)
+	if err != nil {
+		return err
+	}
+	var buf [512]byte
+	n, err := io.ReadFull(data, buf[:])
+	data.Close()
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	fi := s.newFileInfo(h, http.DetectContentType(buf[:n]), u.Offset)
+	if err := s.commit(dataPath, fi, newCreateOptions([]CreateOption{WithNamespace(u.Namespace)})); err != nil {
+		return err
+	}
+	os.Remove(dataPath)
+
+	u.Result = fi
+	return s.saveUpload(u)
+}
+
+// removeUpload удаляет загрузку id вместе с принятыми данными.
+func (s *LocalStorage) removeUpload(id string) error {
+	unlock := s.lockUpload(id)
+	defer unlock()
+
+	dir, err := s.uploadPath(id)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return s.wrapPathError(err, id)
+	}
+	return os.RemoveAll(dir)
+}
+
+// cleanUploads удаляет истёкшие загрузки, а также загрузки без срока действия,
+// которые не изменялись дольше lifetime.
+func (s *LocalStorage) cleanUploads(ctx context.Context, lifetime time.Duration) error {
+	entries, err := os.ReadDir(filepath.Join(s.rootDir, uploadsDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		id := entry.Name()
+		dir, err := s.uploadPath(id)
+		if err != nil {
+			continue
+		}
+
+		func() {
+			unlock := s.lockUpload(id)
+			defer unlock()
+
+			u, err := s.readUpload(id)
+			if err == nil && u.Expires.IsZero() {
+				// Срок не задан — ориентируемся на время последнего изменения
+				if info, err := os.Stat(filepath.Join(dir, "state.json")); err == nil && info.ModTime().After(now.Add(-lifetime)) {
+					return
+				}
+			} else if err == nil && lifetime > 0 && !u.expired(now) {
+				return
+			}
+			os.RemoveAll(dir)
+		}()
+	}
+	return nil
+}
+
+// loadUpload читает состояние загрузки и проверяет срок её действия.
+// Вызывающий должен удерживать блокировку загрузки.
+func (s *LocalStorage) loadUpload(id string) (*uploadState, error) {
+	u, err := s.readUpload(id)
+	if err != nil {
+		return nil, err
+	}
+	if u.expired(time.Now()) {
+		return nil, ErrUploadExpired
+	}
+	return u, nil
+}
+
+// readUpload читает состояние загрузки.
+func (s *LocalStorage) readUpload(id string) (*uploadState, error) {
+	dir, err := s.uploadPath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "state.json"))
+	if err != nil {
+		return nil, s.wrapPathError(err, id)
+	}
+
+	u := &uploadState{}
+	if err := json.Unmarshal(data, u); err != nil {
+		return nil, err
+	}
+	if u.ID != id {
+		return nil, errors.New("invalid upload state")
+	}
+	return u, nil
+}
+
+// saveUpload атомарно сохраняет состояние загрузки.
+func (s *LocalStorage) saveUpload(u *uploadState) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := s.writeTemp(data)
+	if err != nil {
+		return err
+	}
+
+	dir, _ := s.uploadPath(u.ID)
+	if err := s.rename(tmp, filepath.Join(dir, "state.json")); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// copyHashed копирует r в w и учитывает в хеш-суммах только фактически записанные данные.
+func copyHashed(ctx context.Context, w io.Writer, r io.Reader, h *hasher) (int64, error) {
+	buf := make([]byte, 32<<10)
+	var written int64
+	for {
+		select {
+		case <-ctx.Done():
+			return written, ctx.Err()
+		default:
+		}
+
+		nr, rerr := r.Read(buf)
+		if nr > 0 {
+			nw, werr := w.Write(buf[:nr])
+			h.Write(buf[:nw])
+			written += int64(nw)
+			if werr != nil {
+				return written, werr
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUploadSession(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 300000)
+	rand.Read(data)
+	sum := md5.Sum(data)
+
+	u, err := s.BeginUpload(WithExpectedMD5(hex.EncodeToString(sum[:])), WithUploadMetadata(map[string]string{"filename": "a.bin"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := u.WriteAt(data[:1000], 0); err != nil || n != 1000 {
+		t.Fatalf("WriteAt: %d, %v", n, err)
+	}
+	if _, err := u.WriteAt(data[:1000], 10); !errors.Is(err, ErrOffsetMismatch) {
+		t.Fatalf("expected ErrOffsetMismatch, got %v", err)
+	}
+
+	// Хеш-сумма неполных данных не совпадает с ожидаемой
+	var de *DigestMismatchError
+	if _, err := u.Commit(ctx); !errors.As(err, &de) || de.Algorithm != "md5" {
+		t.Fatalf("expected md5 mismatch, got %v", err)
+	}
+	s.Close()
+
+	// Загрузка продолжается после перезапуска
+	s, err = NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	u, err = s.ResumeUpload(u.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off, err := u.Offset(); err != nil || off != 1000 {
+		t.Fatalf("Offset: %d, %v", off, err)
+	}
+	if n, err := u.Append(ctx, bytes.NewReader(data[1000:])); err != nil || n != int64(len(data)-1000) {
+		t.Fatalf("Append: %d, %v", n, err)
+	}
+
+	fi, err := u.Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi2, err := u.Commit(ctx); err != nil || *fi2 != *fi {
+		t.Fatalf("repeated Commit: %v, %v", fi2, err)
+	}
+	if !bytes.Equal(readBlob(t, s, fi.Name), data) {
+		t.Fatal("data mismatch")
+	}
+
+	if _, err := u.Append(ctx, bytes.NewReader(data)); !errors.Is(err, ErrUploadCommitted) {
+		t.Fatalf("expected ErrUploadCommitted, got %v", err)
+	}
+	if err := u.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ResumeUpload(u.ID()); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+	if _, err := s.ResumeUpload("../../etc"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestUploadSessionSize(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	u, err := s.BeginUpload(WithUploadSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.WriteAt([]byte("hello"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := u.Commit(ctx); !errors.Is(err, ErrUploadIncomplete) {
+		t.Fatalf("expected ErrUploadIncomplete, got %v", err)
+	}
+
+	// Данные сверх заданного размера не записываются
+	if n, err := u.WriteAt([]byte(" world!"), 5); n != 5 || !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("expected short write of 5 bytes, got %d, %v", n, err)
+	}
+	fi, err := u.Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := readBlob(t, s, fi.Name); string(got) != "hello worl" {
+		t.Fatalf("unexpected content %q", got)
+	}
+
+	if _, err := s.BeginUpload(WithUploadSize(-2)); err == nil {
+		t.Fatal("expected error for invalid size")
+	}
+}
+
+func TestUploadSessionExpiration(t *testing.T) {
+	s := newTestStorage(t)
+
+	u, err := s.BeginUpload(WithUploadExpiration(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := u.WriteAt([]byte("late"), 0); !errors.Is(err, ErrUploadExpired) {
+		t.Fatalf("expected ErrUploadExpired, got %v", err)
+	}
+	if _, err := s.ResumeUpload(u.ID()); !errors.Is(err, ErrUploadExpired) {
+		t.Fatalf("expected ErrUploadExpired, got %v", err)
+	}
+}
+
+func TestUploadSessionConcurrentAppend(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+
+	u, err := s.BeginUpload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const writers, size = 8, 1000
+	var wg sync.WaitGroup
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := u.Append(ctx, bytes.NewReader(bytes.Repeat([]byte{byte('a' + i)}, size))); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	fi, err := u.Commit(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readBlob(t, s, fi.Name)
+	if len(got) != writers*size {
+		t.Fatalf("expected %d bytes, got %d", writers*size, len(got))
+	}
+	// Данные каждого писателя записаны одним непрерывным куском
+	for off := 0; off < len(got); off += size {
+		if !bytes.Equal(got[off:off+size], bytes.Repeat(got[off:off+1], size)) {
+			t.Fatalf("interleaved data at offset %d", off)
+		}
+	}
+}